@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/frostyard/plow/internal/repo"
@@ -8,31 +9,60 @@ import (
 )
 
 var (
-	addDist string
+	addDist           string
+	addComponent      string
+	addAllowDowngrade bool
 )
 
 var addCmd = &cobra.Command{
 	Use:   "add <deb-file>",
 	Short: "Add a .deb package to the repository",
-	Long: `Adds a .deb package to the repository pool, updates the package index,
-and optionally prunes old versions.`,
+	Long: `Adds a .deb package to the repository pool, records it as a member of the
+distribution, updates the package index, and optionally prunes old versions.
+
+Uploads are checked first. The package name and version must be valid
+Debian syntax, a different file may not replace one already published under
+the same name, version and architecture, and a version older than the
+distribution's newest is refused unless --allow-downgrade is given. Adding a
+file the distribution already has changes nothing.`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		debPath := args[0]
 
-		cfg := repo.DefaultConfig()
-		r := repo.New(repoRoot, cfg)
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
 
 		// Add the package
-		pkg, err := r.AddPackage(debPath, addDist)
+		result, err := r.AddPackage(repo.AddOptions{
+			Path:           debPath,
+			Dist:           addDist,
+			Component:      addComponent,
+			AllowDowngrade: addAllowDowngrade,
+		})
+		var downgrade *repo.DowngradeError
+		if errors.As(err, &downgrade) {
+			return fmt.Errorf("add package: %w (use --allow-downgrade to add it anyway)", err)
+		}
+		var conflict *repo.ConflictError
+		if errors.As(err, &conflict) {
+			return fmt.Errorf("add package: %w (upload it under a new version)", err)
+		}
 		if err != nil {
 			return fmt.Errorf("add package: %w", err)
 		}
+		pkg := result.Package
+		if result.Unchanged {
+			fmt.Printf("Package already in %s: %s %s (%s)\n", addDist, pkg.Name, pkg.Version, pkg.Architecture)
+			return nil
+		}
 
 		fmt.Printf("Added package: %s %s (%s)\n", pkg.Name, pkg.Version, pkg.Architecture)
 		fmt.Printf("  Pool path: %s\n", pkg.Filename)
 
 		// Prune old versions
+		dists := []string{addDist}
 		if keepVersions > 0 {
 			result, err := r.Prune(repo.PruneOptions{
 				KeepVersions: keepVersions,
@@ -40,22 +70,29 @@ and optionally prunes old versions.`,
 			if err != nil {
 				return fmt.Errorf("prune: %w", err)
 			}
+			for _, dist := range result.Dists {
+				fmt.Printf("  Pruned %d old version(s) from %s\n", len(result.Removed[dist]), dist)
+				if dist != addDist {
+					dists = append(dists, dist)
+				}
+			}
 			if len(result.Deleted) > 0 {
-				fmt.Printf("  Pruned %d old version(s)\n", len(result.Deleted))
+				fmt.Printf("  Deleted %d pool file(s), reclaimed %s\n", len(result.Deleted), repo.FormatSize(result.Bytes))
 			}
 		}
 
-		// Regenerate index
-		if err := r.GeneratePackagesIndex(addDist); err != nil {
-			return fmt.Errorf("generate packages index: %w", err)
-		}
-		fmt.Printf("  Updated Packages index for %s\n", addDist)
+		// Regenerate index and Release for every distribution that changed
+		for _, dist := range dists {
+			if err := r.GeneratePackagesIndex(dist); err != nil {
+				return fmt.Errorf("generate packages index: %w", err)
+			}
+			fmt.Printf("  Updated Packages index for %s\n", dist)
 
-		// Generate Release
-		if err := r.GenerateRelease(addDist); err != nil {
-			return fmt.Errorf("generate release: %w", err)
+			if err := r.GenerateRelease(dist); err != nil {
+				return fmt.Errorf("generate release: %w", err)
+			}
+			fmt.Printf("  Updated Release for %s\n", dist)
 		}
-		fmt.Printf("  Updated Release for %s\n", addDist)
 
 		// Generate HTML indexes for browsing
 		if err := r.GenerateHTMLIndexes(); err != nil {
@@ -69,5 +106,7 @@ and optionally prunes old versions.`,
 
 func init() {
 	addCmd.Flags().StringVarP(&addDist, "dist", "d", "stable", "Distribution to add the package to (stable, testing)")
+	addCmd.Flags().StringVar(&addComponent, "component", "", "Component to add the package to (default: the distribution's first component)")
+	addCmd.Flags().BoolVar(&addAllowDowngrade, "allow-downgrade", false, "Add the package even if the distribution has a newer version")
 	rootCmd.AddCommand(addCmd)
 }
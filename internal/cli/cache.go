@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the package metadata cache",
+	Long: `Plow caches the metadata of every pool file in .plow/cache.json so that indexing
+does not re-read each .deb on every run. Use these commands when the cache is
+suspected to be stale.`,
+}
+
+var cacheRebuildCmd = &cobra.Command{
+	Use:   "rebuild",
+	Short: "Discard the cache and re-parse every pool file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
+
+		n, err := r.RebuildCache()
+		if err != nil {
+			return fmt.Errorf("rebuild cache: %w", err)
+		}
+
+		fmt.Printf("Cached metadata for %d package file(s)\n", n)
+		return nil
+	},
+}
+
+var cacheVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check the cache against the pool without modifying it",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
+
+		report, err := r.VerifyCache()
+		if err != nil {
+			return fmt.Errorf("verify cache: %w", err)
+		}
+
+		fmt.Printf("Checked: %d cached package file(s)\n", report.Checked)
+		for _, p := range report.Stale {
+			fmt.Printf("  stale: %s\n", p)
+		}
+		for _, p := range report.Missing {
+			fmt.Printf("  missing from pool: %s\n", p)
+		}
+		for _, p := range report.Uncached {
+			fmt.Printf("  not cached: %s\n", p)
+		}
+
+		if !report.OK() {
+			return fmt.Errorf("cache is out of date; run 'plow cache rebuild'")
+		}
+		fmt.Println("Cache is up to date")
+		return nil
+	},
+}
+
+func init() {
+	cacheCmd.AddCommand(cacheRebuildCmd)
+	cacheCmd.AddCommand(cacheVerifyCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
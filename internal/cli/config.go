@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the repository configuration",
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the effective configuration",
+	Long: `Prints the configuration plow uses, with the inherited settings of every
+distribution filled in. The output is valid plow.yaml.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, path, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		data, err := cfg.Effective().Marshal()
+		if err != nil {
+			return err
+		}
+
+		if path == "" {
+			fmt.Println("# No plow.yaml found; using built-in defaults")
+		} else {
+			fmt.Printf("# Loaded from %s\n", path)
+		}
+		fmt.Print(string(data))
+		return nil
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the configuration file for errors",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, path, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		if path == "" {
+			fmt.Println("No plow.yaml found; built-in defaults are valid")
+			return nil
+		}
+		fmt.Printf("%s is valid\n", path)
+		return nil
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configValidateCmd)
+	rootCmd.AddCommand(configCmd)
+}
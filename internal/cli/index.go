@@ -3,7 +3,6 @@ package cli
 import (
 	"fmt"
 
-	"github.com/frostyard/plow/internal/repo"
 	"github.com/spf13/cobra"
 )
 
@@ -16,8 +15,10 @@ var indexCmd = &cobra.Command{
 	Short: "Regenerate repository index files",
 	Long:  `Regenerates the Packages and Release files for a distribution, and generates HTML index pages for browser-friendly navigation.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		cfg := repo.DefaultConfig()
-		r := repo.New(repoRoot, cfg)
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
 
 		if err := r.GeneratePackagesIndex(indexDist); err != nil {
 			return fmt.Errorf("generate packages index: %w", err)
@@ -2,6 +2,8 @@ package cli
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 
 	"github.com/frostyard/plow/internal/repo"
 	"github.com/spf13/cobra"
@@ -10,24 +12,40 @@ import (
 var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Initialize repository directory structure",
-	Long:  `Creates the initial directory structure for a Debian repository.`,
+	Long: `Creates the initial directory structure for a Debian repository, and a
+plow.yaml holding the default configuration if the repository has none.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		cfg := repo.DefaultConfig()
+		cfg, path, err := loadConfig()
+		if err != nil {
+			return err
+		}
 		r := repo.New(repoRoot, cfg)
 
 		if err := r.Init(); err != nil {
 			return fmt.Errorf("initialize repository: %w", err)
 		}
 
+		if path == "" {
+			data, err := cfg.Marshal()
+			if err != nil {
+				return err
+			}
+			path = filepath.Join(repoRoot, repo.ConfigFile)
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				return fmt.Errorf("write config: %w", err)
+			}
+		}
+
 		if err := r.GenerateHTMLIndexes(); err != nil {
 			return fmt.Errorf("generate HTML indexes: %w", err)
 		}
 
 		fmt.Println("Repository initialized successfully")
 		fmt.Printf("  Root: %s\n", repoRoot)
-		fmt.Printf("  Distributions: %v\n", cfg.Distributions)
-		fmt.Printf("  Components: %v\n", cfg.Components)
-		fmt.Printf("  Architectures: %v\n", cfg.Architectures)
+		fmt.Printf("  Config: %s\n", path)
+		fmt.Printf("  Distributions: %v\n", r.Config.Distributions)
+		fmt.Printf("  Components: %v\n", r.Config.Components)
+		fmt.Printf("  Architectures: %v\n", r.Config.Architectures)
 
 		return nil
 	},
@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/frostyard/plow/internal/gpg"
+	"github.com/frostyard/plow/internal/repo"
+	"github.com/spf13/cobra"
+)
+
+var (
+	keySigner        signerFlags
+	keyOutput        string
+	keyKeyringOutput string
+)
+
+var keyCmd = &cobra.Command{
+	Use:   "key",
+	Short: "Manage the repository signing key",
+}
+
+var keyExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the public signing keys",
+	Long: `Writes the public keys of the signing keys, by default to public.key
+(ASCII-armored) and keyring.gpg (a binary keyring) in the repository root,
+where clients download them from.
+
+Without --key, every key of the signing_keys schedule in plow.yaml that is not
+retired is exported, including keys that only start signing later, so clients
+already trust a new key when it is put to use. Keys that expire within
+key_expiry_warning are reported, and with --fail-expiring refused.
+
+With keyring_package enabled in plow.yaml, the archive keyring package is
+rebuilt with a new version whenever the exported keys change, and added to
+the distribution its APT source names. That distribution's Release must be
+signed again afterwards, for example with 'plow refresh'.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
+		signer, err := keySigner.scheduledSigner(r.Config, true)
+		if err != nil {
+			return err
+		}
+		if _, err := keySigner.checkExpiry(signer, r.Config.KeyExpiryWarning); err != nil {
+			return err
+		}
+
+		output := keyOutput
+		if output == "" {
+			output = filepath.Join(repoRoot, repo.PublicKeyFile)
+		}
+		if err := gpg.ExportPublicKey(signer, output); err != nil {
+			return fmt.Errorf("export public key: %w", err)
+		}
+		keyringOutput := keyKeyringOutput
+		if keyringOutput == "" {
+			keyringOutput = filepath.Join(repoRoot, repo.KeyringFile)
+		}
+		if err := gpg.ExportKeyring(signer, keyringOutput); err != nil {
+			return fmt.Errorf("export keyring: %w", err)
+		}
+
+		fmt.Printf("Exported public key to %s\n", output)
+		fmt.Printf("Exported keyring to %s\n", keyringOutput)
+
+		if !r.Config.KeyringPackage.Enabled {
+			return nil
+		}
+		keyring, err := gpg.Keyring(signer)
+		if err != nil {
+			return fmt.Errorf("export keyring: %w", err)
+		}
+		result, err := r.UpdateKeyringPackage(keyring)
+		if err != nil {
+			return fmt.Errorf("update keyring package: %w", err)
+		}
+		if result.Built {
+			fmt.Printf("Built %s %s\n", result.Name, result.Version)
+		}
+		if len(result.Dists) == 0 {
+			fmt.Printf("%s %s is up to date\n", result.Name, result.Version)
+			return nil
+		}
+		for _, dist := range result.Dists {
+			fmt.Printf("  Added %s %s to %s; sign its Release again\n", result.Name, result.Version, dist)
+		}
+		if err := r.GenerateHTMLIndexes(); err != nil {
+			return fmt.Errorf("generate HTML indexes: %w", err)
+		}
+		fmt.Println("  Generated HTML index pages")
+		return nil
+	},
+}
+
+func init() {
+	keySigner.register(keyExportCmd)
+	keySigner.registerExpiry(keyExportCmd)
+	keyExportCmd.Flags().StringVarP(&keyOutput, "output", "o", "", "File to write the armored keys to (default <repo-root>/public.key)")
+	keyExportCmd.Flags().StringVar(&keyKeyringOutput, "keyring", "", "File to write the binary keyring to (default <repo-root>/keyring.gpg)")
+	keyCmd.AddCommand(keyExportCmd)
+	rootCmd.AddCommand(keyCmd)
+}
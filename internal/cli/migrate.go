@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/frostyard/plow/internal/repo"
+	"github.com/spf13/cobra"
+)
+
+var (
+	migratePoolDryRun bool
+)
+
+var migratePoolCmd = &cobra.Command{
+	Use:   "migrate-pool",
+	Short: "Rename pool files to their canonical names",
+	Long: `Moves every pool file to the path plow add now stores packages at,
+pool/<component>/<prefix>/<name>/name_version_arch.deb with the epoch left out,
+and regenerates the Packages and Release files of the distributions that refer
+to them. Identical copies of a package are merged into one file. If two files
+with different contents would get the same name, nothing is changed.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
+
+		result, err := r.MigratePool(repo.MigratePoolOptions{DryRun: migratePoolDryRun})
+		if err != nil {
+			return fmt.Errorf("migrate pool: %w", err)
+		}
+
+		if migratePoolDryRun {
+			fmt.Println("Dry run - no changes made")
+		}
+		for _, rename := range result.Renamed {
+			fmt.Printf("Renamed: %s -> %s\n", rename.From, rename.To)
+		}
+		if len(result.Renamed) == 0 {
+			fmt.Println("Pool already uses canonical file names")
+		}
+
+		if migratePoolDryRun || len(result.Renamed) == 0 {
+			return nil
+		}
+
+		for _, dist := range result.Dists {
+			if err := r.GeneratePackagesIndex(dist); err != nil {
+				return fmt.Errorf("generate packages index: %w", err)
+			}
+			if err := r.GenerateRelease(dist); err != nil {
+				return fmt.Errorf("generate release: %w", err)
+			}
+			fmt.Printf("Updated Packages and Release for %s\n", dist)
+		}
+		if err := r.GenerateHTMLIndexes(); err != nil {
+			return fmt.Errorf("generate HTML indexes: %w", err)
+		}
+		fmt.Println("Generated HTML index pages")
+
+		return nil
+	},
+}
+
+func init() {
+	migratePoolCmd.Flags().BoolVarP(&migratePoolDryRun, "dry-run", "n", false, "Show what would be renamed without changing anything")
+	rootCmd.AddCommand(migratePoolCmd)
+}
@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/frostyard/plow/internal/repo"
+	"github.com/spf13/cobra"
+)
+
+var (
+	promoteFrom           string
+	promoteTo             string
+	promoteVersion        string
+	promoteDryRun         bool
+	promoteAllowDowngrade bool
+)
+
+var promoteCmd = &cobra.Command{
+	Use:   "promote <package-or-pattern>",
+	Short: "Promote package versions from one distribution to another",
+	Long: `Copies package versions from one distribution to another without re-uploading.
+The argument is a package name or a glob pattern such as 'frostyard-*'. Unless
+--version is given, the newest version of each matching package is promoted.
+
+Promotions are checked like uploads: a version older than the target
+distribution's newest is refused unless --allow-downgrade is given. Only the
+target distribution's Packages and Release files are regenerated.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
+
+		result, err := r.Promote(repo.PromoteOptions{
+			From:           promoteFrom,
+			To:             promoteTo,
+			Package:        args[0],
+			Version:        promoteVersion,
+			DryRun:         promoteDryRun,
+			AllowDowngrade: promoteAllowDowngrade,
+		})
+		var downgrade *repo.DowngradeError
+		if errors.As(err, &downgrade) {
+			return fmt.Errorf("promote: %w (use --allow-downgrade to promote it anyway)", err)
+		}
+		if err != nil {
+			return fmt.Errorf("promote: %w", err)
+		}
+
+		if promoteDryRun {
+			fmt.Println("Dry run - no changes made")
+		}
+
+		for _, e := range result.Promoted {
+			fmt.Printf("Promoted: %s %s (%s) %s -> %s\n", e.Name, e.Version, e.Architecture, promoteFrom, promoteTo)
+		}
+		for _, e := range result.Skipped {
+			fmt.Printf("Already in %s: %s %s (%s)\n", promoteTo, e.Name, e.Version, e.Architecture)
+		}
+
+		if promoteDryRun || len(result.Promoted) == 0 {
+			return nil
+		}
+
+		fmt.Printf("  Updated Packages and Release for %s\n", promoteTo)
+
+		if err := r.GenerateHTMLIndexes(); err != nil {
+			return fmt.Errorf("generate HTML indexes: %w", err)
+		}
+		fmt.Println("  Generated HTML index pages")
+
+		return nil
+	},
+}
+
+func init() {
+	promoteCmd.Flags().StringVar(&promoteFrom, "from", "testing", "Distribution to promote from")
+	promoteCmd.Flags().StringVar(&promoteTo, "to", "stable", "Distribution to promote to")
+	promoteCmd.Flags().StringVar(&promoteVersion, "version", "", "Specific version to promote (default: newest)")
+	promoteCmd.Flags().BoolVarP(&promoteDryRun, "dry-run", "n", false, "Show what would be promoted without changing anything")
+	promoteCmd.Flags().BoolVar(&promoteAllowDowngrade, "allow-downgrade", false, "Promote even if the target distribution has a newer version")
+	rootCmd.AddCommand(promoteCmd)
+}
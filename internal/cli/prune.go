@@ -2,26 +2,41 @@ package cli
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/frostyard/plow/internal/repo"
 	"github.com/spf13/cobra"
 )
 
 var (
-	pruneDryRun bool
+	pruneDryRun  bool
+	pruneExplain bool
+	pruneOrphans bool
 )
 
 var pruneCmd = &cobra.Command{
 	Use:   "prune",
 	Short: "Remove old package versions",
-	Long:  `Removes old package versions from the pool, keeping only the newest N versions per package.`,
+	Long: `Removes old package versions. Each distribution is pruned separately: the
+retention settings in plow.yaml decide which versions of each package it keeps,
+and packages no retention rule matches keep their newest --keep-versions
+versions. The newest version of every package is always kept. A pool file is
+deleted only once no distribution lists it, and the space this frees is
+reported per distribution. Pool files no distribution listed to begin with
+are only deleted with --orphans.
+
+--explain prints, for every distribution entry and every pool file no
+distribution lists, whether it is kept and which rule decided it.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		cfg := repo.DefaultConfig()
-		r := repo.New(repoRoot, cfg)
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
 
 		result, err := r.Prune(repo.PruneOptions{
 			KeepVersions: keepVersions,
 			DryRun:       pruneDryRun,
+			Orphans:      pruneOrphans,
 		})
 		if err != nil {
 			return fmt.Errorf("prune: %w", err)
@@ -31,8 +46,33 @@ var pruneCmd = &cobra.Command{
 			fmt.Println("Dry run - no files deleted")
 		}
 
+		if pruneExplain {
+			for _, d := range result.Decisions {
+				action, dist := "drop", d.Dist
+				if dist == "" {
+					action, dist = "delete", "(pool)"
+				}
+				if d.Keep {
+					action = "keep"
+				}
+				fmt.Printf("%-6s %-10s %s\n", action, dist, d.Path)
+				if d.Rule != "" {
+					fmt.Printf("       %s: %s\n", d.Rule, strings.Join(d.Reasons, "; "))
+				} else {
+					fmt.Printf("       %s\n", strings.Join(d.Reasons, "; "))
+				}
+			}
+			fmt.Println()
+		}
+
+		for _, dist := range r.Config.Distributions {
+			if removed := result.Removed[dist]; len(removed) > 0 {
+				fmt.Printf("%s: dropped %d version(s), reclaimed %s\n",
+					dist, len(removed), repo.FormatSize(result.Reclaimed[dist]))
+			}
+		}
 		fmt.Printf("Kept: %d packages\n", len(result.Kept))
-		fmt.Printf("Deleted: %d packages\n", len(result.Deleted))
+		fmt.Printf("Deleted: %d packages (%s)\n", len(result.Deleted), repo.FormatSize(result.Bytes))
 
 		if len(result.Deleted) > 0 {
 			fmt.Println("\nDeleted packages:")
@@ -41,11 +81,34 @@ var pruneCmd = &cobra.Command{
 			}
 		}
 
+		if pruneDryRun {
+			return nil
+		}
+
+		// Distributions that dropped versions need new indexes to stay
+		// consistent with their manifests and the pool.
+		for _, dist := range result.Dists {
+			if err := r.GeneratePackagesIndex(dist); err != nil {
+				return fmt.Errorf("generate packages index: %w", err)
+			}
+			if err := r.GenerateRelease(dist); err != nil {
+				return fmt.Errorf("generate release: %w", err)
+			}
+			fmt.Printf("Updated Packages and Release for %s\n", dist)
+		}
+		if len(result.Dists) > 0 {
+			if err := r.GenerateHTMLIndexes(); err != nil {
+				return fmt.Errorf("generate HTML indexes: %w", err)
+			}
+		}
+
 		return nil
 	},
 }
 
 func init() {
 	pruneCmd.Flags().BoolVarP(&pruneDryRun, "dry-run", "n", false, "Show what would be deleted without deleting")
+	pruneCmd.Flags().BoolVar(&pruneExplain, "explain", false, "Print which rule kept or deleted each file")
+	pruneCmd.Flags().BoolVar(&pruneOrphans, "orphans", false, "Also delete pool files no distribution lists")
 	rootCmd.AddCommand(pruneCmd)
 }
@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/frostyard/plow/internal/gpg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	refreshDists  []string
+	refreshWithin time.Duration
+	refreshSigner signerFlags
+)
+
+var refreshCmd = &cobra.Command{
+	Use:   "refresh",
+	Short: "Re-date and re-sign Release files before they expire",
+	Long: `Regenerates the Release file of every distribution with a valid_for setting
+whose Valid-Until falls within the given window, then signs it again. Index
+files are left untouched. Run it on a schedule so clients never see an expired
+Release.
+
+A signed Release whose signatures are out of date, because the Release changed
+since it was signed or the signing_keys schedule started or retired a key, is
+signed again without being re-dated. Keys that expire within key_expiry_warning are
+reported, and with --fail-expiring refused.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
+
+		dists := refreshDists
+		if len(dists) == 0 {
+			dists = r.Config.Distributions
+		}
+
+		// The key is loaded even if nothing needs signing, so that the
+		// scheduled run reports keys about to expire
+		signer, err := refreshSigner.scheduledSigner(r.Config, false)
+		if err != nil {
+			return err
+		}
+		publicKey, err := refreshSigner.checkExpiry(signer, r.Config.KeyExpiryWarning)
+		if err != nil {
+			return err
+		}
+
+		for _, dist := range dists {
+			distDir := filepath.Join(repoRoot, "dists", dist)
+			refreshed, err := r.RefreshRelease(dist, refreshWithin)
+			if err != nil {
+				return fmt.Errorf("refresh %s: %w", dist, err)
+			}
+			if !refreshed {
+				// Unsigned Releases are left to plow sign
+				if _, err := os.Stat(filepath.Join(distDir, "InRelease")); os.IsNotExist(err) {
+					fmt.Printf("%s: Release is still valid\n", dist)
+					continue
+				}
+				current, err := r.ReleaseSigned(dist)
+				if err != nil {
+					return err
+				}
+				if current {
+					if current, err = signedByKeys(distDir, publicKey); err != nil {
+						return fmt.Errorf("check signatures of %s: %w", dist, err)
+					}
+				}
+				if current {
+					fmt.Printf("%s: Release is still valid\n", dist)
+					continue
+				}
+				if err := gpg.SignRelease(signer, distDir); err != nil {
+					return fmt.Errorf("sign release for %s: %w", dist, err)
+				}
+				fmt.Printf("%s: Release signed again\n", dist)
+				continue
+			}
+
+			if err := gpg.SignRelease(signer, distDir); err != nil {
+				return fmt.Errorf("sign release for %s: %w", dist, err)
+			}
+
+			validUntil, err := r.ReleaseValidUntil(dist)
+			if err != nil {
+				return err
+			}
+			if validUntil.IsZero() {
+				fmt.Printf("%s: Release regenerated without Valid-Until and signed\n", dist)
+			} else {
+				fmt.Printf("%s: Release refreshed and signed, valid until %s\n", dist, validUntil.Format(time.RFC3339))
+			}
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	refreshCmd.Flags().StringSliceVarP(&refreshDists, "dist", "d", nil, "Distribution to refresh (default: all)")
+	refreshCmd.Flags().DurationVar(&refreshWithin, "within", 72*time.Hour, "Refresh Releases that expire within this period")
+	refreshSigner.register(refreshCmd)
+	refreshSigner.registerExpiry(refreshCmd)
+	rootCmd.AddCommand(refreshCmd)
+}
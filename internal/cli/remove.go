@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/frostyard/plow/internal/repo"
+	"github.com/spf13/cobra"
+)
+
+var (
+	removeVersion string
+	removeArch    string
+	removeDists   []string
+	removeForce   bool
+	removeDryRun  bool
+)
+
+var removeCmd = &cobra.Command{
+	Use:   "remove <package>",
+	Short: "Remove a package from the repository",
+	Long: `Removes a package from one or more distributions. Pool files are deleted once
+no distribution references them, and the indexes of every affected distribution
+are regenerated. Without --dist the package is removed from all distributions.
+
+Removal is refused if other packages in a distribution depend on the package;
+use --force to remove it anyway.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
+
+		result, err := r.Remove(repo.RemoveOptions{
+			Name:         args[0],
+			Version:      removeVersion,
+			Architecture: removeArch,
+			Dists:        removeDists,
+			Force:        removeForce,
+			DryRun:       removeDryRun,
+		})
+		if err != nil {
+			return fmt.Errorf("remove: %w", err)
+		}
+
+		if removeDryRun {
+			fmt.Println("Dry run - no changes made")
+		}
+
+		for _, d := range result.Dependents {
+			fmt.Printf("Warning: still required by %s\n", d)
+		}
+
+		dists := make([]string, 0, len(result.Removed))
+		for dist := range result.Removed {
+			dists = append(dists, dist)
+		}
+		sort.Strings(dists)
+
+		for _, dist := range dists {
+			for _, e := range result.Removed[dist] {
+				fmt.Printf("Removed from %s: %s %s (%s)\n", dist, e.Name, e.Version, e.Architecture)
+			}
+		}
+		for _, f := range result.Deleted {
+			fmt.Printf("Deleted: %s\n", f)
+		}
+
+		if removeDryRun {
+			return nil
+		}
+
+		if len(dists) > 0 {
+			fmt.Printf("  Updated Packages and Release for %v\n", dists)
+		}
+
+		if err := r.GenerateHTMLIndexes(); err != nil {
+			return fmt.Errorf("generate HTML indexes: %w", err)
+		}
+		fmt.Println("  Generated HTML index pages")
+
+		return nil
+	},
+}
+
+func init() {
+	removeCmd.Flags().StringVar(&removeVersion, "version", "", "Only remove this version (default: all versions)")
+	removeCmd.Flags().StringVar(&removeArch, "arch", "", "Only remove this architecture (default: all architectures)")
+	removeCmd.Flags().StringSliceVarP(&removeDists, "dist", "d", nil, "Distribution to remove from (repeatable, default: all)")
+	removeCmd.Flags().BoolVarP(&removeForce, "force", "f", false, "Remove even if other packages depend on it")
+	removeCmd.Flags().BoolVarP(&removeDryRun, "dry-run", "n", false, "Show what would be removed without changing anything")
+	rootCmd.AddCommand(removeCmd)
+}
@@ -1,11 +1,16 @@
 package cli
 
 import (
+	"os"
+	"path/filepath"
+
+	"github.com/frostyard/plow/internal/repo"
 	"github.com/spf13/cobra"
 )
 
 var (
 	repoRoot     string
+	configPath   string
 	keepVersions int
 )
 
@@ -19,10 +24,42 @@ var rootCmd = &cobra.Command{
 	Long: `Plow is a tool for managing Debian package repositories.
 
 It handles adding packages, generating repository metadata (Packages, Release),
-signing with GPG, and pruning old package versions.`,
+signing with GPG, and pruning old package versions.
+
+Repository settings are read from plow.yaml in the repository root. Without
+one, the built-in defaults are used; see 'plow config show'.`,
 }
 
 func init() {
 	rootCmd.PersistentFlags().StringVarP(&repoRoot, "repo-root", "r", ".", "Path to repository root")
+	rootCmd.PersistentFlags().StringVarP(&configPath, "config", "c", "", "Path to configuration file (default <repo-root>/plow.yaml)")
 	rootCmd.PersistentFlags().IntVar(&keepVersions, "keep-versions", 5, "Number of versions to keep per package when pruning")
 }
+
+// loadConfig returns the repository configuration and the file it was read
+// from. A missing plow.yaml in the repository root selects the defaults and
+// an empty path; a missing --config file is an error.
+func loadConfig() (repo.Config, string, error) {
+	path := configPath
+	if path == "" {
+		path = filepath.Join(repoRoot, repo.ConfigFile)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return repo.DefaultConfig(), "", nil
+		}
+	}
+
+	cfg, err := repo.LoadConfig(path)
+	if err != nil {
+		return repo.Config{}, "", err
+	}
+	return cfg, path, nil
+}
+
+// openRepository returns the repository at --repo-root with its configuration.
+func openRepository() (*repo.Repository, error) {
+	cfg, _, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	return repo.New(repoRoot, cfg), nil
+}
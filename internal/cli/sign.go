@@ -2,26 +2,235 @@ package cli
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/frostyard/plow/internal/gpg"
+	"github.com/frostyard/plow/internal/repo"
 	"github.com/spf13/cobra"
 )
 
 var (
-	signDist  string
-	signKeyID string
+	signDist   string
+	signForce  bool
+	signSigner signerFlags
 )
 
+// Signing backends selectable with --backend.
+const (
+	backendGPG    = "gpg"
+	backendNative = "native"
+	backendRemote = "remote"
+)
+
+// signerFlags holds the flags that select a signing backend and keys.
+type signerFlags struct {
+	backend      string
+	keyIDs       []string
+	keyFile      string
+	url          string
+	failExpiring bool
+}
+
+// register adds the signer flags to a command.
+func (f *signerFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.backend, "backend", backendGPG, "Signing backend: gpg (the gpg keyring), native (built-in OpenPGP) or remote (a signing service)")
+	cmd.Flags().StringSliceVarP(&f.keyIDs, "key", "k", nil, "Key ID or fingerprint to sign with, or for the remote backend the fingerprint the service must sign with; repeat for several keys (default: the signing_keys schedule)")
+	cmd.Flags().StringVar(&f.keyFile, "key-file", "", "Armored private key for the native backend, - for stdin (default $"+gpg.PrivateKeyEnv+")")
+	cmd.Flags().StringVar(&f.url, "signer-url", "", "Signing service URL for the remote backend (default $"+gpg.SignerURLEnv+")")
+}
+
+// registerExpiry adds the flag that turns key expiry warnings into errors.
+func (f *signerFlags) registerExpiry(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&f.failExpiring, "fail-expiring", false, "Fail instead of warning when a signing key expires within key_expiry_warning")
+}
+
+// signer returns the signer for the selected backend and the keys given
+// with --key.
+func (f *signerFlags) signer() (gpg.Signer, error) {
+	return f.newSigner(f.keyIDs)
+}
+
+// scheduledSigner returns the signer for the selected backend. Without
+// --key, the gpg and native backends use the keys of the repository's
+// rotation schedule: the keys that sign today, or with publish the keys
+// whose public keys are exported today. The remote backend accepts any key
+// exported today, since the signing service chooses among them.
+func (f *signerFlags) scheduledSigner(cfg repo.Config, publish bool) (gpg.Signer, error) {
+	if len(f.keyIDs) > 0 || len(cfg.SigningKeys) == 0 {
+		return f.signer()
+	}
+
+	now := time.Now().UTC()
+	keys := cfg.SigningKeysAt(now)
+	if publish || f.backend == backendRemote {
+		keys = cfg.PublishedKeysAt(now)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no key in signing_keys is in use on %s", now.Format(time.DateOnly))
+	}
+	return f.newSigner(keys)
+}
+
+// newSigner returns a signer that signs with every key in keyIDs, or with
+// the backend's default key if there are none. The gpg backend uses keys
+// from the user's keyring; the native backend loads them from --key-file,
+// or PLOW_SIGNING_KEY, which may hold several keys. Both read the
+// passphrase from GPG_PASSPHRASE. The remote backend sends Releases to the
+// signing service at --signer-url, or PLOW_SIGNER_URL, authenticating with
+// PLOW_SIGNER_TOKEN; the service chooses among the keys in keyIDs, which
+// must be full fingerprints.
+func (f *signerFlags) newSigner(keyIDs []string) (gpg.Signer, error) {
+	if f.keyFile != "" && f.backend != backendNative {
+		return nil, fmt.Errorf("--key-file requires --backend %s", backendNative)
+	}
+	if f.url != "" && f.backend != backendRemote {
+		return nil, fmt.Errorf("--signer-url requires --backend %s", backendRemote)
+	}
+
+	switch f.backend {
+	case backendGPG:
+		if len(keyIDs) == 0 {
+			return gpg.NewGPGSigner(""), nil
+		}
+		var signers []gpg.Signer
+		for _, id := range keyIDs {
+			signers = append(signers, gpg.NewGPGSigner(id))
+		}
+		return gpg.NewSigner(signers...), nil
+	case backendNative:
+		key, err := gpg.ReadPrivateKey(f.keyFile)
+		if err != nil {
+			return nil, err
+		}
+		passphrase := os.Getenv("GPG_PASSPHRASE")
+		if len(keyIDs) == 0 {
+			return gpg.NewNativeSigner(key, "", passphrase)
+		}
+		var signers []gpg.Signer
+		for _, id := range keyIDs {
+			s, err := gpg.NewNativeSigner(key, id, passphrase)
+			if err != nil {
+				return nil, err
+			}
+			signers = append(signers, s)
+		}
+		return gpg.NewSigner(signers...), nil
+	case backendRemote:
+		if len(keyIDs) == 0 {
+			return nil, fmt.Errorf("--backend %s needs the fingerprints of the service's keys: configure signing_keys or use --key", backendRemote)
+		}
+		url := f.url
+		if url == "" {
+			url = os.Getenv(gpg.SignerURLEnv)
+		}
+		if url == "" {
+			return nil, fmt.Errorf("no signing service: use --signer-url or set %s", gpg.SignerURLEnv)
+		}
+		return gpg.NewRemoteSigner(url, os.Getenv(gpg.SignerTokenEnv), keyIDs), nil
+	default:
+		return nil, fmt.Errorf("unknown signing backend %q (want %s, %s or %s)", f.backend, backendGPG, backendNative, backendRemote)
+	}
+}
+
+// checkExpiry warns about the signer's keys and subkeys that expire within
+// the given period, and with --fail-expiring returns an error instead. It
+// returns the signer's public key.
+func (f *signerFlags) checkExpiry(signer gpg.Signer, within time.Duration) ([]byte, error) {
+	publicKey, err := signer.PublicKey()
+	if err != nil {
+		return nil, fmt.Errorf("load public key: %w", err)
+	}
+	expiring, err := gpg.ExpiringKeys(publicKey, time.Now(), within)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range expiring {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", k)
+	}
+	if f.failExpiring && len(expiring) > 0 {
+		return nil, fmt.Errorf("%d signing key(s) expire within %s; rotate the key (see signing_keys)", len(expiring), formatDays(within))
+	}
+	return publicKey, nil
+}
+
+// formatDays formats a period in whole days where possible.
+func formatDays(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%d days", d/(24*time.Hour))
+	}
+	return d.String()
+}
+
+// signedByKeys reports whether the InRelease of a distribution carries one
+// signature by each key in publicKey and no others. A missing InRelease is
+// not signed.
+func signedByKeys(distDir string, publicKey []byte) (bool, error) {
+	inline, err := os.ReadFile(filepath.Join(distDir, "InRelease"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return gpg.SignedByKeys(publicKey, inline)
+}
+
 var signCmd = &cobra.Command{
 	Use:   "sign",
 	Short: "Sign the repository Release file",
-	Long:  `Signs the Release file, creating Release.gpg (detached) and InRelease (inline).`,
+	Long: `Signs the Release file, creating Release.gpg (detached) and InRelease (inline).
+
+Signatures are kept when InRelease already carries the current Release
+content, signed by the current keys, so re-running a publish on an unchanged
+repository does not produce new signature files. Use --force to sign anyway.
+
+Without --key, the keys of the signing_keys schedule in plow.yaml that are in
+use today sign; with several keys the Release carries a signature by each.
+Keys that expire within key_expiry_warning are reported, and with
+--fail-expiring refused.
+
+The gpg backend signs with the gpg binary and its keyring. The native backend
+needs neither: it loads an exported private key from --key-file, or from the
+PLOW_SIGNING_KEY environment variable, which may also hold it base64-encoded.
+Both read the key's passphrase from GPG_PASSPHRASE. The remote backend keeps
+the key off this machine: it sends the Release to a signing service, such as
+'plow signer serve', and checks the signatures it returns. The service's key
+must be one of the signing_keys, or of the fingerprints given with --key.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
 		distDir := filepath.Join(repoRoot, "dists", signDist)
 
-		signer := gpg.NewSigner(signKeyID)
-		if err := signer.SignRelease(distDir); err != nil {
+		signer, err := signSigner.scheduledSigner(r.Config, false)
+		if err != nil {
+			return err
+		}
+		publicKey, err := signSigner.checkExpiry(signer, r.Config.KeyExpiryWarning)
+		if err != nil {
+			return err
+		}
+
+		if !signForce {
+			signed, err := r.ReleaseSigned(signDist)
+			if err != nil {
+				return err
+			}
+			if signed {
+				if signed, err = signedByKeys(distDir, publicKey); err != nil {
+					return err
+				}
+			}
+			if signed {
+				fmt.Printf("Release for %s is unchanged, keeping its signatures\n", signDist)
+				return nil
+			}
+		}
+
+		if err := gpg.SignRelease(signer, distDir); err != nil {
 			return fmt.Errorf("sign release: %w", err)
 		}
 
@@ -35,6 +244,8 @@ var signCmd = &cobra.Command{
 
 func init() {
 	signCmd.Flags().StringVarP(&signDist, "dist", "d", "stable", "Distribution to sign")
-	signCmd.Flags().StringVarP(&signKeyID, "key", "k", "", "GPG key ID to use for signing")
+	signSigner.register(signCmd)
+	signSigner.registerExpiry(signCmd)
+	signCmd.Flags().BoolVar(&signForce, "force", false, "Sign even if the existing signatures cover the current Release")
 	rootCmd.AddCommand(signCmd)
 }
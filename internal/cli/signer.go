@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/frostyard/plow/internal/gpg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	signerServeListen  string
+	signerServeTLSCert string
+	signerServeTLSKey  string
+	signerServeSigner  signerFlags
+)
+
+var signerCmd = &cobra.Command{
+	Use:   "signer",
+	Short: "Run a signing service",
+	Long: `A signing service holds the signing key so that the machines publishing the
+repository never see it; they sign with 'plow sign --backend remote'. The
+protocol is documented in docs/signing-service.md.`,
+}
+
+var signerServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the reference signing service",
+	Long: `Serves the signing service protocol, signing with the gpg or native backend.
+It is a reference implementation for testing and small setups.
+
+If PLOW_SIGNER_TOKEN is set, clients must send it as a bearer token. Without
+--tls-cert and --tls-key the service speaks plain HTTP and should only listen
+on a trusted network or behind a TLS-terminating proxy.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if signerServeSigner.backend == backendRemote {
+			return fmt.Errorf("the signing service cannot use --backend %s", backendRemote)
+		}
+		signer, err := signerServeSigner.signer()
+		if err != nil {
+			return err
+		}
+		if _, err := signer.PublicKey(); err != nil {
+			return fmt.Errorf("load public key: %w", err)
+		}
+
+		token := os.Getenv(gpg.SignerTokenEnv)
+		if token == "" {
+			log.Printf("warning: %s is not set, any client can request signatures", gpg.SignerTokenEnv)
+		}
+
+		server := &http.Server{
+			Addr:              signerServeListen,
+			Handler:           gpg.NewSigningHandler(signer, token),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		log.Printf("signing service listening on %s", signerServeListen)
+		if signerServeTLSCert != "" || signerServeTLSKey != "" {
+			return server.ListenAndServeTLS(signerServeTLSCert, signerServeTLSKey)
+		}
+		return server.ListenAndServe()
+	},
+}
+
+func init() {
+	signerServeSigner.register(signerServeCmd)
+	signerServeCmd.Flags().StringVar(&signerServeListen, "listen", "127.0.0.1:8080", "Address to listen on")
+	signerServeCmd.Flags().StringVar(&signerServeTLSCert, "tls-cert", "", "TLS certificate file")
+	signerServeCmd.Flags().StringVar(&signerServeTLSKey, "tls-key", "", "TLS private key file")
+	signerCmd.AddCommand(signerServeCmd)
+	rootCmd.AddCommand(signerCmd)
+}
@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/frostyard/plow/internal/repo"
+	"github.com/spf13/cobra"
+)
+
+var (
+	verifyJSON           bool
+	verifyPublicKey      string
+	verifySkipSignatures bool
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check the repository for consistency",
+	Long: `Checks that the repository on disk is what clients expect: every file listed in
+each Release exists with the listed checksums, compressed indices match their
+uncompressed form, every Packages entry matches its pool file, and InRelease
+and Release.gpg are valid signatures by public.key. Pool files that no index
+refers to are reported as warnings.
+
+Exits with a non-zero status if any error is found. With --json, the full
+report is written to standard output as JSON.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
+
+		report, err := r.Verify(repo.VerifyOptions{
+			PublicKey:      verifyPublicKey,
+			SkipSignatures: verifySkipSignatures,
+		})
+		if err != nil {
+			return fmt.Errorf("verify: %w", err)
+		}
+
+		if verifyJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(report); err != nil {
+				return err
+			}
+		} else {
+			fmt.Printf("Checked: %d distribution(s), %d index file(s), %d package entries, %d pool file(s)\n",
+				len(report.Dists), report.IndexFiles, report.Packages, report.PoolFiles)
+			for _, p := range report.Problems {
+				fmt.Printf("  %s: %s: %s: %s\n", p.Severity, p.Check, p.Path, p.Message)
+			}
+		}
+
+		if !report.OK {
+			cmd.SilenceUsage = true
+			return fmt.Errorf("repository verification failed with %d error(s)", report.Errors())
+		}
+		if !verifyJSON {
+			fmt.Println("Repository is consistent")
+		}
+		return nil
+	},
+}
+
+func init() {
+	verifyCmd.Flags().BoolVar(&verifyJSON, "json", false, "Write the report as JSON")
+	verifyCmd.Flags().StringVar(&verifyPublicKey, "public-key", "", "Public key to check signatures against (default <repo-root>/public.key)")
+	verifyCmd.Flags().BoolVar(&verifySkipSignatures, "skip-signatures", false, "Do not check InRelease and Release.gpg")
+	rootCmd.AddCommand(verifyCmd)
+}
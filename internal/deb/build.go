@@ -0,0 +1,187 @@
+package deb
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blakesmith/ar"
+)
+
+// File is a regular file installed by a package built with Build.
+type File struct {
+	Path     string // Absolute installation path, such as /usr/share/keyrings/foo.gpg
+	Mode     int64
+	Data     []byte
+	Conffile bool // Listed in conffiles, so local changes survive upgrades
+}
+
+// Build writes a binary package with the given control fields and files.
+// Installed-Size is computed, and the md5sums and conffiles control files
+// are generated. Every archive member gets modTime and root ownership, so
+// the same input always produces the same bytes.
+func Build(w io.Writer, control *Stanza, files []File, modTime time.Time) error {
+	files = append([]File(nil), files...)
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	modTime = modTime.UTC().Truncate(time.Second)
+	var installedSize int64
+	var md5sums, conffiles strings.Builder
+	data := newTarGz()
+	dirs := make(map[string]bool)
+	for _, f := range files {
+		name := path.Clean(f.Path)
+		if !path.IsAbs(name) || name == "/" {
+			return fmt.Errorf("invalid file path %q", f.Path)
+		}
+
+		// Parent directories come first, each once
+		var parents []string
+		for dir := path.Dir(name); dir != "/" && !dirs[dir]; dir = path.Dir(dir) {
+			parents = append(parents, dir)
+			dirs[dir] = true
+		}
+		if !dirs["/"] {
+			parents = append(parents, "/")
+			dirs["/"] = true
+		}
+		for i := len(parents) - 1; i >= 0; i-- {
+			if err := data.add("."+strings.TrimSuffix(parents[i], "/")+"/", 0755, nil, modTime); err != nil {
+				return err
+			}
+			if parents[i] != "/" {
+				installedSize++
+			}
+		}
+
+		if err := data.add("."+name, f.Mode, f.Data, modTime); err != nil {
+			return err
+		}
+		installedSize += (int64(len(f.Data)) + 1023) / 1024
+		sum := md5.Sum(f.Data)
+		fmt.Fprintf(&md5sums, "%s  %s\n", hex.EncodeToString(sum[:]), strings.TrimPrefix(name, "/"))
+		if f.Conffile {
+			conffiles.WriteString(name + "\n")
+		}
+	}
+	dataTar, err := data.close()
+	if err != nil {
+		return err
+	}
+
+	control = control.Clone()
+	control.Set("Installed-Size", strconv.FormatInt(installedSize, 10))
+	ctrl := newTarGz()
+	if err := ctrl.add("./", 0755, nil, modTime); err != nil {
+		return err
+	}
+	members := []struct {
+		name string
+		data string
+	}{
+		{"conffiles", conffiles.String()},
+		{"control", control.reorder(controlFieldOrder).String()},
+		{"md5sums", md5sums.String()},
+	}
+	for _, m := range members {
+		if m.data == "" {
+			continue
+		}
+		if err := ctrl.add("./"+m.name, 0644, []byte(m.data), modTime); err != nil {
+			return err
+		}
+	}
+	controlTar, err := ctrl.close()
+	if err != nil {
+		return err
+	}
+
+	aw := ar.NewWriter(w)
+	if err := aw.WriteGlobalHeader(); err != nil {
+		return fmt.Errorf("write ar header: %w", err)
+	}
+	for _, m := range []struct {
+		name string
+		data []byte
+	}{
+		{"debian-binary", []byte("2.0\n")},
+		{"control.tar.gz", controlTar},
+		{"data.tar.gz", dataTar},
+	} {
+		hdr := &ar.Header{Name: m.name, ModTime: modTime, Mode: 0644, Size: int64(len(m.data))}
+		if err := aw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("write %s: %w", m.name, err)
+		}
+		if _, err := aw.Write(m.data); err != nil {
+			return fmt.Errorf("write %s: %w", m.name, err)
+		}
+	}
+	return nil
+}
+
+// controlFieldOrder is the order dpkg-gencontrol writes binary control
+// fields in.
+var controlFieldOrder = []string{
+	"Package", "Source", "Version", "Architecture", "Maintainer",
+	"Installed-Size", "Pre-Depends", "Depends", "Recommends", "Suggests",
+	"Breaks", "Conflicts", "Provides", "Replaces", "Section", "Priority",
+	"Multi-Arch", "Homepage", "Description",
+}
+
+// tarGz builds a gzip-compressed tar archive with root-owned entries.
+type tarGz struct {
+	buf bytes.Buffer
+	gz  *gzip.Writer
+	tw  *tar.Writer
+}
+
+func newTarGz() *tarGz {
+	t := &tarGz{}
+	t.gz, _ = gzip.NewWriterLevel(&t.buf, gzip.BestCompression)
+	t.tw = tar.NewWriter(t.gz)
+	return t
+}
+
+// add writes a file, or a directory if name ends with a slash.
+func (t *tarGz) add(name string, mode int64, data []byte, modTime time.Time) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    mode,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+		Uname:   "root",
+		Gname:   "root",
+		Format:  tar.FormatGNU,
+	}
+	if strings.HasSuffix(name, "/") {
+		hdr.Typeflag = tar.TypeDir
+	} else {
+		hdr.Typeflag = tar.TypeReg
+	}
+	if err := t.tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("write tar header %s: %w", name, err)
+	}
+	if _, err := t.tw.Write(data); err != nil {
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+	return nil
+}
+
+func (t *tarGz) close() ([]byte, error) {
+	if err := t.tw.Close(); err != nil {
+		return nil, fmt.Errorf("close tar: %w", err)
+	}
+	if err := t.gz.Close(); err != nil {
+		return nil, fmt.Errorf("close gzip: %w", err)
+	}
+	return t.buf.Bytes(), nil
+}
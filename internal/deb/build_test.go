@@ -0,0 +1,63 @@
+package deb
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuild(t *testing.T) {
+	control := &Stanza{}
+	control.Set("Package", "acme-archive-keyring")
+	control.Set("Version", "2")
+	control.Set("Architecture", "all")
+	control.Set("Maintainer", "Acme")
+	control.Set("Description", "Acme keys\n Keys of the Acme repository.")
+	files := []File{
+		{Path: "/usr/share/keyrings/acme-archive-keyring.gpg", Mode: 0644, Data: bytes.Repeat([]byte{1}, 2000)},
+		{Path: "/etc/apt/sources.list.d/acme.sources", Mode: 0644, Data: []byte("Types: deb\n"), Conffile: true},
+	}
+	modTime := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	if err := Build(&buf, control, files, modTime); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "acme-archive-keyring_2_all.deb")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pkg, err := Parse(path)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if pkg.Name != "acme-archive-keyring" || pkg.Version != "2" || pkg.Architecture != "all" {
+		t.Errorf("package = %s %s %s", pkg.Name, pkg.Version, pkg.Architecture)
+	}
+	// One block per directory below the root, and each file rounded up
+	if pkg.InstalledSize != 6+2+1 {
+		t.Errorf("Installed-Size = %d, want 9", pkg.InstalledSize)
+	}
+
+	got, err := ListFiles(path)
+	if err != nil {
+		t.Fatalf("ListFiles: %v", err)
+	}
+	want := []string{"etc/apt/sources.list.d/acme.sources", "usr/share/keyrings/acme-archive-keyring.gpg"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+
+	// The same input gives the same bytes
+	var again bytes.Buffer
+	if err := Build(&again, control, files, modTime); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), again.Bytes()) {
+		t.Error("Build is not reproducible")
+	}
+}
@@ -0,0 +1,202 @@
+package deb
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Field is a single field of a control stanza.
+// Multi-line values keep their continuation lines, including the leading
+// whitespace, separated by newlines.
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Stanza is a deb822 paragraph: an ordered list of fields with
+// case-insensitive names. Field order and the original spelling of names
+// are preserved.
+type Stanza struct {
+	fields []Field
+}
+
+// packagesFieldOrder is the order dpkg-scanpackages writes fields to a
+// Packages index. Fields not listed follow in their original order.
+var packagesFieldOrder = []string{
+	"Package", "Package-Type", "Source", "Version", "Kernel-Version",
+	"Built-For-Profiles", "Auto-Built-Package", "Architecture",
+	"Subarchitecture", "Installer-Menu-Item", "Build-Essential", "Essential",
+	"Protected", "Origin", "Bugs", "Maintainer", "Installed-Size",
+	"Pre-Depends", "Depends", "Recommends", "Suggests", "Enhances",
+	"Conflicts", "Breaks", "Replaces", "Provides", "Built-Using",
+	"Static-Built-Using", "Filename", "Size", "MD5sum", "SHA1", "SHA256",
+	"Section", "Priority", "Multi-Arch", "Homepage", "Description", "Tag",
+	"Task",
+}
+
+// Get returns the value of the named field, or "" if it is not present.
+func (s *Stanza) Get(name string) string {
+	v, _ := s.Lookup(name)
+	return v
+}
+
+// Lookup returns the value of the named field and whether it is present.
+func (s *Stanza) Lookup(name string) (string, bool) {
+	if i := s.index(name); i >= 0 {
+		return s.fields[i].Value, true
+	}
+	return "", false
+}
+
+// Set replaces the value of the named field, keeping its position, or
+// appends the field if it is not present.
+func (s *Stanza) Set(name, value string) {
+	if i := s.index(name); i >= 0 {
+		s.fields[i].Value = value
+		return
+	}
+	s.fields = append(s.fields, Field{Name: name, Value: value})
+}
+
+// Delete removes the named field if present.
+func (s *Stanza) Delete(name string) {
+	if i := s.index(name); i >= 0 {
+		s.fields = append(s.fields[:i], s.fields[i+1:]...)
+	}
+}
+
+// Fields returns a copy of the stanza's fields in order.
+func (s *Stanza) Fields() []Field {
+	return append([]Field(nil), s.fields...)
+}
+
+// Len returns the number of fields in the stanza.
+func (s *Stanza) Len() int {
+	return len(s.fields)
+}
+
+// Clone returns a deep copy of the stanza.
+func (s *Stanza) Clone() *Stanza {
+	return &Stanza{fields: s.Fields()}
+}
+
+func (s *Stanza) index(name string) int {
+	for i, f := range s.fields {
+		if strings.EqualFold(f.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// reorder returns a copy of the stanza with the fields named in order first,
+// in that order, followed by the remaining fields in their original order.
+func (s *Stanza) reorder(order []string) *Stanza {
+	out := &Stanza{}
+	used := make([]bool, len(s.fields))
+	for _, name := range order {
+		if i := s.index(name); i >= 0 {
+			out.fields = append(out.fields, s.fields[i])
+			used[i] = true
+		}
+	}
+	for i, f := range s.fields {
+		if !used[i] {
+			out.fields = append(out.fields, f)
+		}
+	}
+	return out
+}
+
+// String returns the stanza in control file format, without a trailing
+// blank line.
+func (s *Stanza) String() string {
+	var b strings.Builder
+	for _, f := range s.fields {
+		b.WriteString(f.Name)
+		b.WriteString(":")
+		if f.Value != "" && !strings.HasPrefix(f.Value, "\n") {
+			b.WriteString(" ")
+		}
+		b.WriteString(f.Value)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// ParseStanza parses a single control stanza.
+func ParseStanza(data []byte) (*Stanza, error) {
+	stanzas, err := ParseStanzas(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	switch len(stanzas) {
+	case 0:
+		return &Stanza{}, nil
+	case 1:
+		return stanzas[0], nil
+	default:
+		return nil, fmt.Errorf("expected one stanza, found %d", len(stanzas))
+	}
+}
+
+// ParseStanzas parses a sequence of blank-line separated stanzas, such as a
+// Packages index.
+func ParseStanzas(r io.Reader) ([]*Stanza, error) {
+	var stanzas []*Stanza
+	var cur *Stanza
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		lineNo++
+
+		if strings.TrimSpace(line) == "" {
+			cur = nil
+			continue
+		}
+		if line[0] == '#' {
+			continue
+		}
+
+		// Continuation line (starts with space or tab)
+		if line[0] == ' ' || line[0] == '\t' {
+			if cur == nil || len(cur.fields) == 0 {
+				return nil, fmt.Errorf("line %d: continuation line without a field", lineNo)
+			}
+			last := &cur.fields[len(cur.fields)-1]
+			last.Value += "\n" + line
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("line %d: malformed field %q", lineNo, line)
+		}
+		if cur == nil {
+			cur = &Stanza{}
+			stanzas = append(stanzas, cur)
+		}
+		if cur.index(name) >= 0 {
+			return nil, fmt.Errorf("line %d: duplicate field %s", lineNo, name)
+		}
+		cur.fields = append(cur.fields, Field{Name: name, Value: strings.TrimSpace(value)})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read stanza: %w", err)
+	}
+
+	// Trailing whitespace on the last continuation line is not significant.
+	for _, s := range stanzas {
+		for i := range s.fields {
+			s.fields[i].Value = strings.TrimRight(s.fields[i].Value, " \t\n")
+		}
+	}
+
+	return stanzas, nil
+}
@@ -0,0 +1,126 @@
+package deb
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testControl = `Package: myapp
+Version: 1.0-1
+Architecture: amd64
+Maintainer: Test <test@example.com>
+Multi-Arch: foreign
+X-Custom-Field: kept
+Breaks: oldapp (<< 1.0)
+Description: short summary
+ Long description line one.
+ .
+ Line two.
+`
+
+func TestParseStanza(t *testing.T) {
+	s, err := ParseStanza([]byte(testControl))
+	if err != nil {
+		t.Fatalf("ParseStanza: %v", err)
+	}
+
+	if s.Len() != 8 {
+		t.Errorf("Len() = %d, want 8", s.Len())
+	}
+	if got := s.Get("multi-arch"); got != "foreign" {
+		t.Errorf("Get(multi-arch) = %q, want %q", got, "foreign")
+	}
+	if got := s.Get("X-CUSTOM-FIELD"); got != "kept" {
+		t.Errorf("Get(X-CUSTOM-FIELD) = %q, want %q", got, "kept")
+	}
+	if _, ok := s.Lookup("Enhances"); ok {
+		t.Error("Lookup(Enhances) found a missing field")
+	}
+
+	want := "short summary\n Long description line one.\n .\n Line two."
+	if got := s.Get("Description"); got != want {
+		t.Errorf("Description = %q, want %q", got, want)
+	}
+
+	if got := s.String(); got != testControl {
+		t.Errorf("String() did not round-trip:\n%s", got)
+	}
+}
+
+func TestParseStanzaErrors(t *testing.T) {
+	tests := map[string]string{
+		"duplicate":    "Package: a\npackage: b\n",
+		"continuation": " orphan line\n",
+		"no colon":     "Package a\n",
+		"two stanzas":  "Package: a\n\nPackage: b\n",
+	}
+
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseStanza([]byte(input)); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestParseStanzas(t *testing.T) {
+	input := "Package: a\nVersion: 1\n\n\nPackage: b\nVersion: 2\n"
+	stanzas, err := ParseStanzas(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseStanzas: %v", err)
+	}
+	if len(stanzas) != 2 {
+		t.Fatalf("got %d stanzas, want 2", len(stanzas))
+	}
+	if stanzas[1].Get("Package") != "b" {
+		t.Errorf("second stanza Package = %q", stanzas[1].Get("Package"))
+	}
+}
+
+func TestStanzaSetDelete(t *testing.T) {
+	s := &Stanza{}
+	s.Set("Package", "a")
+	s.Set("Version", "1")
+	s.Set("package", "b")
+	s.Delete("VERSION")
+
+	if got := s.String(); got != "Package: b\n" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestPackageStanzaKeepsAllFields(t *testing.T) {
+	pkg, err := ParseControl([]byte(testControl))
+	if err != nil {
+		t.Fatalf("ParseControl: %v", err)
+	}
+	pkg.Filename = "pool/main/m/myapp/myapp_1.0-1_amd64.deb"
+	pkg.Size = 1024
+	pkg.SHA256 = "abc"
+
+	var names []string
+	for _, f := range pkg.Stanza().Fields() {
+		names = append(names, f.Name)
+	}
+
+	want := []string{
+		"Package", "Version", "Architecture", "Maintainer", "Breaks",
+		"Filename", "Size", "SHA256", "Multi-Arch", "Description",
+		"X-Custom-Field",
+	}
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Errorf("field order = %v, want %v", names, want)
+	}
+}
+
+func TestParseFixtureKeepsMultiArch(t *testing.T) {
+	pkg, err := Parse(filepath.Join("testdata", "hello-gzip.deb"))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if !containsLine(pkg.ControlString(), "Multi-Arch: foreign") {
+		t.Errorf("ControlString() missing Multi-Arch:\n%s", pkg.ControlString())
+	}
+}
@@ -3,7 +3,7 @@ package deb
 
 import (
 	"archive/tar"
-	"bufio"
+	"compress/bzip2"
 	"compress/gzip"
 	"crypto/md5"
 	"crypto/sha1"
@@ -12,12 +12,15 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
 
 	"github.com/blakesmith/ar"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
 )
 
 // Package represents metadata extracted from a .deb file.
@@ -43,6 +46,7 @@ type Package struct {
 	MD5sum        string
 	SHA1          string
 	SHA256        string
+	Control       *Stanza // Every field of the control file, in original order
 }
 
 // Parse reads a .deb file and extracts its metadata.
@@ -89,7 +93,7 @@ func Parse(path string) (*Package, error) {
 
 		name := strings.TrimSuffix(header.Name, "/")
 
-		// Look for control.tar.gz, control.tar.xz, or control.tar.zst
+		// Look for control.tar, control.tar.gz, control.tar.xz, or control.tar.zst
 		if strings.HasPrefix(name, "control.tar") {
 			controlData, err = extractControl(arReader, name)
 			if err != nil {
@@ -103,7 +107,7 @@ func Parse(path string) (*Package, error) {
 		return nil, fmt.Errorf("control file not found in deb")
 	}
 
-	pkg, err := parseControl(controlData)
+	pkg, err := ParseControl(controlData)
 	if err != nil {
 		return nil, fmt.Errorf("parse control: %w", err)
 	}
@@ -117,36 +121,50 @@ func Parse(path string) (*Package, error) {
 }
 
 func extractControl(r io.Reader, archiveName string) ([]byte, error) {
-	var tarReader *tar.Reader
+	dr, err := decompress(r, archiveName)
+	if err != nil {
+		return nil, err
+	}
+	defer dr.Close() //nolint:errcheck // Decompression complete, close error is not critical
+
+	return findControlInTar(tar.NewReader(dr))
+}
 
+// decompress wraps r in a decompressor chosen by the ar member's extension.
+// Members without a known compression suffix are returned as-is.
+func decompress(r io.Reader, memberName string) (io.ReadCloser, error) {
 	switch {
-	case strings.HasSuffix(archiveName, ".gz"):
+	case strings.HasSuffix(memberName, ".gz"):
 		gzr, err := gzip.NewReader(r)
 		if err != nil {
 			return nil, fmt.Errorf("open gzip: %w", err)
 		}
-		defer gzr.Close() //nolint:errcheck // Decompression complete, close error is not critical
-		tarReader = tar.NewReader(gzr)
-	case strings.HasSuffix(archiveName, ".xz"):
-		// For xz, we'll shell out since Go doesn't have native xz support
-		// Read all data first
-		data, err := io.ReadAll(r)
+		return gzr, nil
+	case strings.HasSuffix(memberName, ".xz"):
+		xzr, err := xz.NewReader(r)
 		if err != nil {
-			return nil, fmt.Errorf("read xz data: %w", err)
+			return nil, fmt.Errorf("open xz: %w", err)
 		}
-		return extractControlFromXz(data)
-	case strings.HasSuffix(archiveName, ".zst"):
-		data, err := io.ReadAll(r)
+		return io.NopCloser(xzr), nil
+	case strings.HasSuffix(memberName, ".zst"):
+		zr, err := zstd.NewReader(r)
 		if err != nil {
-			return nil, fmt.Errorf("read zst data: %w", err)
+			return nil, fmt.Errorf("open zstd: %w", err)
 		}
-		return extractControlFromZstd(data)
+		return zr.IOReadCloser(), nil
+	case strings.HasSuffix(memberName, ".bz2"):
+		return io.NopCloser(bzip2.NewReader(r)), nil
+	case strings.HasSuffix(memberName, ".lzma"):
+		lr, err := lzma.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("open lzma: %w", err)
+		}
+		return io.NopCloser(lr), nil
+	case strings.HasSuffix(memberName, ".tar"):
+		return io.NopCloser(r), nil
 	default:
-		// Assume uncompressed tar
-		tarReader = tar.NewReader(r)
+		return nil, fmt.Errorf("unsupported compression for %s", memberName)
 	}
-
-	return findControlInTar(tarReader)
 }
 
 func findControlInTar(tarReader *tar.Reader) ([]byte, error) {
@@ -167,126 +185,102 @@ func findControlInTar(tarReader *tar.Reader) ([]byte, error) {
 	return nil, fmt.Errorf("control file not found in tar")
 }
 
-func extractControlFromXz(data []byte) ([]byte, error) {
-	// Write to temp file and use xz command
-	tmpFile, err := os.CreateTemp("", "control.tar.xz")
+// WalkData calls fn for every entry of the data.tar member of a .deb file.
+// The reader passed to fn yields the entry's contents and is only valid
+// until fn returns.
+func WalkData(path string, fn func(hdr *tar.Header, r io.Reader) error) error {
+	f, err := os.Open(path)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("open deb: %w", err)
 	}
-	tmpName := tmpFile.Name()
-	defer os.Remove(tmpName) //nolint:errcheck // Best effort cleanup
+	defer f.Close() //nolint:errcheck // Read-only file, close error is not critical
 
-	if _, err := tmpFile.Write(data); err != nil {
-		_ = tmpFile.Close()
-		return nil, err
-	}
-	if err := tmpFile.Close(); err != nil {
-		return nil, err
-	}
+	arReader := ar.NewReader(f)
+	for {
+		header, err := arReader.Next()
+		if err == io.EOF {
+			return fmt.Errorf("data archive not found in deb")
+		}
+		if err != nil {
+			return fmt.Errorf("read ar: %w", err)
+		}
 
-	return extractControlWithCmd("xz", []string{"-dk", "-c", tmpName})
-}
+		name := strings.TrimSuffix(header.Name, "/")
+		if !strings.HasPrefix(name, "data.tar") {
+			continue
+		}
 
-func extractControlFromZstd(data []byte) ([]byte, error) {
-	tmpFile, err := os.CreateTemp("", "control.tar.zst")
-	if err != nil {
-		return nil, err
-	}
-	tmpName := tmpFile.Name()
-	defer os.Remove(tmpName) //nolint:errcheck // Best effort cleanup
+		dr, err := decompress(arReader, name)
+		if err != nil {
+			return err
+		}
+		defer dr.Close() //nolint:errcheck // Decompression complete, close error is not critical
 
-	if _, err := tmpFile.Write(data); err != nil {
-		_ = tmpFile.Close()
-		return nil, err
-	}
-	if err := tmpFile.Close(); err != nil {
-		return nil, err
+		tarReader := tar.NewReader(dr)
+		for {
+			hdr, err := tarReader.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("read data tar: %w", err)
+			}
+			if err := fn(hdr, tarReader); err != nil {
+				return err
+			}
+		}
 	}
-
-	return extractControlWithCmd("zstd", []string{"-d", "-c", tmpName})
 }
 
-func extractControlWithCmd(cmd string, args []string) ([]byte, error) {
-	// Import os/exec at runtime equivalent - use shell
-	// This is a simplified version; in practice we'd use os/exec
-	// For now, focus on gzip which is most common
-	return nil, fmt.Errorf("xz/zstd decompression not implemented - use gzip")
-}
-
-func parseControl(data []byte) (*Package, error) {
-	pkg := &Package{}
-	scanner := bufio.NewScanner(strings.NewReader(string(data)))
-
-	var currentField string
-	var currentValue strings.Builder
-
-	saveField := func() {
-		if currentField == "" {
-			return
+// ListFiles returns the paths of the files a .deb installs, relative to the
+// filesystem root and without a leading "./". Directories are omitted.
+func ListFiles(debPath string) ([]string, error) {
+	var files []string
+	err := WalkData(debPath, func(hdr *tar.Header, _ io.Reader) error {
+		if hdr.Typeflag == tar.TypeDir {
+			return nil
 		}
-		value := strings.TrimSpace(currentValue.String())
-		switch currentField {
-		case "Package":
-			pkg.Name = value
-		case "Version":
-			pkg.Version = value
-		case "Architecture":
-			pkg.Architecture = value
-		case "Maintainer":
-			pkg.Maintainer = value
-		case "Description":
-			pkg.Description = value
-		case "Depends":
-			pkg.Depends = value
-		case "Pre-Depends":
-			pkg.PreDepends = value
-		case "Recommends":
-			pkg.Recommends = value
-		case "Suggests":
-			pkg.Suggests = value
-		case "Conflicts":
-			pkg.Conflicts = value
-		case "Provides":
-			pkg.Provides = value
-		case "Replaces":
-			pkg.Replaces = value
-		case "Section":
-			pkg.Section = value
-		case "Priority":
-			pkg.Priority = value
-		case "Homepage":
-			pkg.Homepage = value
-		case "Installed-Size":
-			if size, err := strconv.ParseInt(value, 10, 64); err == nil {
-				pkg.InstalledSize = size
-			}
+		name := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		if name != "" {
+			files = append(files, name)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return files, nil
+}
 
-	for scanner.Scan() {
-		line := scanner.Text()
-
-		// Continuation line (starts with space or tab)
-		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
-			currentValue.WriteString("\n")
-			currentValue.WriteString(line)
-			continue
-		}
-
-		// New field
-		saveField()
-
-		if idx := strings.Index(line, ":"); idx > 0 {
-			currentField = line[:idx]
-			currentValue.Reset()
-			if idx+1 < len(line) {
-				currentValue.WriteString(strings.TrimSpace(line[idx+1:]))
-			}
-		}
+// ParseControl builds a Package from the contents of a control file. Pool
+// location, size and checksums are left empty.
+func ParseControl(data []byte) (*Package, error) {
+	control, err := ParseStanza(data)
+	if err != nil {
+		return nil, err
 	}
 
-	// Save last field
-	saveField()
+	pkg := &Package{
+		Name:         control.Get("Package"),
+		Version:      control.Get("Version"),
+		Architecture: control.Get("Architecture"),
+		Maintainer:   control.Get("Maintainer"),
+		Description:  control.Get("Description"),
+		Depends:      control.Get("Depends"),
+		PreDepends:   control.Get("Pre-Depends"),
+		Recommends:   control.Get("Recommends"),
+		Suggests:     control.Get("Suggests"),
+		Conflicts:    control.Get("Conflicts"),
+		Provides:     control.Get("Provides"),
+		Replaces:     control.Get("Replaces"),
+		Section:      control.Get("Section"),
+		Priority:     control.Get("Priority"),
+		Homepage:     control.Get("Homepage"),
+		Control:      control,
+	}
+	if size, err := strconv.ParseInt(control.Get("Installed-Size"), 10, 64); err == nil {
+		pkg.InstalledSize = size
+	}
 
 	if pkg.Name == "" {
 		return nil, fmt.Errorf("missing Package field")
@@ -301,78 +295,74 @@ func parseControl(data []byte) (*Package, error) {
 	return pkg, nil
 }
 
-// ControlString returns the package in Packages file format.
-func (p *Package) ControlString() string {
-	var b strings.Builder
+// Stanza returns the package's Packages index entry: every field of the
+// control file plus the pool location and checksums, in the order
+// dpkg-scanpackages uses. Values set on the struct take precedence over
+// those read from the control file.
+func (p *Package) Stanza() *Stanza {
+	s := &Stanza{}
+	if p.Control != nil {
+		s = p.Control.Clone()
+	}
 
-	writeField := func(name, value string) {
+	setField := func(name, value string) {
 		if value != "" {
-			b.WriteString(name)
-			b.WriteString(": ")
-			b.WriteString(value)
-			b.WriteString("\n")
+			s.Set(name, value)
 		}
 	}
 
-	writeField("Package", p.Name)
-	writeField("Version", p.Version)
-	writeField("Architecture", p.Architecture)
-	writeField("Maintainer", p.Maintainer)
+	setField("Package", p.Name)
+	setField("Version", p.Version)
+	setField("Architecture", p.Architecture)
+	setField("Maintainer", p.Maintainer)
 	if p.InstalledSize > 0 {
-		writeField("Installed-Size", strconv.FormatInt(p.InstalledSize, 10))
+		setField("Installed-Size", strconv.FormatInt(p.InstalledSize, 10))
 	}
-	writeField("Pre-Depends", p.PreDepends)
-	writeField("Depends", p.Depends)
-	writeField("Recommends", p.Recommends)
-	writeField("Suggests", p.Suggests)
-	writeField("Conflicts", p.Conflicts)
-	writeField("Provides", p.Provides)
-	writeField("Replaces", p.Replaces)
-	writeField("Section", p.Section)
-	writeField("Priority", p.Priority)
-	writeField("Homepage", p.Homepage)
-	writeField("Filename", p.Filename)
-	writeField("Size", strconv.FormatInt(p.Size, 10))
-	writeField("MD5sum", p.MD5sum)
-	writeField("SHA1", p.SHA1)
-	writeField("SHA256", p.SHA256)
-	writeField("Description", p.Description)
-
-	return b.String()
+	setField("Pre-Depends", p.PreDepends)
+	setField("Depends", p.Depends)
+	setField("Recommends", p.Recommends)
+	setField("Suggests", p.Suggests)
+	setField("Conflicts", p.Conflicts)
+	setField("Provides", p.Provides)
+	setField("Replaces", p.Replaces)
+	setField("Section", p.Section)
+	setField("Priority", p.Priority)
+	setField("Homepage", p.Homepage)
+	setField("Description", p.Description)
+
+	// Index fields describe the pool file, not the package contents
+	setField("Filename", p.Filename)
+	s.Set("Size", strconv.FormatInt(p.Size, 10))
+	setField("MD5sum", p.MD5sum)
+	setField("SHA1", p.SHA1)
+	setField("SHA256", p.SHA256)
+
+	return s.reorder(packagesFieldOrder)
+}
+
+// ControlString returns the package in Packages file format.
+func (p *Package) ControlString() string {
+	return p.Stanza().String()
 }
 
 // PoolPath returns the relative path where this package should be stored in the pool.
-// Format: pool/main/<first-letter>/<package-name>/<filename>
-// For lib* packages: pool/main/lib<x>/<package-name>/<filename>
-func (p *Package) PoolPath(filename string) string {
+// Format: pool/<component>/<first-letter>/<package-name>/<filename>
+// For lib* packages: pool/<component>/lib<x>/<package-name>/<filename>
+func (p *Package) PoolPath(component, filename string) string {
 	var prefix string
 	if strings.HasPrefix(p.Name, "lib") && len(p.Name) > 3 {
 		prefix = p.Name[:4] // e.g., "liba", "libc"
 	} else {
 		prefix = p.Name[:1]
 	}
-	return filepath.Join("pool", "main", prefix, p.Name, filename)
+	return filepath.Join("pool", component, prefix, p.Name, filename)
 }
 
-// DebFilename returns the standard .deb filename for this package.
+// DebFilename returns the standard .deb filename for this package:
+// name_version_arch.deb with the epoch left out, as dpkg names them. Colons
+// are not allowed in file names on some filesystems and must be escaped in
+// URLs.
 func (p *Package) DebFilename() string {
-	return fmt.Sprintf("%s_%s_%s.deb", p.Name, p.Version, p.Architecture)
-}
-
-// epoch:upstream-revision version parsing
-var versionRegex = regexp.MustCompile(`^(?:(\d+):)?([^-]+)(?:-(.+))?$`)
-
-// ParseVersion parses a Debian version string into its components.
-func ParseVersion(version string) (epoch int, upstream, revision string) {
-	matches := versionRegex.FindStringSubmatch(version)
-	if matches == nil {
-		return 0, version, ""
-	}
-
-	if matches[1] != "" {
-		epoch, _ = strconv.Atoi(matches[1])
-	}
-	upstream = matches[2]
-	revision = matches[3]
-	return
+	version := p.Version[strings.Index(p.Version, ":")+1:]
+	return fmt.Sprintf("%s_%s_%s.deb", p.Name, version, p.Architecture)
 }
@@ -1,25 +1,97 @@
 package deb
 
-import "testing"
+import (
+	"archive/tar"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseCompression(t *testing.T) {
+	for _, comp := range []string{"gzip", "xz", "zstd", "none"} {
+		t.Run(comp, func(t *testing.T) {
+			pkg, err := Parse(filepath.Join("testdata", "hello-"+comp+".deb"))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if pkg.Name != "hello-"+comp {
+				t.Errorf("Name = %q, want %q", pkg.Name, "hello-"+comp)
+			}
+			if pkg.Version != "1.0-1" {
+				t.Errorf("Version = %q, want %q", pkg.Version, "1.0-1")
+			}
+			if pkg.Architecture != "amd64" {
+				t.Errorf("Architecture = %q, want %q", pkg.Architecture, "amd64")
+			}
+			if pkg.Depends != "libc6 (>= 2.34)" {
+				t.Errorf("Depends = %q, want %q", pkg.Depends, "libc6 (>= 2.34)")
+			}
+			if pkg.Size == 0 || pkg.SHA256 == "" {
+				t.Error("missing size or checksum")
+			}
+		})
+	}
+}
+
+func TestWalkData(t *testing.T) {
+	for _, comp := range []string{"gzip", "xz", "zstd", "none"} {
+		t.Run(comp, func(t *testing.T) {
+			var script string
+			err := WalkData(filepath.Join("testdata", "hello-"+comp+".deb"), func(hdr *tar.Header, r io.Reader) error {
+				if hdr.Name == "./usr/bin/hello" {
+					data, err := io.ReadAll(r)
+					script = string(data)
+					return err
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("WalkData: %v", err)
+			}
+			if script != "#!/bin/sh\necho hello\n" {
+				t.Errorf("usr/bin/hello = %q", script)
+			}
+		})
+	}
+}
+
+func TestListFiles(t *testing.T) {
+	files, err := ListFiles(filepath.Join("testdata", "hello-xz.deb"))
+	if err != nil {
+		t.Fatalf("ListFiles: %v", err)
+	}
+
+	want := []string{"usr/bin/hello", "usr/share/doc/hello/README"}
+	if len(files) != len(want) {
+		t.Fatalf("ListFiles() = %v, want %v", files, want)
+	}
+	for i := range want {
+		if files[i] != want[i] {
+			t.Errorf("files[%d] = %q, want %q", i, files[i], want[i])
+		}
+	}
+}
 
 func TestPackagePoolPath(t *testing.T) {
 	tests := []struct {
-		name     string
-		filename string
-		expected string
+		name      string
+		component string
+		filename  string
+		expected  string
 	}{
-		{"myapp", "myapp_1.0.0_amd64.deb", "pool/main/m/myapp/myapp_1.0.0_amd64.deb"},
-		{"libc", "libc_1.0.0_amd64.deb", "pool/main/libc/libc/libc_1.0.0_amd64.deb"},
-		{"libfoo", "libfoo_1.0.0_amd64.deb", "pool/main/libf/libfoo/libfoo_1.0.0_amd64.deb"},
-		{"apache2", "apache2_2.4.0_amd64.deb", "pool/main/a/apache2/apache2_2.4.0_amd64.deb"},
+		{"myapp", "main", "myapp_1.0.0_amd64.deb", "pool/main/m/myapp/myapp_1.0.0_amd64.deb"},
+		{"libc", "main", "libc_1.0.0_amd64.deb", "pool/main/libc/libc/libc_1.0.0_amd64.deb"},
+		{"libfoo", "main", "libfoo_1.0.0_amd64.deb", "pool/main/libf/libfoo/libfoo_1.0.0_amd64.deb"},
+		{"apache2", "main", "apache2_2.4.0_amd64.deb", "pool/main/a/apache2/apache2_2.4.0_amd64.deb"},
+		{"firmware-acme", "non-free", "firmware-acme_1.0_all.deb", "pool/non-free/f/firmware-acme/firmware-acme_1.0_all.deb"},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			pkg := &Package{Name: tc.name}
-			result := pkg.PoolPath(tc.filename)
+			result := pkg.PoolPath(tc.component, tc.filename)
 			if result != tc.expected {
-				t.Errorf("PoolPath(%q) = %q, want %q", tc.filename, result, tc.expected)
+				t.Errorf("PoolPath(%q, %q) = %q, want %q", tc.component, tc.filename, result, tc.expected)
 			}
 		})
 	}
@@ -36,6 +108,13 @@ func TestPackageDebFilename(t *testing.T) {
 	if result := pkg.DebFilename(); result != expected {
 		t.Errorf("DebFilename() = %q, want %q", result, expected)
 	}
+
+	// The epoch is left out of file names
+	pkg.Version = "2:1.0.0-1"
+	expected = "myapp_1.0.0-1_amd64.deb"
+	if result := pkg.DebFilename(); result != expected {
+		t.Errorf("DebFilename() = %q, want %q", result, expected)
+	}
 }
 
 func TestPackageControlString(t *testing.T) {
@@ -73,6 +152,19 @@ func TestPackageControlString(t *testing.T) {
 	}
 }
 
+func TestParseControlInvalidVersion(t *testing.T) {
+	// Versions are checked when packages are added, not whenever a pool file
+	// is read, so files from before the check can still be indexed
+	control := []byte("Package: myapp\nVersion: 1.0_beta\nArchitecture: amd64\n")
+	pkg, err := ParseControl(control)
+	if err != nil {
+		t.Fatalf("ParseControl() error = %v", err)
+	}
+	if pkg.Version != "1.0_beta" {
+		t.Errorf("Version = %q, want 1.0_beta", pkg.Version)
+	}
+}
+
 func containsLine(s, substr string) bool {
 	for _, line := range splitLines(s) {
 		if line == substr {
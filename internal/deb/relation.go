@@ -0,0 +1,317 @@
+package deb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Relation is a single package relationship, such as
+// "libc6:any (>= 2.34) [amd64 arm64] <!nocheck>".
+type Relation struct {
+	Name          string
+	ArchQualifier string            // Multiarch qualifier after ':', e.g. "any" or "native"
+	Operator      string            // One of <<, <=, =, >=, >> (or the obsolete < and >); empty if unversioned
+	Version       string            // Version the operator applies to
+	Architectures []ArchRestriction // Restriction list in [...]; empty means all architectures
+	Profiles      [][]BuildProfile  // Each <...> group is a conjunction; the groups are alternatives
+}
+
+// ArchRestriction is one entry of a relation's architecture list.
+type ArchRestriction struct {
+	Arch    string
+	Negated bool // Written as !arch
+}
+
+// BuildProfile is one term of a build profile restriction.
+type BuildProfile struct {
+	Name    string
+	Negated bool // Written as !profile
+}
+
+// Alternatives is a list of relations separated by '|', any one of which
+// satisfies the requirement.
+type Alternatives []Relation
+
+// Relations is a parsed relationship field: a comma-separated list of
+// requirements that must all be satisfied.
+type Relations []Alternatives
+
+var relationOperators = []string{"<<", "<=", ">=", ">>", "=", "<", ">"}
+
+// ParseRelations parses a relationship field such as Depends or Conflicts.
+// An empty field yields no relations.
+func ParseRelations(field string) (Relations, error) {
+	var rels Relations
+	for _, clause := range strings.Split(field, ",") {
+		// Tolerate empty entries such as the trailing comma left by
+		// substitution variables.
+		if strings.TrimSpace(clause) == "" {
+			continue
+		}
+
+		var alts Alternatives
+		for _, part := range strings.Split(clause, "|") {
+			rel, err := ParseRelation(part)
+			if err != nil {
+				return nil, err
+			}
+			alts = append(alts, rel)
+		}
+		rels = append(rels, alts)
+	}
+	return rels, nil
+}
+
+// ParseRelation parses a single relation without alternatives.
+func ParseRelation(s string) (Relation, error) {
+	var rel Relation
+	p := &relationParser{s: s}
+
+	p.skipSpace()
+	rel.Name = p.takeWhile(isPackageNameChar)
+	if rel.Name == "" {
+		return rel, fmt.Errorf("missing package name in relation %q", strings.TrimSpace(s))
+	}
+	if p.peek() == ':' {
+		p.pos++
+		rel.ArchQualifier = p.takeWhile(isArchChar)
+		if rel.ArchQualifier == "" {
+			return rel, fmt.Errorf("empty architecture qualifier in relation %q", strings.TrimSpace(s))
+		}
+	}
+
+	p.skipSpace()
+	if p.peek() == '(' {
+		p.pos++
+		p.skipSpace()
+		for _, op := range relationOperators {
+			if strings.HasPrefix(p.s[p.pos:], op) {
+				rel.Operator = op
+				p.pos += len(op)
+				break
+			}
+		}
+		if rel.Operator == "" {
+			return rel, fmt.Errorf("missing version operator in relation %q", strings.TrimSpace(s))
+		}
+		p.skipSpace()
+		rel.Version = p.takeWhile(func(c byte) bool { return c != ')' && c != ' ' && c != '\t' })
+		if rel.Version == "" {
+			return rel, fmt.Errorf("missing version in relation %q", strings.TrimSpace(s))
+		}
+		p.skipSpace()
+		if p.peek() != ')' {
+			return rel, fmt.Errorf("unterminated version constraint in relation %q", strings.TrimSpace(s))
+		}
+		p.pos++
+	}
+
+	p.skipSpace()
+	if p.peek() == '[' {
+		p.pos++
+		list, err := p.restrictionList(']')
+		if err != nil {
+			return rel, fmt.Errorf("%w in relation %q", err, strings.TrimSpace(s))
+		}
+		for _, term := range list {
+			rel.Architectures = append(rel.Architectures, ArchRestriction{Arch: term.Name, Negated: term.Negated})
+		}
+	}
+
+	for {
+		p.skipSpace()
+		if p.peek() != '<' {
+			break
+		}
+		p.pos++
+		list, err := p.restrictionList('>')
+		if err != nil {
+			return rel, fmt.Errorf("%w in relation %q", err, strings.TrimSpace(s))
+		}
+		group := make([]BuildProfile, len(list))
+		for i, term := range list {
+			group[i] = BuildProfile{Name: term.Name, Negated: term.Negated}
+		}
+		rel.Profiles = append(rel.Profiles, group)
+	}
+
+	p.skipSpace()
+	if p.pos != len(p.s) {
+		return rel, fmt.Errorf("unexpected %q in relation %q", p.s[p.pos:], strings.TrimSpace(s))
+	}
+	return rel, nil
+}
+
+// String formats the relations in canonical form.
+func (rs Relations) String() string {
+	parts := make([]string, len(rs))
+	for i, alts := range rs {
+		parts[i] = alts.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// String formats the alternatives in canonical form.
+func (a Alternatives) String() string {
+	parts := make([]string, len(a))
+	for i, rel := range a {
+		parts[i] = rel.String()
+	}
+	return strings.Join(parts, " | ")
+}
+
+// String formats the relation in canonical form.
+func (r Relation) String() string {
+	var b strings.Builder
+	b.WriteString(r.Name)
+	if r.ArchQualifier != "" {
+		b.WriteString(":")
+		b.WriteString(r.ArchQualifier)
+	}
+	if r.Operator != "" {
+		fmt.Fprintf(&b, " (%s %s)", r.Operator, r.Version)
+	}
+	if len(r.Architectures) > 0 {
+		archs := make([]string, len(r.Architectures))
+		for i, a := range r.Architectures {
+			archs[i] = negation(a.Negated) + a.Arch
+		}
+		fmt.Fprintf(&b, " [%s]", strings.Join(archs, " "))
+	}
+	for _, group := range r.Profiles {
+		terms := make([]string, len(group))
+		for i, p := range group {
+			terms[i] = negation(p.Negated) + p.Name
+		}
+		fmt.Fprintf(&b, " <%s>", strings.Join(terms, " "))
+	}
+	return b.String()
+}
+
+// Satisfies reports whether version meets the relation's version
+// constraint. Unversioned relations are satisfied by any version.
+func (r Relation) Satisfies(version string) bool {
+	if r.Operator == "" {
+		return true
+	}
+	cmp := Compare(version, r.Version)
+	switch r.Operator {
+	case "<<":
+		return cmp < 0
+	case "<=", "<":
+		return cmp <= 0
+	case "=":
+		return cmp == 0
+	case ">=", ">":
+		return cmp >= 0
+	case ">>":
+		return cmp > 0
+	}
+	return false
+}
+
+// AppliesTo reports whether the relation's architecture restriction list
+// includes arch. Relations without a list apply to every architecture.
+func (r Relation) AppliesTo(arch string) bool {
+	if len(r.Architectures) == 0 {
+		return true
+	}
+	// A list is either all positive or all negated.
+	negated := r.Architectures[0].Negated
+	for _, a := range r.Architectures {
+		if a.Arch == arch {
+			return !negated
+		}
+	}
+	return negated
+}
+
+// Relations parses the named relationship field of the package's control
+// data, for example "Depends" or "Breaks".
+func (p *Package) Relations(field string) (Relations, error) {
+	rels, err := ParseRelations(p.Stanza().Get(field))
+	if err != nil {
+		return nil, fmt.Errorf("parse %s of %s: %w", field, p.Name, err)
+	}
+	return rels, nil
+}
+
+func negation(negated bool) string {
+	if negated {
+		return "!"
+	}
+	return ""
+}
+
+type restrictionTerm struct {
+	Name    string
+	Negated bool
+}
+
+type relationParser struct {
+	s   string
+	pos int
+}
+
+func (p *relationParser) peek() byte {
+	if p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+func (p *relationParser) skipSpace() {
+	for p.pos < len(p.s) && isSpace(p.s[p.pos]) {
+		p.pos++
+	}
+}
+
+func (p *relationParser) takeWhile(fn func(byte) bool) string {
+	start := p.pos
+	for p.pos < len(p.s) && fn(p.s[p.pos]) {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+// restrictionList parses whitespace-separated, optionally negated terms up
+// to the closing delimiter.
+func (p *relationParser) restrictionList(closing byte) ([]restrictionTerm, error) {
+	var terms []restrictionTerm
+	for {
+		p.skipSpace()
+		if p.peek() == closing {
+			p.pos++
+			break
+		}
+		if p.pos >= len(p.s) {
+			return nil, fmt.Errorf("missing %q", closing)
+		}
+		var term restrictionTerm
+		if p.peek() == '!' {
+			term.Negated = true
+			p.pos++
+		}
+		term.Name = p.takeWhile(func(c byte) bool { return !isSpace(c) && c != closing && c != '!' })
+		if term.Name == "" {
+			return nil, fmt.Errorf("empty restriction term")
+		}
+		terms = append(terms, term)
+	}
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("empty restriction list")
+	}
+	return terms, nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+func isPackageNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '+' || c == '-'
+}
+
+func isArchChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-'
+}
@@ -0,0 +1,145 @@
+package deb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRelation(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Relation
+	}{
+		{"libc6", Relation{Name: "libc6"}},
+		{"libc6 (>= 2.34)", Relation{Name: "libc6", Operator: ">=", Version: "2.34"}},
+		{"libc6(<<2.40-1)", Relation{Name: "libc6", Operator: "<<", Version: "2.40-1"}},
+		{"python3:any", Relation{Name: "python3", ArchQualifier: "any"}},
+		{"libfoo:native (= 1:1.0)", Relation{Name: "libfoo", ArchQualifier: "native", Operator: "=", Version: "1:1.0"}},
+		{"foo [amd64 arm64]", Relation{Name: "foo", Architectures: []ArchRestriction{{Arch: "amd64"}, {Arch: "arm64"}}}},
+		{"foo [!i386]", Relation{Name: "foo", Architectures: []ArchRestriction{{Arch: "i386", Negated: true}}}},
+		{"foo <!nocheck>", Relation{Name: "foo", Profiles: [][]BuildProfile{{{Name: "nocheck", Negated: true}}}}},
+		{
+			"foo (>> 1.0) [linux-any] <!nocheck !cross> <stage1>",
+			Relation{
+				Name: "foo", Operator: ">>", Version: "1.0",
+				Architectures: []ArchRestriction{{Arch: "linux-any"}},
+				Profiles: [][]BuildProfile{
+					{{Name: "nocheck", Negated: true}, {Name: "cross", Negated: true}},
+					{{Name: "stage1"}},
+				},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := ParseRelation(tc.input)
+			if err != nil {
+				t.Fatalf("ParseRelation: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ParseRelation(%q) = %+v, want %+v", tc.input, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseRelationErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"(>= 1.0)",
+		"foo (1.0)",
+		"foo (>= )",
+		"foo (>= 1.0",
+		"foo [amd64",
+		"foo []",
+		"foo <>",
+		"foo:",
+		"foo bar",
+	}
+
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			if _, err := ParseRelation(input); err == nil {
+				t.Errorf("ParseRelation(%q) succeeded, want error", input)
+			}
+		})
+	}
+}
+
+func TestParseRelationsRoundTrip(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"", ""},
+		{"libc6 (>= 2.34), libfoo | libbar", "libc6 (>= 2.34), libfoo | libbar"},
+		{"libc6(>=2.34),libfoo|libbar,", "libc6 (>= 2.34), libfoo | libbar"},
+		{"a:any (<< 2) [!i386] <!nocheck>,\n b", "a:any (<< 2) [!i386] <!nocheck>, b"},
+	}
+
+	for _, tc := range tests {
+		rels, err := ParseRelations(tc.input)
+		if err != nil {
+			t.Fatalf("ParseRelations(%q): %v", tc.input, err)
+		}
+		if got := rels.String(); got != tc.want {
+			t.Errorf("ParseRelations(%q).String() = %q, want %q", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestRelationSatisfies(t *testing.T) {
+	tests := []struct {
+		relation string
+		version  string
+		want     bool
+	}{
+		{"foo", "1.0", true},
+		{"foo (<< 2.0)", "1.9", true},
+		{"foo (<< 2.0)", "2.0", false},
+		{"foo (<= 2.0)", "2.0", true},
+		{"foo (= 2.0-1)", "2.0-1", true},
+		{"foo (= 2.0-1)", "2.0-2", false},
+		{"foo (>= 2.0)", "2.0~rc1", false},
+		{"foo (>= 2.0)", "1:1.0", true},
+		{"foo (>> 2.0)", "2.0", false},
+		{"foo (>> 2.0)", "2.0.1", true},
+		{"foo (< 2.0)", "2.0", true},
+		{"foo (> 2.0)", "2.0", true},
+	}
+
+	for _, tc := range tests {
+		rel, err := ParseRelation(tc.relation)
+		if err != nil {
+			t.Fatalf("ParseRelation(%q): %v", tc.relation, err)
+		}
+		if got := rel.Satisfies(tc.version); got != tc.want {
+			t.Errorf("%q.Satisfies(%q) = %v, want %v", tc.relation, tc.version, got, tc.want)
+		}
+	}
+}
+
+func TestRelationAppliesTo(t *testing.T) {
+	tests := []struct {
+		relation string
+		arch     string
+		want     bool
+	}{
+		{"foo", "amd64", true},
+		{"foo [amd64 arm64]", "arm64", true},
+		{"foo [amd64 arm64]", "i386", false},
+		{"foo [!i386]", "amd64", true},
+		{"foo [!i386]", "i386", false},
+	}
+
+	for _, tc := range tests {
+		rel, err := ParseRelation(tc.relation)
+		if err != nil {
+			t.Fatalf("ParseRelation(%q): %v", tc.relation, err)
+		}
+		if got := rel.AppliesTo(tc.arch); got != tc.want {
+			t.Errorf("%q.AppliesTo(%q) = %v, want %v", tc.relation, tc.arch, got, tc.want)
+		}
+	}
+}
@@ -1,33 +1,139 @@
 package deb
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"strconv"
 	"strings"
-	"unicode"
 )
 
-// Compare compares two Debian version strings.
-// Returns -1 if a < b, 0 if a == b, 1 if a > b.
-// Implements the Debian version comparison algorithm.
-func Compare(a, b string) int {
-	epochA, upstreamA, revisionA := ParseVersion(a)
-	epochB, upstreamB, revisionB := ParseVersion(b)
+// Version is a Debian package version: [epoch:]upstream_version[-debian_revision].
+type Version struct {
+	Epoch    int
+	Upstream string
+	Revision string
+}
+
+// ParseVersion parses a Debian version string with the rules dpkg applies:
+// the epoch ends at the first colon, the revision starts after the last
+// hyphen, and the upstream version must start with a digit. Leading and
+// trailing whitespace is ignored. Illegal versions are reported with dpkg's
+// error messages.
+func ParseVersion(s string) (Version, error) {
+	v, err := parseVersion(s)
+	if err != nil {
+		return Version{}, fmt.Errorf("invalid version %q: %w", s, err)
+	}
+	return v, nil
+}
 
-	// Compare epochs
-	if epochA != epochB {
-		if epochA < epochB {
+// parseVersion splits a version into its parts and validates them. Like
+// dpkg, it fills in as much of the result as it could split even when the
+// version is illegal, so versions already in a repository can still be
+// ordered.
+func parseVersion(s string) (Version, error) {
+	var v Version
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return v, errors.New("version string is empty")
+	}
+	if strings.ContainsAny(s, " \t\n\r\v\f") {
+		return v, errors.New("version string has embedded spaces")
+	}
+
+	rest := s
+	if epoch, after, ok := strings.Cut(s, ":"); ok {
+		rest = after
+		if epoch == "" {
+			return v, errors.New("epoch in version is empty")
+		}
+		if !isDigits(strings.TrimPrefix(epoch, "-")) {
+			return v, errors.New("epoch in version is not number")
+		}
+		if strings.HasPrefix(epoch, "-") {
+			return v, errors.New("epoch in version is negative")
+		}
+		n, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil || n > math.MaxInt32 {
+			return v, errors.New("epoch in version is too big")
+		}
+		v.Epoch = int(n)
+		if rest == "" {
+			return v, errors.New("nothing after colon in version number")
+		}
+	}
+
+	v.Upstream = rest
+	if i := strings.LastIndexByte(rest, '-'); i >= 0 {
+		v.Upstream, v.Revision = rest[:i], rest[i+1:]
+		if v.Revision == "" {
+			return v, errors.New("revision number is empty")
+		}
+	}
+	if v.Upstream == "" {
+		return v, errors.New("version number is empty")
+	}
+
+	if !isDigit(v.Upstream[0]) {
+		return v, errors.New("version number does not start with digit")
+	}
+	for i := 0; i < len(v.Upstream); i++ {
+		if c := v.Upstream[i]; !isAlnum(c) && !strings.ContainsRune(".-+~:", rune(c)) {
+			return v, errors.New("invalid character in version number")
+		}
+	}
+	for i := 0; i < len(v.Revision); i++ {
+		if c := v.Revision[i]; !isAlnum(c) && !strings.ContainsRune(".+~", rune(c)) {
+			return v, errors.New("invalid character in revision number")
+		}
+	}
+	return v, nil
+}
+
+// String formats the version. An epoch of 0 is omitted.
+func (v Version) String() string {
+	var b strings.Builder
+	if v.Epoch != 0 {
+		b.WriteString(strconv.Itoa(v.Epoch))
+		b.WriteByte(':')
+	}
+	b.WriteString(v.Upstream)
+	if v.Revision != "" {
+		b.WriteByte('-')
+		b.WriteString(v.Revision)
+	}
+	return b.String()
+}
+
+// Compare returns -1 if v sorts before o, 0 if they are equal, and 1 if v
+// sorts after o, using dpkg's ordering.
+func (v Version) Compare(o Version) int {
+	if v.Epoch != o.Epoch {
+		if v.Epoch < o.Epoch {
 			return -1
 		}
 		return 1
 	}
-
-	// Compare upstream versions
-	if cmp := compareVersionPart(upstreamA, upstreamB); cmp != 0 {
+	if cmp := compareVersionPart(v.Upstream, o.Upstream); cmp != 0 {
 		return cmp
 	}
+	return compareVersionPart(v.Revision, o.Revision)
+}
 
-	// Compare revisions
-	return compareVersionPart(revisionA, revisionB)
+// Less reports whether v sorts before o.
+func (v Version) Less(o Version) bool {
+	return v.Compare(o) < 0
+}
+
+// Compare compares two Debian version strings.
+// Returns -1 if a < b, 0 if a == b, 1 if a > b.
+// Illegal versions are compared by whatever parts could be split off, as
+// dpkg does.
+func Compare(a, b string) int {
+	va, _ := parseVersion(a)
+	vb, _ := parseVersion(b)
+	return va.Compare(vb)
 }
 
 // compareVersionPart compares version parts using Debian's algorithm.
@@ -61,7 +167,7 @@ func compareVersionPart(a, b string) int {
 
 func extractNonDigits(s string) (string, string) {
 	i := 0
-	for i < len(s) && !unicode.IsDigit(rune(s[i])) {
+	for i < len(s) && !isDigit(s[i]) {
 		i++
 	}
 	return s[:i], s[i:]
@@ -69,7 +175,7 @@ func extractNonDigits(s string) (string, string) {
 
 func extractDigits(s string) (string, string) {
 	i := 0
-	for i < len(s) && unicode.IsDigit(rune(s[i])) {
+	for i < len(s) && isDigit(s[i]) {
 		i++
 	}
 	return s[:i], s[i:]
@@ -112,29 +218,35 @@ func charOrder(c byte) int {
 	}
 }
 
-// compareDigits compares digit strings numerically.
+// compareDigits compares digit strings numerically, whatever their length.
 func compareDigits(a, b string) int {
-	// Trim leading zeros for numeric comparison
+	// Without leading zeros, the longer number is the larger one
 	a = strings.TrimLeft(a, "0")
 	b = strings.TrimLeft(b, "0")
-
-	if a == "" {
-		a = "0"
-	}
-	if b == "" {
-		b = "0"
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
 	}
+	return strings.Compare(a, b)
+}
 
-	numA, _ := strconv.ParseInt(a, 10, 64)
-	numB, _ := strconv.ParseInt(b, 10, 64)
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
 
-	if numA < numB {
-		return -1
-	}
-	if numA > numB {
-		return 1
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
 	}
-	return 0
+	return s != ""
+}
+
+func isAlnum(c byte) bool {
+	return isDigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
 }
 
 // SortVersions sorts a slice of version strings in descending order (newest first).
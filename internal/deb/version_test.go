@@ -1,6 +1,9 @@
 package deb
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestCompare(t *testing.T) {
 	tests := []struct {
@@ -68,19 +71,172 @@ func TestParseVersion(t *testing.T) {
 		{"1:1.0", 1, "1.0", ""},
 		{"1:1.0-1", 1, "1.0", "1"},
 		{"2:1.0.0-ubuntu1", 2, "1.0.0", "ubuntu1"},
+		{"1.0-beta-2", 0, "1.0-beta", "2"},
+		{"1:2.0:3-4", 1, "2.0:3", "4"},
+		{" 1.0-1\n", 0, "1.0", "1"},
+		{"0:1.0~rc1+dfsg.1-0ubuntu1~22.04", 0, "1.0~rc1+dfsg.1", "0ubuntu1~22.04"},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.version, func(t *testing.T) {
-			epoch, upstream, revision := ParseVersion(tc.version)
-			if epoch != tc.epoch {
-				t.Errorf("epoch = %d, want %d", epoch, tc.epoch)
+			v, err := ParseVersion(tc.version)
+			if err != nil {
+				t.Fatalf("ParseVersion(%q) error: %v", tc.version, err)
 			}
-			if upstream != tc.upstream {
-				t.Errorf("upstream = %q, want %q", upstream, tc.upstream)
+			if v.Epoch != tc.epoch {
+				t.Errorf("epoch = %d, want %d", v.Epoch, tc.epoch)
 			}
-			if revision != tc.revision {
-				t.Errorf("revision = %q, want %q", revision, tc.revision)
+			if v.Upstream != tc.upstream {
+				t.Errorf("upstream = %q, want %q", v.Upstream, tc.upstream)
+			}
+			if v.Revision != tc.revision {
+				t.Errorf("revision = %q, want %q", v.Revision, tc.revision)
+			}
+		})
+	}
+}
+
+func TestParseVersionInvalid(t *testing.T) {
+	tests := []struct {
+		version string
+		err     string
+	}{
+		{"", "version string is empty"},
+		{"   ", "version string is empty"},
+		{"1.0 1", "version string has embedded spaces"},
+		{":1.0", "epoch in version is empty"},
+		{"a:1.0", "epoch in version is not number"},
+		{"1.0:2", "epoch in version is not number"},
+		{"-1:1.0", "epoch in version is negative"},
+		{"2147483648:1.0", "epoch in version is too big"},
+		{"1:", "nothing after colon in version number"},
+		{"1.0-", "revision number is empty"},
+		{"-1", "version number is empty"},
+		{"1:-1", "version number is empty"},
+		{"foo", "version number does not start with digit"},
+		{"0:foo-1", "version number does not start with digit"},
+		{"1.0_1", "invalid character in version number"},
+		{"1.0-1_1", "invalid character in revision number"},
+		{"1:1.0-1:2", "invalid character in revision number"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.version, func(t *testing.T) {
+			_, err := ParseVersion(tc.version)
+			if err == nil {
+				t.Fatalf("ParseVersion(%q) succeeded, want error", tc.version)
+			}
+			if !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("error = %q, want it to contain %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestVersionString(t *testing.T) {
+	for _, s := range []string{"1.0", "1.0-1", "1:1.0", "2:1.0-beta-2", "1.0~rc1+dfsg-0ubuntu1"} {
+		v, err := ParseVersion(s)
+		if err != nil {
+			t.Fatalf("ParseVersion(%q) error: %v", s, err)
+		}
+		if got := v.String(); got != s {
+			t.Errorf("String() = %q, want %q", got, s)
+		}
+	}
+	if got := (Version{Epoch: 0, Upstream: "1.0"}).String(); got != "1.0" {
+		t.Errorf("String() = %q, want %q", got, "1.0")
+	}
+}
+
+// dpkgVersionCases are the comparison cases from dpkg's t/Dpkg_Version.t.
+var dpkgVersionCases = []struct {
+	a, b     string
+	expected int
+}{
+	{"1.0-1", "2.0-2", -1},
+	{"2.2~rc-4", "2.2-1", -1},
+	{"2.2-1", "2.2~rc-4", 1},
+	{"1.0000-1", "1.0-1", 0},
+	{"1", "0:1", 0},
+	{"0", "0:0-0", 0},
+	{"2:2.5", "1:7.5", 1},
+	{"1:0foo", "0foo", 1},
+	{"0:0foo", "0foo", 0},
+	{"0foo", "0foo", 0},
+	{"0foo-0", "0foo", 0},
+	{"0foo", "0foo-0", 0},
+	{"0foo", "0fo", 1},
+	{"0foo-0", "0foo+", -1},
+	{"0foo~1", "0foo", -1},
+	{"0foo~foo+Bar", "0foo~foo+bar", -1},
+	{"0foo~~", "0foo~", -1},
+	{"1~", "1", -1},
+	{"12345+that-really-is-some-ver-0", "12345+that-really-is-some-ver-10", -1},
+	{"0foo-0", "0foo-01", -1},
+	{"0foo.bar", "0foobar", 1},
+	{"0foo.bar", "0foo1bar", 1},
+	{"0foo.bar", "0foo0bar", 1},
+	{"0foo1bar-1", "0foobar-1", -1},
+	{"0foo2.0", "0foo2", 1},
+	{"0foo2.0.0", "0foo2.10.0", -1},
+	{"0foo2.0", "0foo2.0.0", -1},
+	{"0foo2.0", "0foo2.10", -1},
+	{"0foo2.1", "0foo2.10", -1},
+	{"1.09", "1.9", 0},
+	{"1.0.8+nmu1", "1.0.8", 1},
+	{"3.11", "3.10+nmu1", 1},
+	{"0.9j-20080306-4", "0.9i-20070324-2", 1},
+	{"1.2.0~b7-1", "1.2.0~b6-1", 1},
+	{"1.011-1", "1.06-2", 1},
+	{"0.0.9+dfsg1-1", "0.0.8+dfsg1-3", 1},
+	{"4.6.99+svn6582-1", "4.6.99+svn6496-1", 1},
+	{"53", "52", 1},
+	{"0.9.9~pre122-1", "0.9.9~pre111-1", 1},
+	{"2:2.3.2-2+lenny2", "2:2.3.2-2", 1},
+	{"1:3.8.1-1", "3.8.GA-1", 1},
+	{"1.0.1+gpl-1", "1:1.0-1", -1},
+	{"1a", "1000a", -1},
+}
+
+func TestVersionCompareDpkg(t *testing.T) {
+	for _, tc := range dpkgVersionCases {
+		t.Run(tc.a+"_vs_"+tc.b, func(t *testing.T) {
+			a, err := ParseVersion(tc.a)
+			if err != nil {
+				t.Fatalf("ParseVersion(%q) error: %v", tc.a, err)
+			}
+			b, err := ParseVersion(tc.b)
+			if err != nil {
+				t.Fatalf("ParseVersion(%q) error: %v", tc.b, err)
+			}
+			if got := a.Compare(b); got != tc.expected {
+				t.Errorf("Compare(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.expected)
+			}
+			if got := b.Compare(a); got != -tc.expected {
+				t.Errorf("Compare(%q, %q) = %d, want %d", tc.b, tc.a, got, -tc.expected)
+			}
+			if got := a.Less(b); got != (tc.expected < 0) {
+				t.Errorf("Less(%q, %q) = %v, want %v", tc.a, tc.b, got, tc.expected < 0)
+			}
+		})
+	}
+}
+
+func TestCompareLongNumbers(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.20260101000000000000", "1.20260101000000000001", -1},
+		{"1.99999999999999999999", "1.100000000000000000000", -1},
+		{"99999999999999999999999", "9999999999999999999", 1},
+		{"1.000000000000000000000000001", "1.1", 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.a+"_vs_"+tc.b, func(t *testing.T) {
+			if got := Compare(tc.a, tc.b); got != tc.expected {
+				t.Errorf("Compare(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.expected)
 			}
 		})
 	}
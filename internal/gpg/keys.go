@@ -0,0 +1,171 @@
+package gpg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// Keyring returns the signer's public keys as a binary keyring, the format
+// apt expects in /usr/share/keyrings.
+func Keyring(s Signer) ([]byte, error) {
+	key, err := s.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	keyring, err := dearmor(key, openpgp.PublicKeyType)
+	if err != nil {
+		return nil, fmt.Errorf("read public key: %w", err)
+	}
+	return keyring, nil
+}
+
+// ExportKeyring writes the signer's public keys as a binary keyring.
+func ExportKeyring(s Signer, outputPath string) error {
+	keyring, err := Keyring(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outputPath, keyring, 0644)
+}
+
+// KeyExpiry describes a key that expires soon or has expired.
+type KeyExpiry struct {
+	Fingerprint string    // Fingerprint of the primary key
+	Subkey      string    // Fingerprint of the signing subkey, if it is the one expiring
+	Expires     time.Time // When the key expires
+}
+
+func (k KeyExpiry) String() string {
+	what := "signing key " + k.Fingerprint
+	if k.Subkey != "" {
+		what = "signing subkey " + k.Subkey + " of key " + k.Fingerprint
+	}
+	date := k.Expires.UTC().Format(time.DateOnly)
+	if days := int(time.Until(k.Expires).Hours() / 24); k.Expires.After(time.Now()) {
+		return fmt.Sprintf("%s expires on %s, in %d days", what, date, days)
+	}
+	return fmt.Sprintf("%s expired on %s", what, date)
+}
+
+// ExpiringKeys returns the keys in an armored public key block that expire
+// within the given period after now, or have already expired. For each key
+// the primary key and the subkey used for signing are checked; subkeys that
+// have been superseded by a newer signing subkey are ignored.
+func ExpiringKeys(publicKey []byte, now time.Time, within time.Duration) ([]KeyExpiry, error) {
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(publicKey))
+	if err != nil {
+		return nil, fmt.Errorf("parse public key: %w", err)
+	}
+
+	deadline := now.Add(within)
+	var expiring []KeyExpiry
+	for _, e := range entities {
+		fingerprint := fmt.Sprintf("%X", e.PrimaryKey.Fingerprint)
+		selfSig, _ := e.PrimarySelfSignature()
+		if selfSig == nil {
+			continue
+		}
+		if expires, ok := keyExpires(e.PrimaryKey, selfSig); ok && expires.Before(deadline) {
+			expiring = append(expiring, KeyExpiry{Fingerprint: fingerprint, Expires: expires})
+			continue
+		}
+
+		sub := signingSubkey(e, now)
+		if sub == nil {
+			continue
+		}
+		if expires, ok := keyExpires(sub.PublicKey, sub.Sig); ok && expires.Before(deadline) {
+			expiring = append(expiring, KeyExpiry{
+				Fingerprint: fingerprint,
+				Subkey:      fmt.Sprintf("%X", sub.PublicKey.Fingerprint),
+				Expires:     expires,
+			})
+		}
+	}
+	return expiring, nil
+}
+
+// keyExpires returns when a key expires according to its self-signature.
+func keyExpires(key *packet.PublicKey, sig *packet.Signature) (time.Time, bool) {
+	if sig.KeyLifetimeSecs == nil || *sig.KeyLifetimeSecs == 0 {
+		return time.Time{}, false
+	}
+	return key.CreationTime.Add(time.Duration(*sig.KeyLifetimeSecs) * time.Second), true
+}
+
+// signingSubkey returns the subkey signatures are made with: the one
+// go-crypto and gpg select, or if none is usable any more, the newest
+// signing subkey so that its expiry is reported. It returns nil if the
+// primary key signs.
+func signingSubkey(e *openpgp.Entity, now time.Time) *openpgp.Subkey {
+	if key, ok := e.SigningKey(now); ok {
+		for i := range e.Subkeys {
+			if e.Subkeys[i].PublicKey == key.PublicKey {
+				return &e.Subkeys[i]
+			}
+		}
+		return nil
+	}
+
+	var newest *openpgp.Subkey
+	for i, sub := range e.Subkeys {
+		if sub.Sig.FlagsValid && sub.Sig.FlagSign && !sub.Revoked(now) &&
+			(newest == nil || sub.Sig.CreationTime.After(newest.Sig.CreationTime)) {
+			newest = &e.Subkeys[i]
+		}
+	}
+	return newest
+}
+
+// SignedByKeys reports whether the signatures of a cleartext signed message
+// were made by exactly the keys in an armored public key block: one
+// signature by each key and none by other keys. It does not verify the
+// signatures.
+func SignedByKeys(publicKey, inline []byte) (bool, error) {
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(publicKey))
+	if err != nil {
+		return false, fmt.Errorf("parse public key: %w", err)
+	}
+	block, _ := clearsign.Decode(inline)
+	if block == nil {
+		return false, errors.New("not a cleartext signed message")
+	}
+
+	owner := make(map[uint64]int)
+	for i, e := range entities {
+		owner[e.PrimaryKey.KeyId] = i
+		for _, sub := range e.Subkeys {
+			owner[sub.PublicKey.KeyId] = i
+		}
+	}
+
+	signed := make(map[int]bool)
+	packets := packet.NewReader(block.ArmoredSignature.Body)
+	for {
+		p, err := packets.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return false, fmt.Errorf("read signature: %w", err)
+		}
+		sig, ok := p.(*packet.Signature)
+		if !ok || sig.IssuerKeyId == nil {
+			return false, nil
+		}
+		i, ok := owner[*sig.IssuerKeyId]
+		if !ok || signed[i] {
+			return false, nil
+		}
+		signed[i] = true
+	}
+	return len(signed) == len(entities), nil
+}
@@ -0,0 +1,178 @@
+package gpg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+)
+
+// signatureType is the armor type of a signature block.
+const signatureType = "PGP SIGNATURE"
+
+// MultiSigner signs with several signers at once, writing one signature per
+// key into Release.gpg and InRelease. apt accepts such a Release if it
+// trusts any one of the keys, so a new key can be introduced while clients
+// that only know the old one keep working.
+type MultiSigner []Signer
+
+// NewSigner returns a signer for the given signers: the signer itself if
+// there is only one, otherwise a MultiSigner.
+func NewSigner(signers ...Signer) Signer {
+	if len(signers) == 1 {
+		return signers[0]
+	}
+	return MultiSigner(signers)
+}
+
+// Sign signs with every signer and merges the signatures.
+func (m MultiSigner) Sign(release []byte) ([]byte, []byte, error) {
+	if len(m) == 0 {
+		return nil, nil, errors.New("no signing keys")
+	}
+
+	var detached [][]byte
+	var inline [][]byte
+	for _, s := range m {
+		d, i, err := s.Sign(release)
+		if err != nil {
+			return nil, nil, err
+		}
+		detached = append(detached, d)
+		inline = append(inline, i)
+	}
+
+	mergedDetached, err := mergeDetached(detached)
+	if err != nil {
+		return nil, nil, fmt.Errorf("merge Release.gpg signatures: %w", err)
+	}
+	mergedInline, err := mergeInline(inline)
+	if err != nil {
+		return nil, nil, fmt.Errorf("merge InRelease signatures: %w", err)
+	}
+	return mergedDetached, mergedInline, nil
+}
+
+// PublicKey returns the public keys of all signers in one armored block.
+func (m MultiSigner) PublicKey() ([]byte, error) {
+	var packets bytes.Buffer
+	seen := make(map[string]bool)
+	for _, s := range m {
+		key, err := s.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		body, err := dearmor(key, openpgp.PublicKeyType)
+		if err != nil {
+			return nil, fmt.Errorf("read public key: %w", err)
+		}
+		if !seen[string(body)] {
+			seen[string(body)] = true
+			packets.Write(body)
+		}
+	}
+	return enarmor(packets.Bytes(), openpgp.PublicKeyType)
+}
+
+// mergeDetached combines armored detached signatures into one block.
+func mergeDetached(sigs [][]byte) ([]byte, error) {
+	var packets bytes.Buffer
+	for _, sig := range sigs {
+		body, err := dearmor(sig, signatureType)
+		if err != nil {
+			return nil, err
+		}
+		packets.Write(body)
+	}
+	return enarmor(packets.Bytes(), signatureType)
+}
+
+// mergeInline combines cleartext signed copies of the same text into one
+// message carrying all their signatures, like gpg --clearsign with several
+// --local-user options.
+func mergeInline(messages [][]byte) ([]byte, error) {
+	var text []byte
+	var plaintext []byte
+	var hashes []string
+	var packets bytes.Buffer
+	for i, msg := range messages {
+		block, _ := clearsign.Decode(msg)
+		if block == nil {
+			return nil, errors.New("not a cleartext signed message")
+		}
+		if i == 0 {
+			plaintext = block.Plaintext
+			// The dash-escaped text between the headers and the signature
+			start := bytes.Index(msg, []byte("\n\n"))
+			end := bytes.Index(msg, []byte("\n-----BEGIN "+signatureType+"-----"))
+			if start < 0 || end < start {
+				return nil, errors.New("malformed cleartext signed message")
+			}
+			text = msg[start+2 : end+1]
+		} else if !bytes.Equal(block.Plaintext, plaintext) {
+			return nil, errors.New("signers signed different text")
+		}
+
+		for _, h := range block.Headers.Values("Hash") {
+			for _, name := range strings.Split(h, ",") {
+				if name = strings.TrimSpace(name); !slices.Contains(hashes, name) {
+					hashes = append(hashes, name)
+				}
+			}
+		}
+		body, err := io.ReadAll(block.ArmoredSignature.Body)
+		if err != nil {
+			return nil, err
+		}
+		packets.Write(body)
+	}
+
+	sig, err := enarmor(packets.Bytes(), signatureType)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteString("-----BEGIN PGP SIGNED MESSAGE-----\n")
+	if len(hashes) > 0 {
+		fmt.Fprintf(&buf, "Hash: %s\n", strings.Join(hashes, ","))
+	}
+	buf.WriteByte('\n')
+	buf.Write(text)
+	buf.Write(sig)
+	return buf.Bytes(), nil
+}
+
+// dearmor returns the packets of an armored block of the given type.
+func dearmor(data []byte, blockType string) ([]byte, error) {
+	block, err := armor.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if block.Type != blockType {
+		return nil, fmt.Errorf("expected %s, got %s", blockType, block.Type)
+	}
+	return io.ReadAll(block.Body)
+}
+
+// enarmor armors packets the way gpg does, with a checksum line.
+func enarmor(packets []byte, blockType string) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, blockType, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(packets); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
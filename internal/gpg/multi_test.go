@@ -0,0 +1,138 @@
+package gpg
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// testSigners returns n native signers with different keys.
+func testSigners(t *testing.T, n int) []Signer {
+	t.Helper()
+	var signers []Signer
+	for range n {
+		_, key := testKey(t, "")
+		s, err := NewNativeSigner(key, "", "")
+		if err != nil {
+			t.Fatalf("NewNativeSigner: %v", err)
+		}
+		signers = append(signers, s)
+	}
+	return signers
+}
+
+func TestMultiSignerSign(t *testing.T) {
+	signers := testSigners(t, 2)
+	multi := NewSigner(signers...)
+
+	detached, inline, err := multi.Sign([]byte(testRelease))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if !strings.HasPrefix(string(inline), "-----BEGIN PGP SIGNED MESSAGE-----\nHash: SHA512\n\nOrigin: Test\n") {
+		t.Errorf("InRelease header:\n%s", inline)
+	}
+
+	// Each key alone verifies both files
+	for i, s := range signers {
+		publicKey, err := s.PublicKey()
+		if err != nil {
+			t.Fatalf("PublicKey: %v", err)
+		}
+		if err := checkSignatures(publicKey, []byte(testRelease), detached, inline); err != nil {
+			t.Errorf("key %d: %v", i, err)
+		}
+		if ok, err := SignedByKeys(publicKey, inline); err != nil || ok {
+			t.Errorf("SignedByKeys(key %d) = %v, %v, want false", i, ok, err)
+		}
+	}
+
+	publicKey, err := multi.PublicKey()
+	if err != nil {
+		t.Fatalf("PublicKey: %v", err)
+	}
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(publicKey))
+	if err != nil || len(entities) != 2 {
+		t.Fatalf("merged public key has %d keys (%v), want 2", len(entities), err)
+	}
+	if ok, err := SignedByKeys(publicKey, inline); err != nil || !ok {
+		t.Errorf("SignedByKeys(both) = %v, %v, want true", ok, err)
+	}
+
+	// A signature by one key only does not cover both
+	_, single, err := signers[0].Sign([]byte(testRelease))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if ok, err := SignedByKeys(publicKey, single); err != nil || ok {
+		t.Errorf("SignedByKeys(single signature) = %v, %v, want false", ok, err)
+	}
+}
+
+func TestExportKeyring(t *testing.T) {
+	multi := NewSigner(testSigners(t, 2)...)
+	path := filepath.Join(t.TempDir(), "keyring.gpg")
+	if err := ExportKeyring(multi, path); err != nil {
+		t.Fatalf("ExportKeyring: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entities, err := openpgp.ReadKeyRing(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("keyring is not a binary keyring: %v", err)
+	}
+	if len(entities) != 2 {
+		t.Errorf("keyring has %d keys, want 2", len(entities))
+	}
+}
+
+func TestExpiringKeys(t *testing.T) {
+	now := time.Now()
+	newKey := func(lifetime time.Duration) []byte {
+		e, err := openpgp.NewEntity("Plow Test", "", "test@example.com", &packet.Config{
+			Algorithm:       packet.PubKeyAlgoEdDSA,
+			KeyLifetimeSecs: uint32(lifetime.Seconds()),
+		})
+		if err != nil {
+			t.Fatalf("generate key: %v", err)
+		}
+		key, err := (&NativeSigner{entity: e}).PublicKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	tests := []struct {
+		name     string
+		lifetime time.Duration
+		want     int
+	}{
+		{"no expiry", 0, 0},
+		{"expires later", 90 * 24 * time.Hour, 0},
+		{"expires soon", 10 * 24 * time.Hour, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expiring, err := ExpiringKeys(newKey(tt.lifetime), now, 30*24*time.Hour)
+			if err != nil {
+				t.Fatalf("ExpiringKeys: %v", err)
+			}
+			if len(expiring) != tt.want {
+				t.Fatalf("ExpiringKeys = %v, want %d keys", expiring, tt.want)
+			}
+			if tt.want > 0 && !strings.Contains(expiring[0].String(), "expires on") {
+				t.Errorf("String() = %q", expiring[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package gpg
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// PrivateKeyEnv is the environment variable the native backend reads the
+// private key from when no key file is given. Like the GPG_PRIVATE_KEY
+// workflow secret, it may hold the key base64-encoded.
+const PrivateKeyEnv = "PLOW_SIGNING_KEY"
+
+// signatureHash is the digest used for signatures. gpg names it in the
+// Hash: header of InRelease.
+const signatureHash = crypto.SHA512
+
+// NativeSigner signs with an OpenPGP private key held in memory, without
+// the gpg binary or a keyring.
+type NativeSigner struct {
+	entity *openpgp.Entity
+	config *packet.Config
+}
+
+// ReadPrivateKey reads a private key from a file, from standard input if
+// path is "-", or from PLOW_SIGNING_KEY if path is empty.
+func ReadPrivateKey(path string) ([]byte, error) {
+	switch path {
+	case "":
+		key := os.Getenv(PrivateKeyEnv)
+		if key == "" {
+			return nil, fmt.Errorf("no private key: use --key-file or set %s", PrivateKeyEnv)
+		}
+		return []byte(key), nil
+	case "-":
+		key, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("read private key from stdin: %w", err)
+		}
+		return key, nil
+	default:
+		key, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read private key: %w", err)
+		}
+		return key, nil
+	}
+}
+
+// NewNativeSigner creates a signer from an exported secret key, which may be
+// ASCII-armored, binary, or either of those base64-encoded. If the key holds
+// several keys, keyID selects one by key ID or fingerprint; a subkey may be
+// selected the same way. An empty keyID selects the first key. Protected
+// keys are unlocked with passphrase.
+func NewNativeSigner(key []byte, keyID, passphrase string) (*NativeSigner, error) {
+	entities, err := readKeyRing(key)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &NativeSigner{config: &packet.Config{DefaultHash: signatureHash}}
+	if keyID == "" {
+		s.entity = entities[0]
+	} else {
+		keyID = normalizeKeyID(keyID)
+		for _, e := range entities {
+			if matchesKeyID(e.PrimaryKey, keyID) {
+				s.entity = e
+				break
+			}
+			for _, sub := range e.Subkeys {
+				if matchesKeyID(sub.PublicKey, keyID) {
+					s.entity = e
+					s.config.SigningKeyId = sub.PublicKey.KeyId
+					break
+				}
+			}
+			if s.entity != nil {
+				break
+			}
+		}
+		if s.entity == nil {
+			return nil, fmt.Errorf("no key %s in the private key file", keyID)
+		}
+	}
+
+	if s.entity.PrivateKey == nil {
+		return nil, errors.New("key file holds no private key")
+	}
+	if passphrase != "" {
+		if err := s.entity.DecryptPrivateKeys([]byte(passphrase)); err != nil {
+			return nil, fmt.Errorf("unlock private key: %w", err)
+		}
+	}
+
+	signingKey, ok := s.entity.SigningKeyById(s.config.Now(), s.config.SigningKey())
+	if !ok || signingKey.PrivateKey == nil {
+		return nil, fmt.Errorf("key %s has no usable signing key", s.Fingerprint())
+	}
+	if signingKey.PrivateKey.Encrypted {
+		return nil, errors.New("private key is passphrase-protected; set GPG_PASSPHRASE")
+	}
+	return s, nil
+}
+
+// readKeyRing parses secret keys in any of the encodings NewNativeSigner
+// accepts.
+func readKeyRing(key []byte) (openpgp.EntityList, error) {
+	key = bytes.TrimSpace(key)
+	if !bytes.HasPrefix(key, []byte("-----BEGIN")) {
+		if decoded, err := base64.StdEncoding.DecodeString(string(bytes.Join(bytes.Fields(key), nil))); err == nil {
+			key = bytes.TrimSpace(decoded)
+		}
+	}
+
+	var entities openpgp.EntityList
+	var err error
+	if bytes.HasPrefix(key, []byte("-----BEGIN")) {
+		entities, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(key))
+	} else {
+		entities, err = openpgp.ReadKeyRing(bytes.NewReader(key))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+	if len(entities) == 0 {
+		return nil, errors.New("parse private key: no keys found")
+	}
+	return entities, nil
+}
+
+func normalizeKeyID(keyID string) string {
+	keyID = strings.ToUpper(strings.ReplaceAll(keyID, " ", ""))
+	return strings.TrimPrefix(keyID, "0X")
+}
+
+// matchesKeyID reports whether keyID is the fingerprint or the long or short
+// key ID of a key.
+func matchesKeyID(key *packet.PublicKey, keyID string) bool {
+	fingerprint := fmt.Sprintf("%X", key.Fingerprint)
+	return len(keyID) >= 8 && strings.HasSuffix(fingerprint, keyID)
+}
+
+// Fingerprint returns the fingerprint of the signer's primary key.
+func (s *NativeSigner) Fingerprint() string {
+	return fmt.Sprintf("%X", s.entity.PrimaryKey.Fingerprint)
+}
+
+// Sign signs a Release file's content, producing signatures in the same
+// format gpg writes them.
+func (s *NativeSigner) Sign(release []byte) ([]byte, []byte, error) {
+	detached, err := s.signDetached(release)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create Release.gpg: %w", err)
+	}
+	inline, err := s.signInline(release)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create InRelease: %w", err)
+	}
+	return detached, inline, nil
+}
+
+func (s *NativeSigner) signDetached(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&buf, s.entity, bytes.NewReader(data), s.config); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// signInline writes a cleartext signed message like gpg --clearsign. The
+// clearsign package of go-crypto omits the armor checksum and adds a blank
+// line before the signature when the text ends with a newline, so the
+// message is assembled here from a detached text signature instead.
+func (s *NativeSigner) signInline(data []byte) ([]byte, error) {
+	text := strings.TrimSuffix(string(data), "\n")
+	lines := strings.Split(text, "\n")
+
+	// Trailing whitespace is not part of the signed text
+	signed := make([]string, len(lines))
+	for i, line := range lines {
+		signed[i] = strings.TrimRight(line, " \t\r")
+	}
+
+	var sig bytes.Buffer
+	if err := openpgp.ArmoredDetachSignText(&sig, s.entity, strings.NewReader(strings.Join(signed, "\n")), s.config); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("-----BEGIN PGP SIGNED MESSAGE-----\n")
+	fmt.Fprintf(&buf, "Hash: %s\n\n", hashName(s.config.Hash()))
+	for _, line := range lines {
+		if strings.HasPrefix(line, "-") {
+			buf.WriteString("- ")
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	buf.Write(sig.Bytes())
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func hashName(h crypto.Hash) string {
+	switch h {
+	case crypto.SHA256:
+		return "SHA256"
+	case crypto.SHA384:
+		return "SHA384"
+	case crypto.SHA512:
+		return "SHA512"
+	case crypto.SHA224:
+		return "SHA224"
+	default:
+		return strings.ReplaceAll(h.String(), "-", "")
+	}
+}
+
+// PublicKey exports the public key in ASCII-armored format.
+func (s *NativeSigner) PublicKey() ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.entity.Serialize(w); err != nil {
+		return nil, fmt.Errorf("serialize public key: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
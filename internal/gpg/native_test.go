@@ -0,0 +1,172 @@
+package gpg
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+const testRelease = `Origin: Test
+Suite: stable
+-Dashed: line
+Date: Thu, 01 Jan 2026 00:00:00 UTC
+SHA256:
+ e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855                0 main/binary-amd64/Packages
+`
+
+// testKey returns a new key and its armored secret key export, encrypted
+// with passphrase unless it is empty.
+func testKey(t *testing.T, passphrase string) (*openpgp.Entity, []byte) {
+	t.Helper()
+	e, err := openpgp.NewEntity("Plow Test", "", "test@example.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	if passphrase != "" {
+		if err := e.EncryptPrivateKeys([]byte(passphrase), nil); err != nil {
+			t.Fatalf("encrypt key: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		t.Fatalf("armor: %v", err)
+	}
+	if err := e.SerializePrivateWithoutSigning(w, nil); err != nil {
+		t.Fatalf("serialize key: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close armor: %v", err)
+	}
+	return e, buf.Bytes()
+}
+
+func TestNativeSignerSignRelease(t *testing.T) {
+	entity, key := testKey(t, "")
+	s, err := NewNativeSigner(key, "", "")
+	if err != nil {
+		t.Fatalf("NewNativeSigner: %v", err)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Release"), []byte(testRelease), 0644); err != nil {
+		t.Fatalf("write Release: %v", err)
+	}
+	if err := SignRelease(s, dir); err != nil {
+		t.Fatalf("SignRelease: %v", err)
+	}
+	keyring := openpgp.EntityList{entity}
+
+	detached, err := os.ReadFile(filepath.Join(dir, "Release.gpg"))
+	if err != nil {
+		t.Fatalf("read Release.gpg: %v", err)
+	}
+	if !strings.HasPrefix(string(detached), "-----BEGIN PGP SIGNATURE-----\n\n") ||
+		!strings.HasSuffix(string(detached), "\n-----END PGP SIGNATURE-----\n") {
+		t.Errorf("Release.gpg is not an armored signature:\n%s", detached)
+	}
+	if _, err := openpgp.CheckArmoredDetachedSignature(keyring, strings.NewReader(testRelease), bytes.NewReader(detached), nil); err != nil {
+		t.Errorf("Release.gpg does not verify: %v", err)
+	}
+
+	inline, err := os.ReadFile(filepath.Join(dir, "InRelease"))
+	if err != nil {
+		t.Fatalf("read InRelease: %v", err)
+	}
+	want := "-----BEGIN PGP SIGNED MESSAGE-----\nHash: SHA512\n\n" +
+		strings.Replace(testRelease, "\n-Dashed", "\n- -Dashed", 1) +
+		"-----BEGIN PGP SIGNATURE-----\n\n"
+	if !strings.HasPrefix(string(inline), want) {
+		t.Errorf("InRelease does not start like gpg --clearsign output:\n%s", inline)
+	}
+	// gpg armors with a CRC24 checksum line
+	if lines := strings.Split(strings.TrimSpace(string(inline)), "\n"); !strings.HasPrefix(lines[len(lines)-2], "=") {
+		t.Errorf("InRelease signature has no armor checksum:\n%s", inline)
+	}
+
+	block, _ := clearsign.Decode(inline)
+	if block == nil {
+		t.Fatal("InRelease is not a cleartext signed message")
+	}
+	if got := string(block.Plaintext); strings.TrimSuffix(got, "\n") != strings.TrimSuffix(testRelease, "\n") {
+		t.Errorf("InRelease text differs from Release:\n%s", got)
+	}
+	if _, err := block.VerifySignature(keyring, nil); err != nil {
+		t.Errorf("InRelease does not verify: %v", err)
+	}
+}
+
+func TestNewNativeSignerKeys(t *testing.T) {
+	entity, key := testKey(t, "secret")
+	fingerprint := fingerprintOf(entity)
+
+	if _, err := NewNativeSigner(key, "", ""); err == nil || !strings.Contains(err.Error(), "passphrase") {
+		t.Errorf("protected key without passphrase: got %v", err)
+	}
+	if _, err := NewNativeSigner(key, "", "wrong"); err == nil {
+		t.Error("expected error for wrong passphrase")
+	}
+
+	// Keys are accepted base64-encoded, as stored in CI secrets, and can be
+	// selected by long key ID or fingerprint
+	encoded := []byte(base64.StdEncoding.EncodeToString(key))
+	for _, keyID := range []string{"", fingerprint, "0x" + fingerprint[len(fingerprint)-16:]} {
+		signer, err := NewNativeSigner(encoded, keyID, "secret")
+		if err != nil {
+			t.Errorf("NewNativeSigner(%q): %v", keyID, err)
+			continue
+		}
+		if signer.Fingerprint() != fingerprint {
+			t.Errorf("NewNativeSigner(%q) selected %s", keyID, signer.Fingerprint())
+		}
+	}
+
+	if _, err := NewNativeSigner(key, "DEADBEEFDEADBEEF", "secret"); err == nil {
+		t.Error("expected error for unknown key ID")
+	}
+	if _, err := NewNativeSigner([]byte("not a key"), "", ""); err == nil {
+		t.Error("expected error for garbage key")
+	}
+}
+
+func TestNativeSignerExportPublicKey(t *testing.T) {
+	entity, key := testKey(t, "")
+	signer, err := NewNativeSigner(key, "", "")
+	if err != nil {
+		t.Fatalf("NewNativeSigner: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "public.key")
+	if err := ExportPublicKey(signer, path); err != nil {
+		t.Fatalf("ExportPublicKey: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read public key: %v", err)
+	}
+
+	keys, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("parse public key: %v", err)
+	}
+	if len(keys) != 1 || fingerprintOf(keys[0]) != fingerprintOf(entity) {
+		t.Fatalf("exported %d keys, want the signing key", len(keys))
+	}
+	if keys[0].PrivateKey != nil {
+		t.Error("exported key contains the private key")
+	}
+}
+
+// fingerprintOf returns the fingerprint of an entity in the form Fingerprint uses.
+func fingerprintOf(e *openpgp.Entity) string {
+	return (&NativeSigner{entity: e}).Fingerprint()
+}
@@ -0,0 +1,206 @@
+package gpg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+)
+
+// Environment variables that configure the remote backend.
+const (
+	SignerURLEnv   = "PLOW_SIGNER_URL"
+	SignerTokenEnv = "PLOW_SIGNER_TOKEN"
+)
+
+// Paths of the signing service protocol, relative to its base URL. See
+// docs/signing-service.md.
+const (
+	signPath      = "/v1/sign"
+	publicKeyPath = "/v1/public-key"
+)
+
+// maxReleaseSize bounds the Release content a signing service accepts.
+const maxReleaseSize = 16 << 20
+
+// SignRequest is the body of a POST to /v1/sign.
+type SignRequest struct {
+	Release string `json:"release"` // Release file content, base64-encoded
+	SHA256  string `json:"sha256"`  // Hex SHA-256 digest of the Release content
+}
+
+// SignResponse is the body of a successful reply to /v1/sign.
+type SignResponse struct {
+	Detached string `json:"detached"` // ASCII-armored detached signature (Release.gpg)
+	Inline   string `json:"inline"`   // Cleartext signed Release (InRelease)
+}
+
+// errorResponse is the body of a failed request.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// RemoteSigner signs through an HTTP signing service, so the private key
+// never has to be present where plow runs. The public key the service
+// reports must consist of pinned keys only, and returned signatures are
+// checked against it before they are used, so a compromised or misconfigured
+// service cannot substitute its own key.
+type RemoteSigner struct {
+	URL          string   // Base URL of the signing service
+	Token        string   // Optional bearer token
+	Fingerprints []string // Primary key fingerprints the service may sign with
+	Client       *http.Client
+
+	publicKey []byte
+}
+
+// NewRemoteSigner creates a signer for the signing service at url that
+// accepts only the keys with the given fingerprints.
+func NewRemoteSigner(url, token string, fingerprints []string) *RemoteSigner {
+	return &RemoteSigner{
+		URL:          strings.TrimRight(url, "/"),
+		Token:        token,
+		Fingerprints: fingerprints,
+		Client:       &http.Client{Timeout: time.Minute},
+	}
+}
+
+// Sign sends a Release file's content to the signing service.
+func (s *RemoteSigner) Sign(release []byte) ([]byte, []byte, error) {
+	digest := sha256.Sum256(release)
+	body, err := json.Marshal(SignRequest{
+		Release: base64.StdEncoding.EncodeToString(release),
+		SHA256:  hex.EncodeToString(digest[:]),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := s.do(http.MethodPost, signPath, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	var resp SignResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, nil, fmt.Errorf("signing service: parse response: %w", err)
+	}
+
+	publicKey, err := s.PublicKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkSignatures(publicKey, release, []byte(resp.Detached), []byte(resp.Inline)); err != nil {
+		return nil, nil, fmt.Errorf("signing service returned an invalid signature: %w", err)
+	}
+	return []byte(resp.Detached), []byte(resp.Inline), nil
+}
+
+// PublicKey fetches the signing service's public key. It fails if the key
+// contains a key whose fingerprint is not pinned.
+func (s *RemoteSigner) PublicKey() ([]byte, error) {
+	if s.publicKey != nil {
+		return s.publicKey, nil
+	}
+	key, err := s.do(http.MethodGet, publicKeyPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPinned(key, s.Fingerprints); err != nil {
+		return nil, fmt.Errorf("signing service: %w", err)
+	}
+	s.publicKey = key
+	return key, nil
+}
+
+// checkPinned verifies that every key in an armored public key is one of
+// the expected fingerprints.
+func checkPinned(publicKey []byte, fingerprints []string) error {
+	if len(fingerprints) == 0 {
+		return errors.New("no expected key fingerprints to check the public key against")
+	}
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(publicKey))
+	if err != nil {
+		return fmt.Errorf("parse public key: %w", err)
+	}
+	for _, e := range keyring {
+		fingerprint := fmt.Sprintf("%X", e.PrimaryKey.Fingerprint)
+		pinned := false
+		for _, want := range fingerprints {
+			if strings.EqualFold(want, fingerprint) {
+				pinned = true
+				break
+			}
+		}
+		if !pinned {
+			return fmt.Errorf("public key %s is not one of the expected keys (%s)", fingerprint, strings.Join(fingerprints, ", "))
+		}
+	}
+	return nil
+}
+
+func (s *RemoteSigner) do(method, path string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, s.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("signing service: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("signing service: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // Response fully read, close error is not critical
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 2*maxReleaseSize))
+	if err != nil {
+		return nil, fmt.Errorf("signing service: read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e errorResponse
+		if json.Unmarshal(data, &e) == nil && e.Error != "" {
+			return nil, fmt.Errorf("signing service: %s: %s", resp.Status, e.Error)
+		}
+		return nil, fmt.Errorf("signing service: %s", resp.Status)
+	}
+	return data, nil
+}
+
+// checkSignatures verifies that detached and inline are signatures of
+// release by the given public key.
+func checkSignatures(publicKey, release, detached, inline []byte) error {
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(publicKey))
+	if err != nil {
+		return fmt.Errorf("parse public key: %w", err)
+	}
+
+	if _, err := openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(release), bytes.NewReader(detached), nil); err != nil {
+		return fmt.Errorf("Release.gpg: %w", err)
+	}
+
+	block, _ := clearsign.Decode(inline)
+	if block == nil {
+		return errors.New("InRelease: not a cleartext signed message")
+	}
+	if strings.TrimRight(string(block.Plaintext), "\n") != strings.TrimRight(string(release), "\n") {
+		return errors.New("InRelease: signed text differs from Release")
+	}
+	if _, err := block.VerifySignature(keyring, nil); err != nil {
+		return fmt.Errorf("InRelease: %w", err)
+	}
+	return nil
+}
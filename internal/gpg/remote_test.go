@@ -0,0 +1,130 @@
+package gpg
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testService starts a signing service backed by a new native key.
+func testService(t *testing.T, token string) (*httptest.Server, *NativeSigner) {
+	t.Helper()
+	_, key := testKey(t, "")
+	signer, err := NewNativeSigner(key, "", "")
+	if err != nil {
+		t.Fatalf("NewNativeSigner: %v", err)
+	}
+	srv := httptest.NewServer(NewSigningHandler(signer, token))
+	t.Cleanup(srv.Close)
+	return srv, signer
+}
+
+func TestRemoteSignerSign(t *testing.T) {
+	srv, native := testService(t, "s3cret")
+
+	s := NewRemoteSigner(srv.URL+"/", "s3cret", []string{native.Fingerprint()})
+	detached, inline, err := s.Sign([]byte(testRelease))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	publicKey, err := native.PublicKey()
+	if err != nil {
+		t.Fatalf("PublicKey: %v", err)
+	}
+	if err := checkSignatures(publicKey, []byte(testRelease), detached, inline); err != nil {
+		t.Errorf("signatures do not verify: %v", err)
+	}
+
+	got, err := s.PublicKey()
+	if err != nil {
+		t.Fatalf("remote PublicKey: %v", err)
+	}
+	if !bytes.Equal(got, publicKey) {
+		t.Error("remote public key differs from the service key")
+	}
+}
+
+func TestRemoteSignerErrors(t *testing.T) {
+	srv, native := testService(t, "s3cret")
+
+	tests := []struct {
+		name    string
+		token   string
+		release string
+		want    string
+	}{
+		{"missing token", "", testRelease, "401"},
+		{"wrong token", "wrong", testRelease, "missing or invalid token"},
+		{"not a Release file", "s3cret", "#!/bin/sh\nrm -rf /\n", "not a Release file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := NewRemoteSigner(srv.URL, tt.token, []string{native.Fingerprint()}).Sign([]byte(tt.release))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Sign error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSigningHandlerDigestMismatch(t *testing.T) {
+	srv, _ := testService(t, "")
+
+	body, _ := json.Marshal(SignRequest{
+		Release: "T3JpZ2luOiBUZXN0Cg==",
+		SHA256:  strings.Repeat("0", 64),
+	})
+	resp, err := http.Post(srv.URL+signPath, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // Test cleanup
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestRemoteSignerRejectsForeignSignature(t *testing.T) {
+	// The service advertises one key but signs with another
+	_, advertised := testService(t, "")
+	_, otherKey := testKey(t, "")
+	other, err := NewNativeSigner(otherKey, "", "")
+	if err != nil {
+		t.Fatalf("NewNativeSigner: %v", err)
+	}
+	srv := httptest.NewServer(NewSigningHandler(mixedSigner{sign: other, key: advertised}, ""))
+	defer srv.Close()
+
+	_, _, err = NewRemoteSigner(srv.URL, "", []string{advertised.Fingerprint()}).Sign([]byte(testRelease))
+	if err == nil || !strings.Contains(err.Error(), "invalid signature") {
+		t.Errorf("Sign error = %v, want an invalid signature error", err)
+	}
+}
+
+func TestRemoteSignerRejectsUnpinnedKey(t *testing.T) {
+	// The service signs with and advertises a key that is not pinned
+	srv, _ := testService(t, "")
+	_, expected := testService(t, "")
+
+	s := NewRemoteSigner(srv.URL, "", []string{expected.Fingerprint()})
+	if _, _, err := s.Sign([]byte(testRelease)); err == nil || !strings.Contains(err.Error(), "not one of the expected keys") {
+		t.Errorf("Sign error = %v, want an unexpected key error", err)
+	}
+	if _, err := s.PublicKey(); err == nil {
+		t.Error("PublicKey returned a key that is not pinned")
+	}
+	if _, err := NewRemoteSigner(srv.URL, "", nil).PublicKey(); err == nil {
+		t.Error("PublicKey accepted a key without pinned fingerprints")
+	}
+}
+
+// mixedSigner signs with one signer and reports another's public key.
+type mixedSigner struct {
+	sign, key Signer
+}
+
+func (m mixedSigner) Sign(release []byte) ([]byte, []byte, error) { return m.sign.Sign(release) }
+func (m mixedSigner) PublicKey() ([]byte, error)                  { return m.key.PublicKey() }
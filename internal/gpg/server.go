@@ -0,0 +1,92 @@
+package gpg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// NewSigningHandler returns an HTTP handler that serves the signing service
+// protocol with the given signer, for use as a reference implementation and
+// in tests. If token is set, requests must carry it as a bearer token.
+//
+// Only content that looks like a Release file is signed, so the service
+// cannot be used to sign arbitrary data.
+func NewSigningHandler(signer Signer, token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+signPath, func(w http.ResponseWriter, r *http.Request) {
+		var req SignRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 2*maxReleaseSize)).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+			return
+		}
+		release, err := base64.StdEncoding.DecodeString(req.Release)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "release is not valid base64")
+			return
+		}
+		digest := sha256.Sum256(release)
+		if hex.EncodeToString(digest[:]) != req.SHA256 {
+			writeError(w, http.StatusBadRequest, "sha256 does not match the release content")
+			return
+		}
+		if !looksLikeRelease(release) {
+			writeError(w, http.StatusUnprocessableEntity, "content is not a Release file")
+			return
+		}
+
+		detached, inline, err := signer.Sign(release)
+		if err != nil {
+			log.Printf("sign Release %s: %v", req.SHA256, err)
+			writeError(w, http.StatusInternalServerError, "signing failed")
+			return
+		}
+		log.Printf("signed Release %s for %s", req.SHA256, r.RemoteAddr)
+		writeJSON(w, http.StatusOK, SignResponse{Detached: string(detached), Inline: string(inline)})
+	})
+	mux.HandleFunc("GET "+publicKeyPath, func(w http.ResponseWriter, r *http.Request) {
+		key, err := signer.PublicKey()
+		if err != nil {
+			log.Printf("export public key: %v", err)
+			writeError(w, http.StatusInternalServerError, "public key unavailable")
+			return
+		}
+		w.Header().Set("Content-Type", "application/pgp-keys")
+		_, _ = w.Write(key)
+	})
+
+	if token == "" {
+		return mux
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			writeError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// looksLikeRelease reports whether data has the fields every Release file
+// plow writes has.
+func looksLikeRelease(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("Origin: ")) &&
+		bytes.Contains(data, []byte("\nDate: ")) &&
+		bytes.Contains(data, []byte("\nSHA256:\n"))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorResponse{Error: msg})
+}
@@ -9,44 +9,103 @@ import (
 	"path/filepath"
 )
 
-// Signer handles GPG signing operations.
-type Signer struct {
+// Signer signs Release files. The key may live in the gpg keyring
+// (GPGSigner), in memory (NativeSigner), or in a signing service
+// (RemoteSigner).
+type Signer interface {
+	// Sign returns an ASCII-armored detached signature of a Release file's
+	// content and a cleartext signed copy of it, as written to Release.gpg
+	// and InRelease.
+	Sign(release []byte) (detached, inline []byte, err error)
+
+	// PublicKey returns the ASCII-armored public key of the signing key.
+	PublicKey() ([]byte, error)
+}
+
+// SignRelease signs the Release file in distDir, creating Release.gpg and
+// InRelease.
+func SignRelease(s Signer, distDir string) error {
+	release, err := os.ReadFile(filepath.Join(distDir, "Release"))
+	if err != nil {
+		return fmt.Errorf("read Release: %w", err)
+	}
+
+	detached, inline, err := s.Sign(release)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(distDir, "Release.gpg"), detached, 0644); err != nil {
+		return fmt.Errorf("write Release.gpg: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(distDir, "InRelease"), inline, 0644); err != nil {
+		return fmt.Errorf("write InRelease: %w", err)
+	}
+	return nil
+}
+
+// ExportPublicKey writes the signer's public key in ASCII-armored format.
+func ExportPublicKey(s Signer, outputPath string) error {
+	key, err := s.PublicKey()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outputPath, key, 0644)
+}
+
+// GPGSigner signs with the gpg binary and the keys in its keyring.
+type GPGSigner struct {
 	KeyID      string // Optional: specific key ID to use
 	Passphrase string // Optional: passphrase from environment
 }
 
-// NewSigner creates a new GPG signer.
-func NewSigner(keyID string) *Signer {
-	return &Signer{
+// NewGPGSigner creates a new GPG signer.
+func NewGPGSigner(keyID string) *GPGSigner {
+	return &GPGSigner{
 		KeyID:      keyID,
 		Passphrase: os.Getenv("GPG_PASSPHRASE"),
 	}
 }
 
-// SignRelease signs the Release file, creating Release.gpg and InRelease.
-func (s *Signer) SignRelease(distDir string) error {
-	releasePath := filepath.Join(distDir, "Release")
-	releaseGpgPath := filepath.Join(distDir, "Release.gpg")
-	inReleasePath := filepath.Join(distDir, "InRelease")
+// Sign signs a Release file's content with gpg --detach-sign and
+// gpg --clearsign.
+func (s *GPGSigner) Sign(release []byte) ([]byte, []byte, error) {
+	// gpg reads the passphrase from stdin, so the content goes through files
+	dir, err := os.MkdirTemp("", "plow-sign-")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(dir) //nolint:errcheck // Temporary files, removal failure is not critical
 
-	// Remove old signatures (ignore errors, files may not exist)
-	_ = os.Remove(releaseGpgPath)
-	_ = os.Remove(inReleasePath)
+	releasePath := filepath.Join(dir, "Release")
+	if err := os.WriteFile(releasePath, release, 0600); err != nil {
+		return nil, nil, err
+	}
 
 	// Create detached signature (Release.gpg)
-	if err := s.signDetached(releasePath, releaseGpgPath); err != nil {
-		return fmt.Errorf("create Release.gpg: %w", err)
+	detachedPath := filepath.Join(dir, "Release.gpg")
+	if err := s.signDetached(releasePath, detachedPath); err != nil {
+		return nil, nil, fmt.Errorf("create Release.gpg: %w", err)
 	}
 
 	// Create inline signature (InRelease)
-	if err := s.signInline(releasePath, inReleasePath); err != nil {
-		return fmt.Errorf("create InRelease: %w", err)
+	inlinePath := filepath.Join(dir, "InRelease")
+	if err := s.signInline(releasePath, inlinePath); err != nil {
+		return nil, nil, fmt.Errorf("create InRelease: %w", err)
 	}
 
-	return nil
+	detached, err := os.ReadFile(detachedPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	inline, err := os.ReadFile(inlinePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return detached, inline, nil
 }
 
-func (s *Signer) signDetached(inputPath, outputPath string) error {
+func (s *GPGSigner) signDetached(inputPath, outputPath string) error {
 	args := []string{
 		"--batch",
 		"--yes",
@@ -80,7 +139,7 @@ func (s *Signer) signDetached(inputPath, outputPath string) error {
 	return nil
 }
 
-func (s *Signer) signInline(inputPath, outputPath string) error {
+func (s *GPGSigner) signInline(inputPath, outputPath string) error {
 	args := []string{
 		"--batch",
 		"--yes",
@@ -114,8 +173,8 @@ func (s *Signer) signInline(inputPath, outputPath string) error {
 	return nil
 }
 
-// ExportPublicKey exports the public key in ASCII-armored format.
-func (s *Signer) ExportPublicKey(outputPath string) error {
+// PublicKey exports the public key in ASCII-armored format.
+func (s *GPGSigner) PublicKey() ([]byte, error) {
 	args := []string{
 		"--armor",
 		"--export",
@@ -128,8 +187,11 @@ func (s *Signer) ExportPublicKey(outputPath string) error {
 	cmd := exec.Command("gpg", args...)
 	output, err := cmd.Output()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if len(output) == 0 {
+		return nil, fmt.Errorf("no public key found in the gpg keyring")
 	}
 
-	return os.WriteFile(outputPath, output, 0644)
+	return output, nil
 }
@@ -0,0 +1,76 @@
+package gpg
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Verifier checks signatures against the keys in an exported public key
+// file, such as a repository's public.key. It uses gpgv with a keyring of
+// its own, so keys in the user's keyring are never trusted by accident.
+type Verifier struct {
+	dir     string
+	keyring string
+}
+
+// NewVerifier creates a verifier for the keys in keyPath, which may be
+// ASCII-armored or binary. Close removes its temporary keyring.
+func NewVerifier(keyPath string) (*Verifier, error) {
+	dir, err := os.MkdirTemp("", "plow-gpgv-")
+	if err != nil {
+		return nil, fmt.Errorf("create keyring directory: %w", err)
+	}
+	v := &Verifier{dir: dir, keyring: filepath.Join(dir, "keyring.gpg")}
+
+	key, err := os.ReadFile(keyPath)
+	if err != nil {
+		_ = v.Close()
+		return nil, fmt.Errorf("read public key: %w", err)
+	}
+	if bytes.Contains(key, []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----")) {
+		cmd := exec.Command("gpg", "--batch", "--homedir", dir, "--dearmor", "--output", v.keyring)
+		cmd.Stdin = bytes.NewReader(key)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			_ = v.Close()
+			return nil, fmt.Errorf("dearmor public key: %w: %s", err, stderr.String())
+		}
+	} else if err := os.WriteFile(v.keyring, key, 0600); err != nil {
+		_ = v.Close()
+		return nil, fmt.Errorf("write keyring: %w", err)
+	}
+	return v, nil
+}
+
+// Close removes the verifier's temporary keyring.
+func (v *Verifier) Close() error {
+	return os.RemoveAll(v.dir)
+}
+
+// VerifyDetached checks a detached signature, such as Release.gpg, of the
+// file at dataPath.
+func (v *Verifier) VerifyDetached(dataPath, sigPath string) error {
+	return v.run(sigPath, dataPath)
+}
+
+// VerifyInline checks an inline signed file, such as InRelease.
+func (v *Verifier) VerifyInline(path string) error {
+	return v.run(path)
+}
+
+func (v *Verifier) run(files ...string) error {
+	args := append([]string{"--homedir", v.dir, "--keyring", v.keyring}, files...)
+	cmd := exec.Command("gpgv", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// gpgv explains the failure on its last line, e.g. BAD signature from ...
+		lines := bytes.Split(bytes.TrimSpace(stderr.Bytes()), []byte("\n"))
+		return fmt.Errorf("%w: %s", err, bytes.TrimPrefix(lines[len(lines)-1], []byte("gpgv: ")))
+	}
+	return nil
+}
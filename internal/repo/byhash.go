@@ -0,0 +1,186 @@
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// byHashDir is the directory, next to the index files it serves, that holds
+// content-addressed copies of them for Acquire-By-Hash clients.
+const byHashDir = "by-hash"
+
+// byHashState records, per index directory, the SHA-256 digests of every
+// index generation whose by-hash copies are still kept, oldest first.
+// Directories are keyed by their slash-separated path relative to the root.
+type byHashState map[string][][]string
+
+func (r *Repository) byHashStatePath() string {
+	return filepath.Join(r.Root, stateDir, "by-hash.json")
+}
+
+func (r *Repository) loadByHashState() (byHashState, error) {
+	state := make(byHashState)
+	data, err := os.ReadFile(r.byHashStatePath())
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read by-hash state: %w", err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("parse by-hash state: %w", err)
+	}
+	return state, nil
+}
+
+func (r *Repository) saveByHashState(state byHashState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode by-hash state: %w", err)
+	}
+	data = append(data, '\n')
+
+	path := r.byHashStatePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create state directory: %w", err)
+	}
+	if _, err := writeFileIfChanged(path, data); err != nil {
+		return fmt.Errorf("write by-hash state: %w", err)
+	}
+	return nil
+}
+
+// updateByHash stores a by-hash/SHA256/<digest> copy of every index file of
+// a distribution. Copies from the previous ByHashRetention generations of a
+// directory are kept so clients holding an older Release can still fetch
+// matching indices while a publish is in progress; older copies are deleted.
+// With Acquire-By-Hash disabled, all by-hash copies of the distribution are
+// removed.
+func (r *Repository) updateByHash(dist string) error {
+	state, err := r.loadByHashState()
+	if err != nil {
+		return err
+	}
+
+	distDir := filepath.Join(r.Root, "dists", dist)
+	indexFiles := make(map[string][]string) // directory -> index files
+	err = filepath.Walk(distDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == byHashDir {
+				if !r.Config.AcquireByHash {
+					if err := os.RemoveAll(path); err != nil {
+						return err
+					}
+				}
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isIndexFile(info.Name()) {
+			dir := filepath.Dir(path)
+			indexFiles[dir] = append(indexFiles[dir], path)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("walk dist directory: %w", err)
+	}
+
+	// Forget directories of this distribution that no longer get copies
+	changed := false
+	prefix := filepath.ToSlash(filepath.Join("dists", dist)) + "/"
+	for key := range state {
+		dir := filepath.Join(r.Root, filepath.FromSlash(key))
+		if strings.HasPrefix(key, prefix) && (!r.Config.AcquireByHash || indexFiles[dir] == nil) {
+			delete(state, key)
+			changed = true
+		}
+	}
+
+	if r.Config.AcquireByHash {
+		changed = true
+		for dir, files := range indexFiles {
+			key, err := filepath.Rel(r.Root, dir)
+			if err != nil {
+				return err
+			}
+			key = filepath.ToSlash(key)
+			generations, err := r.storeByHash(dir, files, state[key])
+			if err != nil {
+				return err
+			}
+			state[key] = generations
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+	return r.saveByHashState(state)
+}
+
+// storeByHash copies the index files of one directory into its by-hash
+// directory and returns the updated list of retained generations.
+func (r *Repository) storeByHash(dir string, files []string, generations [][]string) ([][]string, error) {
+	hashDir := filepath.Join(dir, byHashDir, "SHA256")
+	if err := os.MkdirAll(hashDir, 0755); err != nil {
+		return nil, fmt.Errorf("create by-hash directory: %w", err)
+	}
+
+	var current []string
+	for _, path := range files {
+		digest, err := sha256File(path)
+		if err != nil {
+			return nil, err
+		}
+		target := filepath.Join(hashDir, digest)
+		if _, err := os.Stat(target); os.IsNotExist(err) {
+			if err := copyFile(path, target); err != nil {
+				return nil, fmt.Errorf("write by-hash copy of %s: %w", filepath.Base(path), err)
+			}
+		}
+		current = append(current, digest)
+	}
+	slices.Sort(current)
+	current = slices.Compact(current)
+
+	if len(generations) == 0 || !slices.Equal(generations[len(generations)-1], current) {
+		generations = append(generations, current)
+	}
+	if keep := r.Config.ByHashRetention + 1; len(generations) > keep {
+		generations = generations[len(generations)-keep:]
+	}
+
+	retained := make(map[string]bool)
+	for _, gen := range generations {
+		for _, digest := range gen {
+			retained[digest] = true
+		}
+	}
+	entries, err := os.ReadDir(hashDir)
+	if err != nil {
+		return nil, fmt.Errorf("read by-hash directory: %w", err)
+	}
+	for _, entry := range entries {
+		if !retained[entry.Name()] {
+			if err := os.Remove(filepath.Join(hashDir, entry.Name())); err != nil {
+				return nil, fmt.Errorf("remove expired by-hash copy: %w", err)
+			}
+		}
+	}
+
+	return generations, nil
+}
+
+// isIndexFile reports whether a file in dists/ is an index that Release
+// lists: a Packages or Contents file or one of their compressed variants.
+func isIndexFile(name string) bool {
+	return strings.HasPrefix(name, "Packages") || strings.HasPrefix(name, "Contents-")
+}
@@ -0,0 +1,78 @@
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAcquireByHash(t *testing.T) {
+	r := newTestRepo(t)
+	r.Config.AcquireByHash = true
+	r.Config.ByHashRetention = 1
+	hashDir := filepath.Join(r.Root, "dists", "stable", "main", "binary-amd64", "by-hash", "SHA256")
+	packagesPath := filepath.Join(r.Root, "dists", "stable", "main", "binary-amd64", "Packages")
+
+	// Each added version produces a new generation of the Packages index
+	var digests []string
+	for _, v := range []string{"1.0", "2.0", "3.0"} {
+		if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, t.TempDir(), "myapp", v, "amd64"), Dist: "stable"}); err != nil {
+			t.Fatalf("add %s: %v", v, err)
+		}
+		if err := r.GeneratePackagesIndex("stable"); err != nil {
+			t.Fatalf("GeneratePackagesIndex: %v", err)
+		}
+		digest, err := sha256File(packagesPath)
+		if err != nil {
+			t.Fatalf("hash Packages: %v", err)
+		}
+		copied, err := os.ReadFile(filepath.Join(hashDir, digest))
+		if err != nil {
+			t.Fatalf("by-hash copy of generation %s: %v", v, err)
+		}
+		if string(copied) != readPackages(t, r, "stable") {
+			t.Errorf("by-hash copy of generation %s differs from Packages", v)
+		}
+		digests = append(digests, digest)
+	}
+
+	// Retention 1 keeps the current and the previous generation
+	if _, err := os.Stat(filepath.Join(hashDir, digests[1])); err != nil {
+		t.Errorf("previous generation removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(hashDir, digests[0])); !os.IsNotExist(err) {
+		t.Error("generation older than the retention still exists")
+	}
+
+	// Regenerating an unchanged index keeps both generations
+	if err := r.GeneratePackagesIndex("stable"); err != nil {
+		t.Fatalf("GeneratePackagesIndex: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(hashDir, digests[1])); err != nil {
+		t.Errorf("unchanged regeneration expired the previous generation: %v", err)
+	}
+
+	if err := r.GenerateRelease("stable"); err != nil {
+		t.Fatalf("GenerateRelease: %v", err)
+	}
+	release, err := os.ReadFile(filepath.Join(r.Root, "dists", "stable", "Release"))
+	if err != nil {
+		t.Fatalf("read Release: %v", err)
+	}
+	if !strings.Contains(string(release), "Acquire-By-Hash: yes\n") {
+		t.Error("Release missing Acquire-By-Hash")
+	}
+	if strings.Contains(string(release), "by-hash") {
+		t.Error("Release lists by-hash copies")
+	}
+
+	// Disabling the mode removes the copies
+	r.Config.AcquireByHash = false
+	if err := r.GeneratePackagesIndex("stable"); err != nil {
+		t.Fatalf("GeneratePackagesIndex: %v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(hashDir)); !os.IsNotExist(err) {
+		t.Error("by-hash directory left behind after disabling Acquire-By-Hash")
+	}
+}
@@ -0,0 +1,359 @@
+package repo
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/frostyard/plow/internal/deb"
+)
+
+// metaCache stores the metadata plow extracts from pool files so indexing
+// does not have to re-read every .deb on every run. Entries are keyed by pool
+// path and validated against the file's size and modification time. A fresh
+// git checkout resets modification times, so an entry whose size matches but
+// whose mtime does not is revalidated with a single SHA-256 pass rather than
+// a full parse.
+type metaCache struct {
+	Entries map[string]*cacheEntry `json:"entries"`
+	dirty   bool
+}
+
+type cacheEntry struct {
+	Size    int64    `json:"size"`
+	ModTime int64    `json:"mtime"`
+	MD5sum  string   `json:"md5"`
+	SHA1    string   `json:"sha1"`
+	SHA256  string   `json:"sha256"`
+	Control string   `json:"control"`
+	Files   []string `json:"files"` // nil until the file list is first needed
+}
+
+func (r *Repository) cachePath() string {
+	return filepath.Join(r.Root, stateDir, "cache.json")
+}
+
+// metadataCache returns the repository's cache, loading it on first use.
+func (r *Repository) metadataCache() (*metaCache, error) {
+	if r.cache != nil {
+		return r.cache, nil
+	}
+
+	c := &metaCache{Entries: make(map[string]*cacheEntry)}
+	data, err := os.ReadFile(r.cachePath())
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, fmt.Errorf("read metadata cache: %w", err)
+	default:
+		if err := json.Unmarshal(data, c); err != nil {
+			return nil, fmt.Errorf("parse metadata cache: %w", err)
+		}
+		if c.Entries == nil {
+			c.Entries = make(map[string]*cacheEntry)
+		}
+	}
+
+	r.cache = c
+	return c, nil
+}
+
+// saveCache writes the metadata cache if it changed since it was loaded.
+func (r *Repository) saveCache() error {
+	if r.cache == nil || !r.cache.dirty {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(r.cache, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode metadata cache: %w", err)
+	}
+	data = append(data, '\n')
+
+	path := r.cachePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create state directory: %w", err)
+	}
+	if _, err := writeFileIfChanged(path, data); err != nil {
+		return fmt.Errorf("write metadata cache: %w", err)
+	}
+	r.cache.dirty = false
+	return nil
+}
+
+// lookup returns the valid cache entry for a pool file, or nil.
+func (c *metaCache) lookup(fullPath, relPath string, info os.FileInfo) (*cacheEntry, error) {
+	e := c.Entries[relPath]
+	if e == nil || e.Size != info.Size() {
+		return nil, nil
+	}
+	if e.ModTime == info.ModTime().UnixNano() {
+		return e, nil
+	}
+
+	sum, err := sha256File(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	if sum != e.SHA256 {
+		return nil, nil
+	}
+	// Refreshing the timestamp does not mark the cache dirty: it differs on
+	// every checkout, and rewriting the cache for it alone would cause churn.
+	e.ModTime = info.ModTime().UnixNano()
+	return e, nil
+}
+
+// parsePoolFile returns the metadata of a pool file, from the cache when
+// possible. relPath is relative to the repository root.
+func (r *Repository) parsePoolFile(relPath string) (*deb.Package, error) {
+	entry, err := r.poolEntry(relPath)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg, err := deb.ParseControl([]byte(entry.Control))
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", relPath, err)
+	}
+	pkg.Filename = filepath.ToSlash(relPath)
+	pkg.Size = entry.Size
+	pkg.MD5sum = entry.MD5sum
+	pkg.SHA1 = entry.SHA1
+	pkg.SHA256 = entry.SHA256
+	return pkg, nil
+}
+
+// poolFileList returns the files installed by a pool file, from the cache
+// when possible.
+func (r *Repository) poolFileList(relPath string) ([]string, error) {
+	entry, err := r.poolEntry(relPath)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Files == nil {
+		files, err := deb.ListFiles(filepath.Join(r.Root, filepath.FromSlash(relPath)))
+		if err != nil {
+			return nil, fmt.Errorf("list files of %s: %w", relPath, err)
+		}
+		if files == nil {
+			files = []string{}
+		}
+		entry.Files = files
+		r.cache.dirty = true
+	}
+	return entry.Files, nil
+}
+
+func (r *Repository) poolEntry(relPath string) (*cacheEntry, error) {
+	c, err := r.metadataCache()
+	if err != nil {
+		return nil, err
+	}
+
+	relPath = filepath.ToSlash(relPath)
+	fullPath := filepath.Join(r.Root, filepath.FromSlash(relPath))
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := c.lookup(fullPath, relPath, info)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		return entry, nil
+	}
+
+	pkg, err := deb.Parse(fullPath)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", relPath, err)
+	}
+	return r.cachePackage(relPath, pkg, info), nil
+}
+
+// cachePackage records already-parsed metadata for a pool file.
+func (r *Repository) cachePackage(relPath string, pkg *deb.Package, info os.FileInfo) *cacheEntry {
+	control := ""
+	if pkg.Control != nil {
+		control = pkg.Control.String()
+	}
+	entry := &cacheEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		MD5sum:  pkg.MD5sum,
+		SHA1:    pkg.SHA1,
+		SHA256:  pkg.SHA256,
+		Control: control,
+	}
+	r.cache.Entries[filepath.ToSlash(relPath)] = entry
+	r.cache.dirty = true
+	return entry
+}
+
+// forgetPoolFile drops the cache entry of a deleted pool file.
+func (r *Repository) forgetPoolFile(relPath string) error {
+	c, err := r.metadataCache()
+	if err != nil {
+		return err
+	}
+	relPath = filepath.ToSlash(relPath)
+	if _, ok := c.Entries[relPath]; ok {
+		delete(c.Entries, relPath)
+		c.dirty = true
+	}
+	return nil
+}
+
+// CacheReport describes the differences between the metadata cache and the
+// pool.
+type CacheReport struct {
+	Checked  int      // Pool files checked
+	Stale    []string // Cached entries whose file content changed
+	Missing  []string // Cached entries whose file no longer exists
+	Uncached []string // Pool files without a cache entry
+}
+
+// OK reports whether the cache matches the pool exactly.
+func (c *CacheReport) OK() bool {
+	return len(c.Stale) == 0 && len(c.Missing) == 0 && len(c.Uncached) == 0
+}
+
+// RebuildCache discards the metadata cache and re-parses every pool file.
+// It returns the number of files cached.
+func (r *Repository) RebuildCache() (int, error) {
+	r.cache = &metaCache{Entries: make(map[string]*cacheEntry), dirty: true}
+
+	files, err := r.poolFiles()
+	if err != nil {
+		return 0, err
+	}
+	for _, relPath := range files {
+		if _, err := r.poolEntry(relPath); err != nil {
+			return 0, err
+		}
+		if r.Config.Contents {
+			if _, err := r.poolFileList(relPath); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if err := r.saveCache(); err != nil {
+		return 0, err
+	}
+	return len(files), nil
+}
+
+// VerifyCache compares every cache entry against the full checksums of its
+// pool file, without modifying the cache.
+func (r *Repository) VerifyCache() (*CacheReport, error) {
+	c, err := r.metadataCache()
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := r.poolFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CacheReport{}
+	onDisk := make(map[string]bool)
+	for _, relPath := range files {
+		onDisk[relPath] = true
+		e := c.Entries[relPath]
+		if e == nil {
+			report.Uncached = append(report.Uncached, relPath)
+			continue
+		}
+
+		report.Checked++
+		sums, size, err := checksumFile(filepath.Join(r.Root, filepath.FromSlash(relPath)))
+		if err != nil {
+			return nil, err
+		}
+		if size != e.Size || sums[0] != e.MD5sum || sums[1] != e.SHA1 || sums[2] != e.SHA256 {
+			report.Stale = append(report.Stale, relPath)
+		}
+	}
+
+	for relPath := range c.Entries {
+		if !onDisk[relPath] {
+			report.Missing = append(report.Missing, relPath)
+		}
+	}
+	sort.Strings(report.Missing)
+
+	return report, nil
+}
+
+// poolFiles returns every .deb under pool/, relative to the repository root
+// with forward slashes, in sorted order.
+func (r *Repository) poolFiles() ([]string, error) {
+	var files []string
+	err := filepath.Walk(filepath.Join(r.Root, "pool"), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, ".deb") {
+			return nil
+		}
+		relPath, err := filepath.Rel(r.Root, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(relPath))
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close() //nolint:errcheck // Read-only file, close error is not critical
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checksumFile returns the MD5, SHA-1 and SHA-256 of a file, and its size.
+func checksumFile(path string) ([3]string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return [3]string{}, 0, err
+	}
+	defer f.Close() //nolint:errcheck // Read-only file, close error is not critical
+
+	md5h := md5.New()
+	sha1h := sha1.New()
+	sha256h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(md5h, sha1h, sha256h), f)
+	if err != nil {
+		return [3]string{}, 0, err
+	}
+	return [3]string{
+		hex.EncodeToString(md5h.Sum(nil)),
+		hex.EncodeToString(sha1h.Sum(nil)),
+		hex.EncodeToString(sha256h.Sum(nil)),
+	}, n, nil
+}
@@ -0,0 +1,109 @@
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParsePoolFileUsesCache(t *testing.T) {
+	r := newTestRepo(t)
+	res, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, t.TempDir(), "myapp", "1.0", "amd64", "Multi-Arch: foreign"), Dist: "stable"})
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	pkg := res.Package
+
+	// A fresh Repository reads the persisted cache
+	r2 := New(r.Root, r.Config)
+	cached, err := r2.parsePoolFile(pkg.Filename)
+	if err != nil {
+		t.Fatalf("parsePoolFile: %v", err)
+	}
+	if cached.SHA256 != pkg.SHA256 || cached.Version != "1.0" {
+		t.Errorf("cached package = %+v", cached)
+	}
+	if cached.Stanza().Get("Multi-Arch") != "foreign" {
+		t.Error("cached package lost Multi-Arch")
+	}
+
+	// A touched but unchanged file is revalidated by checksum, not re-parsed
+	full := filepath.Join(r.Root, pkg.Filename)
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(full, later, later); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	r3 := New(r.Root, r.Config)
+	if _, err := r3.parsePoolFile(pkg.Filename); err != nil {
+		t.Fatalf("parsePoolFile after touch: %v", err)
+	}
+	if r3.cache.dirty {
+		t.Error("revalidating a touched file marked the cache dirty")
+	}
+}
+
+func TestParsePoolFileDetectsChange(t *testing.T) {
+	r := newTestRepo(t)
+	res, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, t.TempDir(), "myapp", "1.0", "amd64"), Dist: "stable"})
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	pkg := res.Package
+
+	// Replace the pool file with different content under the same name
+	replacement := writeTestDeb(t, t.TempDir(), "myapp", "1.0", "amd64", "Section: utils")
+	if err := copyFile(replacement, filepath.Join(r.Root, pkg.Filename)); err != nil {
+		t.Fatalf("replace pool file: %v", err)
+	}
+
+	report, err := New(r.Root, r.Config).VerifyCache()
+	if err != nil {
+		t.Fatalf("VerifyCache: %v", err)
+	}
+	if report.OK() || len(report.Stale) != 1 {
+		t.Errorf("VerifyCache() = %+v, want one stale entry", report)
+	}
+
+	got, err := New(r.Root, r.Config).parsePoolFile(pkg.Filename)
+	if err != nil {
+		t.Fatalf("parsePoolFile: %v", err)
+	}
+	if got.Section != "utils" {
+		t.Error("changed pool file served from stale cache")
+	}
+}
+
+func TestRebuildCache(t *testing.T) {
+	r := newTestRepo(t)
+	addTestPackages(t, r, "stable", [2]string{"myapp", "1.0"}, [2]string{"other", "2.0"})
+
+	if err := os.Remove(r.cachePath()); err != nil {
+		t.Fatalf("remove cache: %v", err)
+	}
+
+	r2 := New(r.Root, r.Config)
+	report, err := r2.VerifyCache()
+	if err != nil {
+		t.Fatalf("VerifyCache: %v", err)
+	}
+	if len(report.Uncached) != 2 {
+		t.Errorf("Uncached = %v, want 2 entries", report.Uncached)
+	}
+
+	n, err := r2.RebuildCache()
+	if err != nil {
+		t.Fatalf("RebuildCache: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("RebuildCache() = %d, want 2", n)
+	}
+
+	report, err = New(r.Root, r.Config).VerifyCache()
+	if err != nil {
+		t.Fatalf("VerifyCache: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("VerifyCache() after rebuild = %+v", report)
+	}
+}
@@ -0,0 +1,128 @@
+package repo
+
+import (
+	"bytes"
+	stdbzip2 "compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/dsnet/compress/bzip2"
+	"github.com/ulikunitz/xz"
+)
+
+// compressionFormats lists the compressed index variants plow can write,
+// keyed by file extension.
+var compressionFormats = map[string]func([]byte) ([]byte, error){
+	"gz":  gzipBytes,
+	"xz":  xzBytes,
+	"bz2": bzip2Bytes,
+}
+
+// writeIndexFile writes an index file along with the compressed variants
+// enabled in the configuration. Variants that are no longer enabled are
+// removed so Release never lists stale copies. Files whose content did not
+// change are left alone.
+func (r *Repository) writeIndexFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	changed, err := writeFileIfChanged(path, data)
+	if err != nil {
+		return err
+	}
+
+	enabled := make(map[string]bool)
+	for _, ext := range r.Config.Compression {
+		compress, ok := compressionFormats[ext]
+		if !ok {
+			return fmt.Errorf("unsupported compression %q", ext)
+		}
+		enabled[ext] = true
+
+		// Compression is deterministic, so the existing variant of an
+		// unchanged index is already current.
+		if !changed {
+			if _, err := os.Stat(path + "." + ext); err == nil {
+				continue
+			}
+		}
+		compressed, err := compress(data)
+		if err != nil {
+			return fmt.Errorf("compress %s: %w", ext, err)
+		}
+		if _, err := writeFileIfChanged(path+"."+ext, compressed); err != nil {
+			return err
+		}
+	}
+
+	for ext := range compressionFormats {
+		if enabled[ext] {
+			continue
+		}
+		if err := os.Remove(path + "." + ext); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// decompressIndex returns the content of a compressed index variant with the
+// given extension.
+func decompressIndex(ext string, data []byte) ([]byte, error) {
+	var r io.Reader
+	switch ext {
+	case "gz":
+		gzr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		r = gzr
+	case "xz":
+		xzr, err := xz.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		r = xzr
+	case "bz2":
+		r = stdbzip2.NewReader(bytes.NewReader(data))
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", ext)
+	}
+	return io.ReadAll(r)
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	return compressBytes(data, func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriterLevel(w, gzip.BestCompression)
+	})
+}
+
+func xzBytes(data []byte) ([]byte, error) {
+	return compressBytes(data, func(w io.Writer) (io.WriteCloser, error) {
+		return xz.NewWriter(w)
+	})
+}
+
+func bzip2Bytes(data []byte) ([]byte, error) {
+	return compressBytes(data, func(w io.Writer) (io.WriteCloser, error) {
+		return bzip2.NewWriter(w, &bzip2.WriterConfig{Level: bzip2.BestCompression})
+	})
+}
+
+func compressBytes(data []byte, newWriter func(io.Writer) (io.WriteCloser, error)) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := newWriter(&buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,60 @@
+package repo
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ulikunitz/xz"
+)
+
+func TestCompressedPackages(t *testing.T) {
+	r := newTestRepo(t)
+	r.Config.Compression = []string{"gz", "xz", "bz2"}
+	if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, t.TempDir(), "myapp", "1.0", "amd64"), Dist: "stable"}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := r.GeneratePackagesIndex("stable"); err != nil {
+		t.Fatalf("GeneratePackagesIndex: %v", err)
+	}
+	if err := r.GenerateRelease("stable"); err != nil {
+		t.Fatalf("GenerateRelease: %v", err)
+	}
+
+	packages := readPackages(t, r, "stable")
+	readers := map[string]func(io.Reader) (io.Reader, error){
+		"gz":  func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"xz":  func(r io.Reader) (io.Reader, error) { return xz.NewReader(r) },
+		"bz2": func(r io.Reader) (io.Reader, error) { return bzip2.NewReader(r), nil },
+	}
+	release, err := os.ReadFile(filepath.Join(r.Root, "dists", "stable", "Release"))
+	if err != nil {
+		t.Fatalf("read Release: %v", err)
+	}
+
+	for ext, newReader := range readers {
+		data, err := os.ReadFile(filepath.Join(r.Root, "dists", "stable", "main", "binary-amd64", "Packages."+ext))
+		if err != nil {
+			t.Fatalf("read Packages.%s: %v", ext, err)
+		}
+		zr, err := newReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("open Packages.%s: %v", ext, err)
+		}
+		got, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("decompress Packages.%s: %v", ext, err)
+		}
+		if string(got) != packages {
+			t.Errorf("Packages.%s does not match Packages", ext)
+		}
+		if !strings.Contains(string(release), " main/binary-amd64/Packages."+ext+"\n") {
+			t.Errorf("Release missing Packages.%s", ext)
+		}
+	}
+}
@@ -0,0 +1,836 @@
+package repo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/frostyard/plow/internal/deb"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFile is the name of the repository configuration file, relative to
+// the repository root.
+const ConfigFile = "plow.yaml"
+
+// Config holds repository configuration.
+type Config struct {
+	Origin        string
+	Label         string
+	Description   string
+	Architectures []string
+	Components    []string
+	Distributions []string
+	Contents      bool     // Generate Contents-<arch> indices for apt-file
+	Compression   []string // Compressed index variants to write ("gz", "xz", "bz2")
+
+	// StrictArchitectures rejects packages whose architecture is not
+	// configured for the distribution, instead of creating its indices on
+	// demand.
+	StrictArchitectures bool
+
+	// AcquireByHash writes by-hash/SHA256/<digest> copies of every index
+	// and announces them in Release, so clients never see an index that does
+	// not match the Release they fetched. The copies of the previous
+	// ByHashRetention generations are kept.
+	AcquireByHash   bool
+	ByHashRetention int
+
+	// ArchAll selects where Architecture: all packages are indexed; see
+	// the ArchAll* constants. Empty means ArchAllDuplicate.
+	ArchAll string
+
+	// SigningKeys is the key rotation schedule. Releases are signed with
+	// every key whose period includes the current date, and the public keys
+	// of all keys that are not retired yet are exported, so clients learn a
+	// new key before it is used. Empty leaves the choice of key to --key and
+	// the signing backend.
+	SigningKeys []SigningKey
+
+	// KeyExpiryWarning is how long before a signing key or subkey expires
+	// signing starts to warn about it.
+	KeyExpiryWarning time.Duration
+
+	// URL is the address clients download the repository from.
+	URL string
+
+	// KeyringPackage configures the archive keyring package, which installs
+	// the signing keys and an APT source for the repository.
+	KeyringPackage KeyringPackageConfig
+
+	// Retention selects the package versions prune keeps.
+	Retention Retention
+
+	// Overrides holds per-distribution settings, keyed by distribution name.
+	// Use Dist to get the effective settings of a distribution.
+	Overrides map[string]DistConfig
+}
+
+// DistConfig holds the settings of a single distribution. Empty fields
+// inherit the repository-wide value.
+type DistConfig struct {
+	Suite         string
+	Codename      string
+	Label         string
+	Description   string
+	Architectures []string
+	Components    []string
+
+	// The remaining fields only exist per distribution and map to the
+	// Release fields of the same name.
+	Version              string
+	ValidFor             time.Duration // Valid-Until is Date plus this; zero omits it
+	NotAutomatic         bool
+	ButAutomaticUpgrades bool
+	SignedBy             []string // OpenPGP key fingerprints
+	Changelogs           string   // URL template containing @CHANGEPATH@, or "no"
+}
+
+// KeyringPackageConfig holds the settings of the archive keyring package.
+type KeyringPackageConfig struct {
+	Enabled bool
+	Name    string // Package name; default <origin>-archive-keyring
+	Suite   string // Distribution the APT source points at; default the first one
+}
+
+// KeyringPackageName returns the name of the archive keyring package.
+func (c Config) KeyringPackageName() string {
+	if c.KeyringPackage.Name != "" {
+		return c.KeyringPackage.Name
+	}
+	return packageNameFrom(c.Origin) + "-archive-keyring"
+}
+
+// KeyringPackageSuite returns the distribution the keyring package's APT
+// source points at.
+func (c Config) KeyringPackageSuite() string {
+	if c.KeyringPackage.Suite != "" {
+		return c.KeyringPackage.Suite
+	}
+	return c.Distributions[0]
+}
+
+// packageNameFrom lowercases s and replaces the characters a package name
+// cannot contain with hyphens.
+func packageNameFrom(s string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '+', r == '.', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		default:
+			return '-'
+		}
+	}, s)
+	return strings.Trim(name, "-.+")
+}
+
+// Retention holds the rules prune applies to each distribution. A version is
+// kept if anything applying to it keeps it; the newest version of every
+// package is always kept.
+type Retention struct {
+	Rules []RetentionRule // The first rule matching a package applies
+	Pins  []RetentionPin  // Versions that are never deleted
+}
+
+// RetentionRule selects the versions of matching packages to keep.
+type RetentionRule struct {
+	Package      string        // Package name or glob pattern; empty matches every package
+	Dists        []string      // Distributions the rule applies to; empty means all
+	Keep         int           // Newest versions to keep
+	KeepPerMajor int           // Newest versions to keep of each upstream major version
+	KeepFor      time.Duration // Keep versions added to a distribution more recently than this
+}
+
+// RetentionPin protects a package version from pruning.
+type RetentionPin struct {
+	Package string
+	Version string
+}
+
+// RetentionRule returns the rule that applies to a package in a
+// distribution, or nil if none does.
+func (c Config) RetentionRule(dist, name string) *RetentionRule {
+	for i, rule := range c.Retention.Rules {
+		if len(rule.Dists) > 0 && !contains(rule.Dists, dist) {
+			continue
+		}
+		if ok, _ := path.Match(rule.Package, name); ok || rule.Package == "" {
+			return &c.Retention.Rules[i]
+		}
+	}
+	return nil
+}
+
+// Pinned reports whether a package version is pinned.
+func (c Config) Pinned(name, version string) bool {
+	for _, pin := range c.Retention.Pins {
+		if pin.Package == name && deb.Compare(pin.Version, version) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// SigningKey is an entry of the key rotation schedule. Dates are UTC days.
+type SigningKey struct {
+	Fingerprint string
+	From        time.Time // First day the key signs; zero means no start date
+	Until       time.Time // Day the key stops signing and is no longer exported; zero means never
+}
+
+// signsAt reports whether the key signs at time t.
+func (k SigningKey) signsAt(t time.Time) bool {
+	return !t.Before(k.From) && !k.retiredAt(t)
+}
+
+// retiredAt reports whether the key is no longer used at time t.
+func (k SigningKey) retiredAt(t time.Time) bool {
+	return !k.Until.IsZero() && !t.Before(k.Until)
+}
+
+// SigningKeysAt returns the fingerprints of the scheduled keys that sign at
+// time t.
+func (c Config) SigningKeysAt(t time.Time) []string {
+	var keys []string
+	for _, k := range c.SigningKeys {
+		if k.signsAt(t) {
+			keys = append(keys, k.Fingerprint)
+		}
+	}
+	return keys
+}
+
+// PublishedKeysAt returns the fingerprints of the scheduled keys whose
+// public keys are exported at time t: those that sign at t or later.
+func (c Config) PublishedKeysAt(t time.Time) []string {
+	var keys []string
+	for _, k := range c.SigningKeys {
+		if !k.retiredAt(t) {
+			keys = append(keys, k.Fingerprint)
+		}
+	}
+	return keys
+}
+
+// Placement of Architecture: all packages in the Packages indices.
+const (
+	// ArchAllDuplicate lists them in every binary-<arch> index and writes
+	// no binary-all index. Every apt version understands this layout.
+	ArchAllDuplicate = "duplicate"
+	// ArchAllBoth also writes binary-all indices and marks the Release
+	// with No-Support-for-Architecture-all, so old clients keep working.
+	ArchAllBoth = "both"
+	// ArchAllSeparate lists them only in binary-all, keeping the
+	// architecture indices small. Requires apt 1.1 or later.
+	ArchAllSeparate = "separate"
+)
+
+// hasBinaryAll reports whether binary-all indices are written.
+func (c Config) hasBinaryAll() bool {
+	return c.ArchAll == ArchAllBoth || c.ArchAll == ArchAllSeparate
+}
+
+// DefaultConfig returns the default repository configuration.
+func DefaultConfig() Config {
+	return Config{
+		Origin:        "Frostyard",
+		Label:         "Frostyard",
+		Description:   "Frostyard Debian Repository",
+		Architectures: []string{"amd64"},
+		Components:    []string{"main"},
+		Distributions: []string{"stable", "testing"},
+		Contents:      true,
+		ArchAll:       ArchAllDuplicate,
+
+		ByHashRetention:  3,
+		KeyExpiryWarning: 30 * 24 * time.Hour,
+	}
+}
+
+// Dist returns the effective settings of a distribution, with inherited
+// values filled in. Suite and Codename default to the distribution name.
+func (c Config) Dist(name string) DistConfig {
+	d := c.Overrides[name]
+	if d.Suite == "" {
+		d.Suite = name
+	}
+	if d.Codename == "" {
+		d.Codename = name
+	}
+	if d.Label == "" {
+		d.Label = c.Label
+	}
+	if d.Description == "" {
+		d.Description = c.Description
+	}
+	if len(d.Architectures) == 0 {
+		d.Architectures = c.Architectures
+	}
+	if len(d.Components) == 0 {
+		d.Components = c.Components
+	}
+	return d
+}
+
+var (
+	archPattern        = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+	componentPattern   = regexp.MustCompile(`^[a-z0-9][a-z0-9.+-]*$`)
+	suitePattern       = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]*$`)
+	fingerprintPattern = regexp.MustCompile(`^([0-9A-Fa-f]{40}|[0-9A-Fa-f]{64})$`)
+	packageNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9+.-]+$`)
+)
+
+// Validate reports every problem with the configuration.
+func (c Config) Validate() error {
+	var errs []error
+	add := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.Origin == "" {
+		add("origin must not be empty")
+	}
+	if c.Label == "" {
+		add("label must not be empty")
+	}
+	if len(c.Distributions) == 0 {
+		add("at least one distribution is required")
+	}
+	errs = append(errs, validateArchitectures("", c.Architectures)...)
+	errs = append(errs, validateComponents("", c.Components)...)
+	for _, ext := range c.Compression {
+		if _, ok := compressionFormats[ext]; !ok {
+			add("unsupported compression %q", ext)
+		}
+	}
+	if c.ByHashRetention < 0 {
+		add("by_hash_retention must not be negative")
+	}
+	switch c.ArchAll {
+	case "", ArchAllDuplicate, ArchAllBoth, ArchAllSeparate:
+	default:
+		add("invalid architecture_all %q (want %s, %s or %s)",
+			c.ArchAll, ArchAllDuplicate, ArchAllBoth, ArchAllSeparate)
+	}
+	if c.KeyExpiryWarning < 0 {
+		add("key_expiry_warning must not be negative")
+	}
+	seenKeys := make(map[string]bool)
+	for _, k := range c.SigningKeys {
+		if !fingerprintPattern.MatchString(k.Fingerprint) {
+			add("signing key %q is not a full key fingerprint", k.Fingerprint)
+		}
+		if seenKeys[strings.ToUpper(k.Fingerprint)] {
+			add("signing key %s is listed more than once", k.Fingerprint)
+		}
+		seenKeys[strings.ToUpper(k.Fingerprint)] = true
+		if !k.From.IsZero() && !k.Until.IsZero() && !k.From.Before(k.Until) {
+			add("signing key %s: from must be before until", k.Fingerprint)
+		}
+	}
+
+	if c.URL != "" && !strings.HasPrefix(c.URL, "https://") &&
+		!strings.HasPrefix(c.URL, "http://") {
+		add("url must be an http or https URL")
+	}
+	if c.KeyringPackage.Enabled {
+		if c.URL == "" {
+			add("keyring_package requires url")
+		}
+		if name := c.KeyringPackageName(); !packageNamePattern.MatchString(name) {
+			add("keyring_package: invalid package name %q", name)
+		}
+		if c.KeyringPackage.Suite != "" && !contains(c.Distributions, c.KeyringPackage.Suite) {
+			add("keyring_package: unknown distribution %q", c.KeyringPackage.Suite)
+		}
+	}
+
+	for _, rule := range c.Retention.Rules {
+		if _, err := path.Match(rule.Package, ""); err != nil {
+			add("retention rule: invalid package pattern %q", rule.Package)
+		}
+		if rule.Keep < 0 || rule.KeepPerMajor < 0 || rule.KeepFor < 0 {
+			add("retention rule %q: keep counts must not be negative", rule.Package)
+		}
+		if rule.Keep == 0 && rule.KeepPerMajor == 0 && rule.KeepFor == 0 {
+			add("retention rule %q: needs keep, keep_per_major or keep_for", rule.Package)
+		}
+		for _, dist := range rule.Dists {
+			if !contains(c.Distributions, dist) {
+				add("retention rule %q: unknown distribution %q", rule.Package, dist)
+			}
+		}
+	}
+	for _, pin := range c.Retention.Pins {
+		if !packageNamePattern.MatchString(pin.Package) {
+			add("retention pin: invalid package name %q", pin.Package)
+		}
+		if _, err := deb.ParseVersion(pin.Version); err != nil {
+			add("retention pin %s: %v", pin.Package, err)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, dist := range c.Distributions {
+		if !suitePattern.MatchString(dist) {
+			add("invalid distribution name %q", dist)
+		}
+		if seen[dist] {
+			add("distribution %q is listed more than once", dist)
+		}
+		seen[dist] = true
+
+		d := c.Overrides[dist]
+		if d.Suite != "" && !suitePattern.MatchString(d.Suite) {
+			add("distribution %s: invalid suite %q", dist, d.Suite)
+		}
+		if d.Codename != "" && !suitePattern.MatchString(d.Codename) {
+			add("distribution %s: invalid codename %q", dist, d.Codename)
+		}
+		errs = append(errs, validateArchitectures(dist, d.Architectures)...)
+		errs = append(errs, validateComponents(dist, d.Components)...)
+		if strings.ContainsAny(d.Version, " \t\n") {
+			add("distribution %s: invalid version %q", dist, d.Version)
+		}
+		if d.ValidFor < 0 {
+			add("distribution %s: valid_for must not be negative", dist)
+		}
+		if d.ButAutomaticUpgrades && !d.NotAutomatic {
+			add("distribution %s: but_automatic_upgrades requires not_automatic", dist)
+		}
+		for _, fpr := range d.SignedBy {
+			if !fingerprintPattern.MatchString(fpr) {
+				add("distribution %s: signed_by entry %q is not a full key fingerprint", dist, fpr)
+			}
+		}
+		if d.Changelogs != "" && d.Changelogs != "no" &&
+			!strings.Contains(d.Changelogs, "@CHANGEPATH@") {
+			add("distribution %s: changelogs URL must contain @CHANGEPATH@", dist)
+		}
+	}
+	for dist := range c.Overrides {
+		if !seen[dist] {
+			add("settings given for unknown distribution %q", dist)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func validateArchitectures(dist string, archs []string) []error {
+	var errs []error
+	prefix := ""
+	if dist != "" {
+		prefix = "distribution " + dist + ": "
+	} else if len(archs) == 0 {
+		errs = append(errs, fmt.Errorf("at least one architecture is required"))
+	}
+	seen := make(map[string]bool)
+	for _, arch := range archs {
+		switch {
+		case arch == "all":
+			errs = append(errs, fmt.Errorf(
+				"%sarchitecture \"all\" is implied and must not be listed", prefix))
+		case !archPattern.MatchString(arch):
+			errs = append(errs, fmt.Errorf("%sinvalid architecture %q", prefix, arch))
+		case seen[arch]:
+			errs = append(errs, fmt.Errorf(
+				"%sarchitecture %q is listed more than once", prefix, arch))
+		}
+		seen[arch] = true
+	}
+	return errs
+}
+
+func validateComponents(dist string, comps []string) []error {
+	var errs []error
+	prefix := ""
+	if dist != "" {
+		prefix = "distribution " + dist + ": "
+	} else if len(comps) == 0 {
+		errs = append(errs, fmt.Errorf("at least one component is required"))
+	}
+	seen := make(map[string]bool)
+	for _, comp := range comps {
+		switch {
+		case !componentPattern.MatchString(comp):
+			errs = append(errs, fmt.Errorf("%sinvalid component %q", prefix, comp))
+		case seen[comp]:
+			errs = append(errs, fmt.Errorf("%scomponent %q is listed more than once", prefix, comp))
+		}
+		seen[comp] = true
+	}
+	return errs
+}
+
+// configFile is the on-disk layout of plow.yaml.
+type configFile struct {
+	Origin              string             `yaml:"origin"`
+	Label               string             `yaml:"label"`
+	Description         string             `yaml:"description"`
+	Architectures       []string           `yaml:"architectures,flow"`
+	Components          []string           `yaml:"components,flow"`
+	Contents            bool               `yaml:"contents"`
+	Compression         []string           `yaml:"compression,flow"`
+	StrictArchitectures bool               `yaml:"strict_architectures"`
+	ArchAll             string             `yaml:"architecture_all"`
+	AcquireByHash       bool               `yaml:"acquire_by_hash"`
+	ByHashRetention     int                `yaml:"by_hash_retention"`
+	KeyExpiryWarning    string             `yaml:"key_expiry_warning"`
+	SigningKeys         []keyFile          `yaml:"signing_keys,omitempty"`
+	URL                 string             `yaml:"url,omitempty"`
+	KeyringPackage      keyringPackageFile `yaml:"keyring_package,omitempty"`
+	Retention           retentionFile      `yaml:"retention,omitempty"`
+	Distributions       []distFile         `yaml:"distributions"`
+}
+
+type retentionFile struct {
+	Rules []retentionRuleFile `yaml:"rules,omitempty"`
+	Pins  []retentionPinFile  `yaml:"pins,omitempty"`
+}
+
+type retentionRuleFile struct {
+	Package      string   `yaml:"package,omitempty"`
+	Dists        []string `yaml:"dists,omitempty,flow"`
+	Keep         int      `yaml:"keep,omitempty"`
+	KeepPerMajor int      `yaml:"keep_per_major,omitempty"`
+	KeepFor      string   `yaml:"keep_for,omitempty"`
+}
+
+type retentionPinFile struct {
+	Package string `yaml:"package"`
+	Version string `yaml:"version"`
+}
+
+func (f retentionFile) config() (Retention, error) {
+	var ret Retention
+	for _, rf := range f.Rules {
+		rule := RetentionRule{
+			Package:      rf.Package,
+			Dists:        rf.Dists,
+			Keep:         rf.Keep,
+			KeepPerMajor: rf.KeepPerMajor,
+		}
+		if rf.KeepFor != "" {
+			var err error
+			if rule.KeepFor, err = parseDuration("keep_for", rf.KeepFor); err != nil {
+				return Retention{}, fmt.Errorf("retention rule %q: %w", rf.Package, err)
+			}
+		}
+		ret.Rules = append(ret.Rules, rule)
+	}
+	for _, pf := range f.Pins {
+		ret.Pins = append(ret.Pins, RetentionPin(pf))
+	}
+	return ret, nil
+}
+
+func newRetentionFile(r Retention) retentionFile {
+	var f retentionFile
+	for _, rule := range r.Rules {
+		rf := retentionRuleFile{
+			Package:      rule.Package,
+			Dists:        rule.Dists,
+			Keep:         rule.Keep,
+			KeepPerMajor: rule.KeepPerMajor,
+		}
+		if rule.KeepFor > 0 {
+			rf.KeepFor = formatDuration(rule.KeepFor)
+		}
+		f.Rules = append(f.Rules, rf)
+	}
+	for _, pin := range r.Pins {
+		f.Pins = append(f.Pins, retentionPinFile(pin))
+	}
+	return f
+}
+
+type keyringPackageFile struct {
+	Enabled bool   `yaml:"enabled"`
+	Name    string `yaml:"name,omitempty"`
+	Suite   string `yaml:"suite,omitempty"`
+}
+
+// dateFormat is the format of the dates in the key rotation schedule.
+const dateFormat = "2006-01-02"
+
+type keyFile struct {
+	Fingerprint string `yaml:"fingerprint"`
+	From        string `yaml:"from,omitempty"`
+	Until       string `yaml:"until,omitempty"`
+}
+
+func (f keyFile) config() (SigningKey, error) {
+	k := SigningKey{Fingerprint: f.Fingerprint}
+	var err error
+	if f.From != "" {
+		if k.From, err = time.Parse(dateFormat, f.From); err != nil {
+			return SigningKey{}, fmt.Errorf("signing key %s: invalid from date %q",
+				f.Fingerprint, f.From)
+		}
+	}
+	if f.Until != "" {
+		if k.Until, err = time.Parse(dateFormat, f.Until); err != nil {
+			return SigningKey{}, fmt.Errorf("signing key %s: invalid until date %q",
+				f.Fingerprint, f.Until)
+		}
+	}
+	return k, nil
+}
+
+func newKeyFile(k SigningKey) keyFile {
+	f := keyFile{Fingerprint: k.Fingerprint}
+	if !k.From.IsZero() {
+		f.From = k.From.Format(dateFormat)
+	}
+	if !k.Until.IsZero() {
+		f.Until = k.Until.Format(dateFormat)
+	}
+	return f
+}
+
+type distFile struct {
+	Name                 string   `yaml:"name"`
+	Suite                string   `yaml:"suite,omitempty"`
+	Codename             string   `yaml:"codename,omitempty"`
+	Label                string   `yaml:"label,omitempty"`
+	Description          string   `yaml:"description,omitempty"`
+	Architectures        []string `yaml:"architectures,omitempty,flow"`
+	Components           []string `yaml:"components,omitempty,flow"`
+	Version              string   `yaml:"version,omitempty"`
+	ValidFor             string   `yaml:"valid_for,omitempty"`
+	NotAutomatic         bool     `yaml:"not_automatic,omitempty"`
+	ButAutomaticUpgrades bool     `yaml:"but_automatic_upgrades,omitempty"`
+	SignedBy             []string `yaml:"signed_by,omitempty"`
+	Changelogs           string   `yaml:"changelogs,omitempty"`
+}
+
+func (f distFile) config() (DistConfig, error) {
+	var validFor time.Duration
+	if f.ValidFor != "" {
+		var err error
+		if validFor, err = parseDuration("valid_for", f.ValidFor); err != nil {
+			return DistConfig{}, fmt.Errorf("distribution %s: %w", f.Name, err)
+		}
+	}
+	return DistConfig{
+		Suite:                f.Suite,
+		Codename:             f.Codename,
+		Label:                f.Label,
+		Description:          f.Description,
+		Architectures:        f.Architectures,
+		Components:           f.Components,
+		Version:              f.Version,
+		ValidFor:             validFor,
+		NotAutomatic:         f.NotAutomatic,
+		ButAutomaticUpgrades: f.ButAutomaticUpgrades,
+		SignedBy:             f.SignedBy,
+		Changelogs:           f.Changelogs,
+	}, nil
+}
+
+func newDistFile(name string, d DistConfig) distFile {
+	f := distFile{
+		Name:                 name,
+		Suite:                d.Suite,
+		Codename:             d.Codename,
+		Label:                d.Label,
+		Description:          d.Description,
+		Architectures:        d.Architectures,
+		Components:           d.Components,
+		Version:              d.Version,
+		NotAutomatic:         d.NotAutomatic,
+		ButAutomaticUpgrades: d.ButAutomaticUpgrades,
+		SignedBy:             d.SignedBy,
+		Changelogs:           d.Changelogs,
+	}
+	if d.ValidFor > 0 {
+		f.ValidFor = formatDuration(d.ValidFor)
+	}
+	return f
+}
+
+// parseDuration parses a period setting such as valid_for. Besides Go
+// durations such as "36h" it accepts whole days, such as "7d".
+func parseDuration(field, s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid %s %q", field, s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s %q", field, s)
+	}
+	return d, nil
+}
+
+func formatDuration(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	return d.String()
+}
+
+// LoadConfig reads and validates a configuration file.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("read config: %w", err)
+	}
+	cfg, err := ParseConfig(data)
+	if err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// ParseConfig parses and validates configuration file contents. Top-level
+// settings that are not present keep their DefaultConfig values.
+func ParseConfig(data []byte) (Config, error) {
+	def := DefaultConfig()
+	f := configFile{
+		Origin:              def.Origin,
+		Label:               def.Label,
+		Description:         def.Description,
+		Architectures:       def.Architectures,
+		Components:          def.Components,
+		Contents:            def.Contents,
+		Compression:         def.Compression,
+		StrictArchitectures: def.StrictArchitectures,
+		ArchAll:             def.ArchAll,
+		AcquireByHash:       def.AcquireByHash,
+		ByHashRetention:     def.ByHashRetention,
+		KeyExpiryWarning:    formatDuration(def.KeyExpiryWarning),
+	}
+	for _, dist := range def.Distributions {
+		f.Distributions = append(f.Distributions, distFile{Name: dist})
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+		return Config{}, fmt.Errorf("parse config: %w", err)
+	}
+
+	cfg := Config{
+		Origin:        f.Origin,
+		Label:         f.Label,
+		Description:   f.Description,
+		Architectures: f.Architectures,
+		Components:    f.Components,
+		Contents:      f.Contents,
+		Compression:   f.Compression,
+
+		StrictArchitectures: f.StrictArchitectures,
+		ArchAll:             f.ArchAll,
+		AcquireByHash:       f.AcquireByHash,
+		ByHashRetention:     f.ByHashRetention,
+
+		URL:            f.URL,
+		KeyringPackage: KeyringPackageConfig(f.KeyringPackage),
+	}
+	if f.KeyExpiryWarning != "" {
+		var err error
+		cfg.KeyExpiryWarning, err = parseDuration("key_expiry_warning", f.KeyExpiryWarning)
+		if err != nil {
+			return Config{}, err
+		}
+	}
+	for _, k := range f.SigningKeys {
+		key, err := k.config()
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.SigningKeys = append(cfg.SigningKeys, key)
+	}
+	retention, err := f.Retention.config()
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.Retention = retention
+	for _, d := range f.Distributions {
+		if d.Name == "" {
+			return Config{}, fmt.Errorf("distribution entry without a name")
+		}
+		cfg.Distributions = append(cfg.Distributions, d.Name)
+		override, err := d.config()
+		if err != nil {
+			return Config{}, err
+		}
+		if !reflect.ValueOf(override).IsZero() {
+			if cfg.Overrides == nil {
+				cfg.Overrides = make(map[string]DistConfig)
+			}
+			cfg.Overrides[d.Name] = override
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid config:\n%w", err)
+	}
+	return cfg, nil
+}
+
+// Effective returns a copy of the configuration with the settings of every
+// distribution fully resolved, as Dist would report them.
+func (c Config) Effective() Config {
+	out := c
+	out.Overrides = make(map[string]DistConfig, len(c.Distributions))
+	for _, dist := range c.Distributions {
+		out.Overrides[dist] = c.Dist(dist)
+	}
+	return out
+}
+
+// Marshal encodes the configuration in the plow.yaml format.
+func (c Config) Marshal() ([]byte, error) {
+	f := configFile{
+		Origin:              c.Origin,
+		Label:               c.Label,
+		Description:         c.Description,
+		Architectures:       c.Architectures,
+		Components:          c.Components,
+		Contents:            c.Contents,
+		Compression:         c.Compression,
+		StrictArchitectures: c.StrictArchitectures,
+		ArchAll:             c.ArchAll,
+		AcquireByHash:       c.AcquireByHash,
+		ByHashRetention:     c.ByHashRetention,
+		URL:                 c.URL,
+		KeyringPackage:      keyringPackageFile(c.KeyringPackage),
+		Retention:           newRetentionFile(c.Retention),
+	}
+	if c.KeyExpiryWarning > 0 {
+		f.KeyExpiryWarning = formatDuration(c.KeyExpiryWarning)
+	}
+	for _, k := range c.SigningKeys {
+		f.SigningKeys = append(f.SigningKeys, newKeyFile(k))
+	}
+	for _, dist := range c.Distributions {
+		f.Distributions = append(f.Distributions, newDistFile(dist, c.Overrides[dist]))
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(f); err != nil {
+		return nil, fmt.Errorf("encode config: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("encode config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,244 @@
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseConfigDefaults(t *testing.T) {
+	cfg, err := ParseConfig([]byte("origin: Acme\n"))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+
+	want := DefaultConfig()
+	want.Origin = "Acme"
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("ParseConfig() = %+v, want %+v", cfg, want)
+	}
+
+	empty, err := ParseConfig(nil)
+	if err != nil {
+		t.Fatalf("ParseConfig(nil): %v", err)
+	}
+	if !reflect.DeepEqual(empty, DefaultConfig()) {
+		t.Errorf("ParseConfig(nil) = %+v, want defaults", empty)
+	}
+}
+
+func TestParseConfigOverrides(t *testing.T) {
+	data := `origin: Acme
+label: Acme
+architectures: [amd64, arm64]
+distributions:
+  - name: stable
+    codename: trixie
+    components: [main, contrib]
+  - name: testing
+    label: Acme Testing
+    architectures: [arm64]
+`
+	cfg, err := ParseConfig([]byte(data))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+
+	if want := []string{"stable", "testing"}; !reflect.DeepEqual(cfg.Distributions, want) {
+		t.Errorf("Distributions = %v, want %v", cfg.Distributions, want)
+	}
+
+	stable := cfg.Dist("stable")
+	want := DistConfig{
+		Suite:         "stable",
+		Codename:      "trixie",
+		Label:         "Acme",
+		Description:   "Frostyard Debian Repository",
+		Architectures: []string{"amd64", "arm64"},
+		Components:    []string{"main", "contrib"},
+	}
+	if !reflect.DeepEqual(stable, want) {
+		t.Errorf("Dist(stable) = %+v, want %+v", stable, want)
+	}
+
+	testingDist := cfg.Dist("testing")
+	if testingDist.Label != "Acme Testing" || !reflect.DeepEqual(testingDist.Architectures, []string{"arm64"}) {
+		t.Errorf("Dist(testing) = %+v", testingDist)
+	}
+	if !reflect.DeepEqual(testingDist.Components, []string{"main"}) {
+		t.Errorf("Dist(testing).Components = %v, want inherited [main]", testingDist.Components)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := map[string]struct {
+		data string
+		want string
+	}{
+		"unknown field":    {"origin: Acme\norgin: typo\n", "orgin"},
+		"no archs":         {"architectures: []\n", "at least one architecture"},
+		"arch all":         {"architectures: [amd64, all]\n", `"all" is implied`},
+		"bad arch":         {"architectures: [AMD64]\n", "invalid architecture"},
+		"duplicate comp":   {"components: [main, main]\n", `component "main" is listed more than once`},
+		"compression":      {"compression: [zip]\n", `unsupported compression "zip"`},
+		"duplicate dist":   {"distributions:\n  - name: stable\n  - name: stable\n", "listed more than once"},
+		"unnamed dist":     {"distributions:\n  - codename: trixie\n", "without a name"},
+		"bad dist name":    {"distributions:\n  - name: ../etc\n", "invalid distribution name"},
+		"bad dist arch":    {"distributions:\n  - name: stable\n    architectures: [all]\n", "distribution stable:"},
+		"empty origin":     {"origin: \"\"\n", "origin must not be empty"},
+		"no dists listed":  {"distributions: []\n", "at least one distribution"},
+		"valid for":        {"distributions:\n  - name: stable\n    valid_for: 1w\n", `invalid valid_for "1w"`},
+		"automatic":        {"distributions:\n  - name: stable\n    but_automatic_upgrades: true\n", "requires not_automatic"},
+		"signed by":        {"distributions:\n  - name: stable\n    signed_by: [DEADBEEF]\n", "not a full key fingerprint"},
+		"changelogs":       {"distributions:\n  - name: stable\n    changelogs: https://example.com/\n", "@CHANGEPATH@"},
+		"architecture all": {"architecture_all: split\n", `invalid architecture_all "split"`},
+		"key expiry":       {"key_expiry_warning: soon\n", `invalid key_expiry_warning "soon"`},
+		"signing key":      {"signing_keys:\n  - fingerprint: DEADBEEF\n", "not a full key fingerprint"},
+		"signing key date": {"signing_keys:\n  - fingerprint: " + testFingerprint + "\n    from: 1/11/2026\n", "invalid from date"},
+		"signing key dup":  {"signing_keys:\n  - fingerprint: " + testFingerprint + "\n  - fingerprint: " + testFingerprint + "\n", "listed more than once"},
+		"keyring url":      {"keyring_package:\n  enabled: true\n", "keyring_package requires url"},
+		"keyring suite":    {"url: https://example.com\nkeyring_package:\n  enabled: true\n  suite: sid\n", `unknown distribution "sid"`},
+		"keyring name":     {"url: https://example.com\nkeyring_package:\n  enabled: true\n  name: Acme_Keys\n", "invalid package name"},
+		"retention keep":   {"retention:\n  rules:\n    - package: foo\n", "needs keep, keep_per_major or keep_for"},
+		"retention glob":   {"retention:\n  rules:\n    - package: \"[\"\n      keep: 1\n", "invalid package pattern"},
+		"retention age":    {"retention:\n  rules:\n    - keep_for: month\n", `invalid keep_for "month"`},
+		"retention dist":   {"retention:\n  rules:\n    - dists: [sid]\n      keep: 1\n", `unknown distribution "sid"`},
+		"retention pin":    {"retention:\n  pins:\n    - package: myapp\n      version: v1\n", "retention pin myapp"},
+		"signing key span": {"signing_keys:\n  - fingerprint: " + testFingerprint + "\n    from: 2026-11-01\n    until: 2026-10-01\n", "from must be before until"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseConfig([]byte(tc.data))
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("error = %v, want it to mention %q", err, tc.want)
+			}
+		})
+	}
+}
+
+const testFingerprint = "0123456789ABCDEF0123456789ABCDEF01234567"
+
+func TestConfigSigningKeys(t *testing.T) {
+	data := `key_expiry_warning: 14d
+signing_keys:
+  - fingerprint: 0123456789ABCDEF0123456789ABCDEF01234567
+    until: 2026-12-01
+  - fingerprint: 89ABCDEF0123456789ABCDEF0123456789ABCDEF
+    from: 2026-11-01
+`
+	cfg, err := ParseConfig([]byte(data))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	if cfg.KeyExpiryWarning != 14*24*time.Hour {
+		t.Errorf("KeyExpiryWarning = %v, want 14 days", cfg.KeyExpiryWarning)
+	}
+
+	oldKey, newKey := cfg.SigningKeys[0].Fingerprint, cfg.SigningKeys[1].Fingerprint
+	tests := []struct {
+		date      string
+		signing   []string
+		published []string
+	}{
+		{"2026-10-15", []string{oldKey}, []string{oldKey, newKey}},
+		{"2026-11-01", []string{oldKey, newKey}, []string{oldKey, newKey}},
+		{"2026-12-01", []string{newKey}, []string{newKey}},
+	}
+	for _, tt := range tests {
+		at, _ := time.Parse(time.DateOnly, tt.date)
+		at = at.Add(12 * time.Hour)
+		if got := cfg.SigningKeysAt(at); !reflect.DeepEqual(got, tt.signing) {
+			t.Errorf("SigningKeysAt(%s) = %v, want %v", tt.date, got, tt.signing)
+		}
+		if got := cfg.PublishedKeysAt(at); !reflect.DeepEqual(got, tt.published) {
+			t.Errorf("PublishedKeysAt(%s) = %v, want %v", tt.date, got, tt.published)
+		}
+	}
+}
+
+func TestConfigMarshalRoundTrip(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Compression = []string{"gz"}
+	cfg.KeyExpiryWarning = 60 * 24 * time.Hour
+	cfg.URL = "https://example.com/apt"
+	cfg.KeyringPackage = KeyringPackageConfig{Enabled: true, Name: "acme-keyring", Suite: "testing"}
+	cfg.Retention = Retention{
+		Rules: []RetentionRule{
+			{Package: "frostyard-*", Keep: 3, KeepPerMajor: 1},
+			{Dists: []string{"testing"}, KeepFor: 30 * 24 * time.Hour},
+		},
+		Pins: []RetentionPin{{Package: "myapp", Version: "1:2.0-1"}},
+	}
+	cfg.SigningKeys = []SigningKey{
+		{Fingerprint: testFingerprint, Until: time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC)},
+		{Fingerprint: "89ABCDEF0123456789ABCDEF0123456789ABCDEF", From: time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	cfg.Overrides = map[string]DistConfig{
+		"stable": {Codename: "trixie", Components: []string{"main", "contrib"}},
+		"testing": {
+			ValidFor:             7 * 24 * time.Hour,
+			NotAutomatic:         true,
+			ButAutomaticUpgrades: true,
+			SignedBy:             []string{"0123456789ABCDEF0123456789ABCDEF01234567"},
+			Changelogs:           "https://example.com/@CHANGEPATH@",
+			Version:              "2",
+		},
+	}
+
+	data, err := cfg.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	got, err := ParseConfig(data)
+	if err != nil {
+		t.Fatalf("ParseConfig: %v\n%s", err, data)
+	}
+	if !reflect.DeepEqual(got, cfg) {
+		t.Errorf("round trip = %+v, want %+v", got, cfg)
+	}
+
+	// The effective form resolves inherited values but means the same thing
+	effective, err := cfg.Effective().Marshal()
+	if err != nil {
+		t.Fatalf("Marshal effective: %v", err)
+	}
+	got, err = ParseConfig(effective)
+	if err != nil {
+		t.Fatalf("ParseConfig effective: %v\n%s", err, effective)
+	}
+	for _, dist := range cfg.Distributions {
+		if !reflect.DeepEqual(got.Dist(dist), cfg.Dist(dist)) {
+			t.Errorf("effective Dist(%s) = %+v, want %+v", dist, got.Dist(dist), cfg.Dist(dist))
+		}
+	}
+}
+
+func TestGenerateReleaseUsesDistConfig(t *testing.T) {
+	r := newTestRepo(t)
+	r.Config.Overrides = map[string]DistConfig{
+		"stable": {Codename: "trixie", Label: "Acme Stable"},
+	}
+	if err := r.GeneratePackagesIndex("stable"); err != nil {
+		t.Fatalf("GeneratePackagesIndex: %v", err)
+	}
+	if err := r.GenerateRelease("stable"); err != nil {
+		t.Fatalf("GenerateRelease: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(r.Root, "dists", "stable", "Release"))
+	if err != nil {
+		t.Fatalf("read Release: %v", err)
+	}
+	for _, line := range []string{"Suite: stable", "Codename: trixie", "Label: Acme Stable"} {
+		if !strings.Contains(string(data), line+"\n") {
+			t.Errorf("Release missing %q:\n%s", line, data)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package repo
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/frostyard/plow/internal/deb"
+)
+
+// generateContents writes dists/<dist>/<comp>/Contents-<arch>, mapping every
+// file shipped by the given packages to the packages that contain it.
+func (r *Repository) generateContents(dist, comp, arch string, packages []*deb.Package) error {
+	owners := make(map[string]map[string]bool)
+	for _, pkg := range packages {
+		files, err := r.poolFileList(pkg.Filename)
+		if err != nil {
+			return err
+		}
+
+		location := pkg.Name
+		if pkg.Section != "" {
+			location = pkg.Section + "/" + pkg.Name
+		}
+		for _, f := range files {
+			if owners[f] == nil {
+				owners[f] = make(map[string]bool)
+			}
+			owners[f][location] = true
+		}
+	}
+
+	paths := make([]string, 0, len(owners))
+	for p := range owners {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var content strings.Builder
+	for _, p := range paths {
+		locations := make([]string, 0, len(owners[p]))
+		for l := range owners[p] {
+			locations = append(locations, l)
+		}
+		sort.Strings(locations)
+		fmt.Fprintf(&content, "%-59s %s\n", p, strings.Join(locations, ","))
+	}
+
+	path := filepath.Join(r.Root, "dists", dist, comp, "Contents-"+arch)
+	if err := r.writeIndexFile(path, []byte(content.String())); err != nil {
+		return fmt.Errorf("write Contents-%s: %w", arch, err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package repo
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateContents(t *testing.T) {
+	r := newTestRepo(t)
+	r.Config.Compression = []string{"gz"}
+	src := t.TempDir()
+
+	if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, "myapp", "1.0", "amd64", "Section: utils"), Dist: "stable"}); err != nil {
+		t.Fatalf("add myapp: %v", err)
+	}
+	if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, "tool", "1.0", "all"), Dist: "stable"}); err != nil {
+		t.Fatalf("add tool: %v", err)
+	}
+	if err := r.GeneratePackagesIndex("stable"); err != nil {
+		t.Fatalf("generate index: %v", err)
+	}
+
+	contentsPath := filepath.Join(r.Root, "dists", "stable", "main", "Contents-amd64")
+	data, err := os.ReadFile(contentsPath)
+	if err != nil {
+		t.Fatalf("read Contents: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), data)
+	}
+	for i, want := range [][2]string{{"usr/bin/myapp", "utils/myapp"}, {"usr/bin/tool", "tool"}} {
+		fields := strings.Fields(lines[i])
+		if len(fields) != 2 || fields[0] != want[0] || fields[1] != want[1] {
+			t.Errorf("line %d = %q, want %s -> %s", i, lines[i], want[0], want[1])
+		}
+	}
+
+	f, err := os.Open(contentsPath + ".gz")
+	if err != nil {
+		t.Fatalf("open Contents.gz: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("open gzip: %v", err)
+	}
+	unzipped, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("read gzip: %v", err)
+	}
+	if string(unzipped) != string(data) {
+		t.Error("Contents.gz does not match Contents")
+	}
+
+	if err := r.GenerateRelease("stable"); err != nil {
+		t.Fatalf("generate release: %v", err)
+	}
+	release, err := os.ReadFile(filepath.Join(r.Root, "dists", "stable", "Release"))
+	if err != nil {
+		t.Fatalf("read Release: %v", err)
+	}
+	for _, name := range []string{"main/Contents-amd64", "main/Contents-amd64.gz"} {
+		if !strings.Contains(string(release), " "+name+"\n") {
+			t.Errorf("Release missing %s", name)
+		}
+	}
+
+	// Disabling compression removes the stale variant
+	r.Config.Compression = nil
+	if err := r.GeneratePackagesIndex("stable"); err != nil {
+		t.Fatalf("regenerate index: %v", err)
+	}
+	if _, err := os.Stat(contentsPath + ".gz"); !os.IsNotExist(err) {
+		t.Error("Contents-amd64.gz still exists after disabling compression")
+	}
+}
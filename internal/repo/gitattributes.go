@@ -0,0 +1,67 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	gitAttributesBegin = "# BEGIN plow: index files must not be stored in Git LFS, or GitHub Pages serves the pointers"
+	gitAttributesEnd   = "# END plow"
+)
+
+// updateGitAttributes maintains plow's block at the end of the repository's
+// .gitattributes. The block unsets the LFS filter for compressed indices and
+// by-hash copies, overriding broader LFS rules earlier in the file. It is
+// removed when no such files are generated.
+func (r *Repository) updateGitAttributes() error {
+	path := filepath.Join(r.Root, ".gitattributes")
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("read .gitattributes: %w", err)
+	}
+	existed := err == nil
+
+	// Keep everything outside plow's block
+	var kept []string
+	inBlock := false
+	for _, line := range strings.Split(string(data), "\n") {
+		switch {
+		case line == gitAttributesBegin:
+			inBlock = true
+		case line == gitAttributesEnd && inBlock:
+			inBlock = false
+		case !inBlock:
+			kept = append(kept, line)
+		}
+	}
+	content := strings.TrimRight(strings.Join(kept, "\n"), "\n")
+
+	var rules []string
+	for _, ext := range slices.Sorted(slices.Values(r.Config.Compression)) {
+		rules = append(rules, fmt.Sprintf("dists/**/*.%s -filter -diff -merge binary", ext))
+	}
+	if r.Config.AcquireByHash {
+		rules = append(rules, "dists/**/"+byHashDir+"/** -filter -diff -merge binary")
+	}
+	if len(rules) > 0 {
+		if content != "" {
+			content += "\n\n"
+		}
+		content += gitAttributesBegin + "\n" + strings.Join(rules, "\n") + "\n" + gitAttributesEnd
+	}
+	if content != "" {
+		content += "\n"
+	}
+
+	if content == string(data) || (!existed && content == "") {
+		return nil
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("write .gitattributes: %w", err)
+	}
+	return nil
+}
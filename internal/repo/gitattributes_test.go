@@ -0,0 +1,74 @@
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpdateGitAttributes(t *testing.T) {
+	r := New(t.TempDir(), DefaultConfig())
+	path := filepath.Join(r.Root, ".gitattributes")
+	original := "*.deb filter=lfs diff=lfs merge=lfs -text\n*.gz filter=lfs diff=lfs merge=lfs -text\n"
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r.Config.Compression = []string{"xz", "gz"}
+	r.Config.AcquireByHash = true
+	for i := 0; i < 2; i++ {
+		if err := r.updateGitAttributes(); err != nil {
+			t.Fatalf("updateGitAttributes: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := original + "\n" + gitAttributesBegin + "\n" +
+		"dists/**/*.gz -filter -diff -merge binary\n" +
+		"dists/**/*.xz -filter -diff -merge binary\n" +
+		"dists/**/by-hash/** -filter -diff -merge binary\n" +
+		gitAttributesEnd + "\n"
+	if string(data) != want {
+		t.Errorf(".gitattributes =\n%s\nwant\n%s", data, want)
+	}
+
+	// Without compressed indices the block goes away again
+	r.Config.Compression = nil
+	r.Config.AcquireByHash = false
+	if err := r.updateGitAttributes(); err != nil {
+		t.Fatalf("updateGitAttributes: %v", err)
+	}
+	data, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != original {
+		t.Errorf(".gitattributes = %q, want the original rules", data)
+	}
+}
+
+func TestUpdateGitAttributesNoFile(t *testing.T) {
+	r := New(t.TempDir(), DefaultConfig())
+	if err := r.updateGitAttributes(); err != nil {
+		t.Fatalf("updateGitAttributes: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(r.Root, ".gitattributes")); !os.IsNotExist(err) {
+		t.Error(".gitattributes created although nothing needs managing")
+	}
+
+	r.Config.Compression = []string{"gz"}
+	if err := r.updateGitAttributes(); err != nil {
+		t.Fatalf("updateGitAttributes: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(r.Root, ".gitattributes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), gitAttributesBegin+"\n") {
+		t.Errorf(".gitattributes = %q", data)
+	}
+}
@@ -2,6 +2,7 @@
 package repo
 
 import (
+	"bytes"
 	"fmt"
 	"html/template"
 	"os"
@@ -32,6 +33,7 @@ const htmlTemplate = `<!DOCTYPE html>
   <style>
     body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; max-width: 900px; margin: 50px auto; padding: 0 20px; line-height: 1.6; }
     h1 { border-bottom: 2px solid #eee; padding-bottom: 10px; font-size: 1.5em; }
+    h2 { font-size: 1.2em; margin-top: 2em; }
     table { width: 100%; border-collapse: collapse; }
     th, td { text-align: left; padding: 8px 12px; border-bottom: 1px solid #eee; }
     th { background: #f8f8f8; font-weight: 600; }
@@ -73,6 +75,27 @@ const htmlTemplate = `<!DOCTYPE html>
       {{end}}
     </tbody>
   </table>
+  {{if .Packages}}
+  <h2>Packages in {{.Dist}}</h2>
+  <table>
+    <thead>
+      <tr>
+        <th>Package</th>
+        <th>Version</th>
+        <th>Architecture</th>
+      </tr>
+    </thead>
+    <tbody>
+      {{range .Packages}}
+      <tr>
+        <td><span class="icon">📦</span><a href="{{.Link}}">{{.Name}}</a></td>
+        <td>{{.Version}}</td>
+        <td>{{.Architecture}}</td>
+      </tr>
+      {{end}}
+    </tbody>
+  </table>
+  {{end}}
 </body>
 </html>
 `
@@ -89,12 +112,22 @@ type FileEntry struct {
 	Icon string
 }
 
+// PackageEntry represents a package version that belongs to a distribution.
+type PackageEntry struct {
+	Name         string
+	Version      string
+	Architecture string
+	Link         string // Relative link to the pool file
+}
+
 // IndexData holds data for rendering an HTML index page.
 type IndexData struct {
 	Path        string
 	ShowParent  bool
 	Directories []DirectoryEntry
 	Files       []FileEntry
+	Dist        string         // Set on a distribution's top-level page
+	Packages    []PackageEntry // Members of Dist
 }
 
 // GenerateHTMLIndexes creates index.html files in all repository directories
@@ -110,8 +143,8 @@ func (r *Repository) GenerateHTMLIndexes() error {
 			return nil
 		}
 
-		// Skip hidden directories (like .git)
-		if strings.HasPrefix(info.Name(), ".") && path != r.Root {
+		// Skip hidden directories (like .git) and by-hash copies
+		if (strings.HasPrefix(info.Name(), ".") || info.Name() == byHashDir) && path != r.Root {
 			return filepath.SkipDir
 		}
 
@@ -131,8 +164,8 @@ func (r *Repository) generateIndexForDirectory(dirPath string) error {
 	for _, entry := range entries {
 		name := entry.Name()
 
-		// Skip hidden files and the index.html we're generating
-		if strings.HasPrefix(name, ".") || name == "index.html" {
+		// Skip hidden files, by-hash copies and the index.html we're generating
+		if strings.HasPrefix(name, ".") || name == byHashDir || name == "index.html" {
 			continue
 		}
 
@@ -180,20 +213,66 @@ func (r *Repository) generateIndexForDirectory(dirPath string) error {
 		Files:       files,
 	}
 
-	indexPath := filepath.Join(dirPath, "index.html")
-	f, err := os.Create(indexPath)
-	if err != nil {
-		return fmt.Errorf("create index.html: %w", err)
+	// A distribution's page also lists the packages it serves, since the
+	// pool directories are shared between all distributions.
+	if dist := r.distForDirectory(dirPath); dist != "" {
+		packages, err := r.distPackageEntries(dist)
+		if err != nil {
+			return err
+		}
+		data.Dist = dist
+		data.Packages = packages
 	}
-	defer f.Close() //nolint:errcheck // Write errors caught by template.Execute
 
-	if err := getHTMLTemplate().Execute(f, data); err != nil {
+	var buf bytes.Buffer
+	if err := getHTMLTemplate().Execute(&buf, data); err != nil {
 		return fmt.Errorf("execute template: %w", err)
 	}
 
+	indexPath := filepath.Join(dirPath, "index.html")
+	if _, err := writeFileIfChanged(indexPath, buf.Bytes()); err != nil {
+		return fmt.Errorf("write index.html: %w", err)
+	}
+
 	return nil
 }
 
+// distForDirectory returns the distribution whose top-level directory is
+// dirPath, or "" if dirPath is not a distribution directory.
+func (r *Repository) distForDirectory(dirPath string) string {
+	for _, dist := range r.Config.Distributions {
+		if dirPath == filepath.Join(r.Root, "dists", dist) {
+			return dist
+		}
+	}
+	return ""
+}
+
+func (r *Repository) distPackageEntries(dist string) ([]PackageEntry, error) {
+	m, err := r.LoadManifest(dist)
+	if err != nil {
+		return nil, err
+	}
+	m.sort()
+
+	var packages []PackageEntry
+	for _, e := range m.Packages {
+		packages = append(packages, PackageEntry{
+			Name:         e.Name,
+			Version:      e.Version,
+			Architecture: e.Architecture,
+			Link:         "../../" + e.Filename,
+		})
+	}
+	return packages, nil
+}
+
+// FormatSize formats a byte count the way the HTML index pages show it, such
+// as "1.5 MB".
+func FormatSize(size int64) string {
+	return formatSize(size)
+}
+
 func formatSize(size int64) string {
 	const (
 		KB = 1024
@@ -0,0 +1,201 @@
+package repo
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/frostyard/plow/internal/deb"
+)
+
+// KeyringPackageResult describes the outcome of UpdateKeyringPackage.
+type KeyringPackageResult struct {
+	Name    string
+	Version string   // Version of the package the distributions now serve
+	Built   bool     // Whether a new version was built
+	Dists   []string // Distributions the package was added to: none, or its suite
+}
+
+// UpdateKeyringPackage publishes the archive keyring package with the given
+// binary keyring. The package installs the keyring under
+// /usr/share/keyrings and an APT source that uses it, so clients that have
+// it installed receive new signing keys with apt upgrade. A new version is
+// built only when the keyring or the APT source differ from the newest
+// published version. The package is only published in the distribution its
+// APT source names, so installing it never switches a client to another
+// suite; if that distribution does not serve the version yet, it gets it and
+// has its Packages and Release files regenerated.
+func (r *Repository) UpdateKeyringPackage(keyring []byte) (*KeyringPackageResult, error) {
+	name := r.Config.KeyringPackageName()
+	files := r.keyringPackageFiles(name, keyring)
+	result := &KeyringPackageResult{Name: name}
+
+	manifests := make(map[string]*Manifest)
+	var latest *ManifestEntry
+	for _, dist := range r.Config.Distributions {
+		m, err := r.LoadManifest(dist)
+		if err != nil {
+			return nil, err
+		}
+		manifests[dist] = m
+		for i, e := range m.Packages {
+			if e.Name == name && e.Architecture == "all" && (latest == nil || deb.Compare(e.Version, latest.Version) > 0) {
+				latest = &m.Packages[i]
+			}
+		}
+	}
+
+	var source string // .deb to add to the distributions that lack it
+	if latest != nil {
+		current, err := r.hasFiles(latest.Filename, files)
+		if err != nil {
+			return nil, err
+		}
+		if current {
+			result.Version = latest.Version
+			source = filepath.Join(r.Root, latest.Filename)
+		}
+	}
+	if source == "" {
+		result.Version = "1"
+		if latest != nil {
+			n, err := strconv.Atoi(latest.Version)
+			if err != nil {
+				return nil, fmt.Errorf("cannot increment %s version %s", name, latest.Version)
+			}
+			result.Version = strconv.Itoa(n + 1)
+		}
+		result.Built = true
+	}
+
+	suite := r.Config.KeyringPackageSuite()
+	for _, e := range manifests[suite].Packages {
+		if e.Name == name && e.Version == result.Version && e.Architecture == "all" {
+			return result, nil
+		}
+	}
+
+	// AddPackage copies the file into the pool, so it is added from a
+	// temporary copy named like its pool file
+	tmp, err := os.MkdirTemp("", "plow-keyring-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp) //nolint:errcheck // Temporary files, removal failure is not critical
+
+	debPath := filepath.Join(tmp, fmt.Sprintf("%s_%s_all.deb", name, result.Version))
+	if result.Built {
+		data, err := r.buildKeyringPackage(name, result.Version, files)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(debPath, data, 0644); err != nil {
+			return nil, err
+		}
+	} else if err := copyFile(source, debPath); err != nil {
+		return nil, fmt.Errorf("copy %s: %w", name, err)
+	}
+
+	if _, err := r.AddPackage(AddOptions{Path: debPath, Dist: suite}); err != nil {
+		return nil, fmt.Errorf("add %s to %s: %w", name, suite, err)
+	}
+	if err := r.GeneratePackagesIndex(suite); err != nil {
+		return nil, fmt.Errorf("generate packages index for %s: %w", suite, err)
+	}
+	if err := r.GenerateRelease(suite); err != nil {
+		return nil, fmt.Errorf("generate release for %s: %w", suite, err)
+	}
+	result.Dists = append(result.Dists, suite)
+	return result, nil
+}
+
+// keyringPackageFiles returns the files the archive keyring package
+// installs: the keyring and a deb822 APT source that is signed by it.
+func (r *Repository) keyringPackageFiles(name string, keyring []byte) []deb.File {
+	keyringPath := "/usr/share/keyrings/" + name + ".gpg"
+	d := r.Config.Dist(r.Config.KeyringPackageSuite())
+
+	source := &deb.Stanza{}
+	source.Set("Types", "deb")
+	source.Set("URIs", strings.TrimSuffix(r.Config.URL, "/"))
+	source.Set("Suites", d.Suite)
+	source.Set("Components", strings.Join(d.Components, " "))
+	source.Set("Signed-By", keyringPath)
+
+	return []deb.File{
+		{Path: keyringPath, Mode: 0644, Data: keyring},
+		{
+			Path:     "/etc/apt/sources.list.d/" + strings.TrimSuffix(name, "-archive-keyring") + ".sources",
+			Mode:     0644,
+			Data:     []byte(source.String()),
+			Conffile: true,
+		},
+	}
+}
+
+// hasFiles reports whether a pool file installs exactly the given files.
+func (r *Repository) hasFiles(poolFile string, files []deb.File) (bool, error) {
+	want := make(map[string][]byte)
+	for _, f := range files {
+		want[f.Path] = f.Data
+	}
+
+	found := 0
+	match := true
+	err := deb.WalkData(filepath.Join(r.Root, poolFile), func(hdr *tar.Header, rd io.Reader) error {
+		if hdr.Typeflag == tar.TypeDir {
+			return nil
+		}
+		data, ok := want[path.Clean("/"+hdr.Name)]
+		if !ok {
+			match = false
+			return nil
+		}
+		content, err := io.ReadAll(rd)
+		if err != nil {
+			return err
+		}
+		found++
+		if !bytes.Equal(content, data) {
+			match = false
+		}
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("read %s: %w", poolFile, err)
+	}
+	return match && found == len(want), nil
+}
+
+// buildKeyringPackage builds a version of the archive keyring package.
+func (r *Repository) buildKeyringPackage(name, version string, files []deb.File) ([]byte, error) {
+	date, _, err := releaseDate()
+	if err != nil {
+		return nil, err
+	}
+
+	control := &deb.Stanza{}
+	control.Set("Package", name)
+	control.Set("Version", version)
+	control.Set("Architecture", "all")
+	control.Set("Maintainer", r.Config.Origin)
+	control.Set("Section", "misc")
+	control.Set("Priority", "optional")
+	control.Set("Multi-Arch", "foreign")
+	control.Set("Description", fmt.Sprintf("OpenPGP archive keys of the %s repository\n"+
+		" This package installs the keys that sign the %s package repository\n"+
+		" and an APT source that uses them. New signing keys arrive as\n"+
+		" upgrades of this package.", r.Config.Label, r.Config.Label))
+
+	var buf bytes.Buffer
+	if err := deb.Build(&buf, control, files, date); err != nil {
+		return nil, fmt.Errorf("build %s: %w", name, err)
+	}
+	return buf.Bytes(), nil
+}
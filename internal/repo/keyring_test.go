@@ -0,0 +1,108 @@
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frostyard/plow/internal/deb"
+)
+
+func TestUpdateKeyringPackage(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.URL = "https://example.com/apt/"
+	cfg.KeyringPackage = KeyringPackageConfig{Enabled: true}
+	r := New(t.TempDir(), cfg)
+	if err := r.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	result, err := r.UpdateKeyringPackage([]byte("first key"))
+	if err != nil {
+		t.Fatalf("UpdateKeyringPackage: %v", err)
+	}
+	if result.Name != "frostyard-archive-keyring" || result.Version != "1" || !result.Built {
+		t.Errorf("first update = %+v, want version 1 built", result)
+	}
+	if strings.Join(result.Dists, ",") != "stable" {
+		t.Errorf("added to %v, want only stable, which its APT source names", result.Dists)
+	}
+	if !strings.Contains(readPackages(t, r, "stable"), "Package: frostyard-archive-keyring\nVersion: 1\n") {
+		t.Error("stable does not serve the keyring package")
+	}
+	if m, err := r.LoadManifest("testing"); err != nil || len(m.Packages) != 0 {
+		t.Errorf("testing lists %+v (err %v), want nothing", m, err)
+	}
+
+	poolFile := filepath.Join(r.Root, "pool/main/f/frostyard-archive-keyring/frostyard-archive-keyring_1_all.deb")
+	files := map[string]bool{
+		"etc/apt/sources.list.d/frostyard.sources":         false,
+		"usr/share/keyrings/frostyard-archive-keyring.gpg": false,
+	}
+	list, err := deb.ListFiles(poolFile)
+	if err != nil {
+		t.Fatalf("ListFiles: %v", err)
+	}
+	for _, f := range list {
+		if _, ok := files[f]; !ok {
+			t.Errorf("unexpected file %s", f)
+		}
+		files[f] = true
+	}
+	for f, found := range files {
+		if !found {
+			t.Errorf("missing file %s", f)
+		}
+	}
+	ok, err := r.hasFiles("pool/main/f/frostyard-archive-keyring/frostyard-archive-keyring_1_all.deb", r.keyringPackageFiles(result.Name, []byte("first key")))
+	if err != nil || !ok {
+		t.Errorf("hasFiles = %v, %v", ok, err)
+	}
+	sources := string(r.keyringPackageFiles(result.Name, nil)[1].Data)
+	want := "Types: deb\nURIs: https://example.com/apt\nSuites: stable\nComponents: main\nSigned-By: /usr/share/keyrings/frostyard-archive-keyring.gpg\n"
+	if sources != want {
+		t.Errorf("sources =\n%s\nwant\n%s", sources, want)
+	}
+
+	// The same keys change nothing
+	info, err := os.Stat(poolFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err = r.UpdateKeyringPackage([]byte("first key"))
+	if err != nil {
+		t.Fatalf("UpdateKeyringPackage: %v", err)
+	}
+	if result.Built || len(result.Dists) != 0 || result.Version != "1" {
+		t.Errorf("unchanged update = %+v, want no change", result)
+	}
+	if after, _ := os.Stat(poolFile); !after.ModTime().Equal(info.ModTime()) {
+		t.Error("unchanged update rewrote the package")
+	}
+
+	// New keys bump the version
+	result, err = r.UpdateKeyringPackage([]byte("first key, second key"))
+	if err != nil {
+		t.Fatalf("UpdateKeyringPackage: %v", err)
+	}
+	if result.Version != "2" || !result.Built || len(result.Dists) != 1 {
+		t.Errorf("rotated update = %+v, want version 2 in stable", result)
+	}
+	if !strings.Contains(readPackages(t, r, "stable"), "Package: frostyard-archive-keyring\nVersion: 2\n") {
+		t.Error("stable does not serve version 2")
+	}
+
+	// Pointing the APT source at testing publishes it there instead
+	r.Config.KeyringPackage.Suite = "testing"
+	result, err = r.UpdateKeyringPackage([]byte("first key, second key"))
+	if err != nil {
+		t.Fatalf("UpdateKeyringPackage: %v", err)
+	}
+	if result.Version != "3" || strings.Join(result.Dists, ",") != "testing" {
+		t.Errorf("update for testing = %+v, want version 3 in testing", result)
+	}
+	if !strings.Contains(readPackages(t, r, "testing"), "Package: frostyard-archive-keyring\nVersion: 3\n") {
+		t.Error("testing does not serve version 3")
+	}
+}
@@ -0,0 +1,223 @@
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/frostyard/plow/internal/deb"
+)
+
+// stateDir is the directory, relative to the repository root, where plow
+// keeps its own bookkeeping. It is hidden so HTML indexes skip it.
+const stateDir = ".plow"
+
+// Manifest records which package versions in the shared pool belong to a
+// distribution. The pool stores each .deb once; a distribution's Packages
+// indices are built only from the files listed in its manifest.
+type Manifest struct {
+	Dist     string          `json:"dist"`
+	Packages []ManifestEntry `json:"packages"`
+}
+
+// ManifestEntry identifies a single package version in a distribution.
+type ManifestEntry struct {
+	Name         string    `json:"name"`
+	Version      string    `json:"version"`
+	Architecture string    `json:"architecture"`
+	Filename     string    `json:"filename"`       // Relative path in pool
+	Added        time.Time `json:"added,omitzero"` // When it joined the distribution; zero if not recorded
+}
+
+// Key returns the name/version/architecture triple that identifies the entry.
+func (e ManifestEntry) Key() string {
+	return e.Name + "_" + e.Version + "_" + e.Architecture
+}
+
+// Component returns the archive component the entry's pool file belongs to,
+// taken from its pool/<component>/... path.
+func (e ManifestEntry) Component() string {
+	parts := strings.SplitN(e.Filename, "/", 3)
+	if len(parts) < 3 || parts[0] != "pool" {
+		return ""
+	}
+	return parts[1]
+}
+
+func entryForPackage(pkg *deb.Package) ManifestEntry {
+	return ManifestEntry{
+		Name:         pkg.Name,
+		Version:      pkg.Version,
+		Architecture: pkg.Architecture,
+		Filename:     filepath.ToSlash(pkg.Filename),
+	}
+}
+
+// Add records an entry in the manifest. An existing entry with the same
+// name, version and architecture is replaced unless it refers to the same
+// pool file, in which case its Added time is kept. It reports whether the
+// manifest changed.
+func (m *Manifest) Add(e ManifestEntry) bool {
+	for i, existing := range m.Packages {
+		if existing.Key() == e.Key() {
+			if existing.Filename == e.Filename {
+				return false
+			}
+			m.Packages[i] = e
+			return true
+		}
+	}
+	m.Packages = append(m.Packages, e)
+	return true
+}
+
+// RemoveFile drops every entry that refers to the given pool file.
+// It reports whether the manifest changed.
+func (m *Manifest) RemoveFile(filename string) bool {
+	filename = filepath.ToSlash(filename)
+	kept := m.Packages[:0]
+	for _, e := range m.Packages {
+		if e.Filename != filename {
+			kept = append(kept, e)
+		}
+	}
+	changed := len(kept) != len(m.Packages)
+	m.Packages = kept
+	return changed
+}
+
+// Contains reports whether the manifest references the given pool file.
+func (m *Manifest) Contains(filename string) bool {
+	filename = filepath.ToSlash(filename)
+	for _, e := range m.Packages {
+		if e.Filename == filename {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Manifest) sort() {
+	sort.Slice(m.Packages, func(i, j int) bool {
+		a, b := m.Packages[i], m.Packages[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Architecture != b.Architecture {
+			return a.Architecture < b.Architecture
+		}
+		return deb.Compare(a.Version, b.Version) > 0
+	})
+}
+
+func (r *Repository) manifestPath(dist string) string {
+	return filepath.Join(r.Root, stateDir, "dists", dist+".json")
+}
+
+// LoadManifest reads the membership manifest for a distribution.
+// Repositories created before manifests existed have none; in that case the
+// manifest is bootstrapped from the distribution's current Packages files so
+// that existing membership is preserved.
+func (r *Repository) LoadManifest(dist string) (*Manifest, error) {
+	data, err := os.ReadFile(r.manifestPath(dist))
+	if os.IsNotExist(err) {
+		return r.bootstrapManifest(dist)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read manifest for %s: %w", dist, err)
+	}
+
+	m := &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("parse manifest for %s: %w", dist, err)
+	}
+	m.Dist = dist
+	return m, nil
+}
+
+// SaveManifest writes the membership manifest for a distribution.
+func (r *Repository) SaveManifest(m *Manifest) error {
+	m.sort()
+	if m.Packages == nil {
+		m.Packages = []ManifestEntry{}
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode manifest for %s: %w", m.Dist, err)
+	}
+	data = append(data, '\n')
+
+	path := r.manifestPath(m.Dist)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create state directory: %w", err)
+	}
+	if _, err := writeFileIfChanged(path, data); err != nil {
+		return fmt.Errorf("write manifest for %s: %w", m.Dist, err)
+	}
+	return nil
+}
+
+func (r *Repository) bootstrapManifest(dist string) (*Manifest, error) {
+	m := &Manifest{Dist: dist}
+	d := r.Config.Dist(dist)
+	for _, comp := range d.Components {
+		onDisk, err := r.indexArchitectures(dist, comp)
+		if err != nil {
+			return nil, fmt.Errorf("bootstrap manifest for %s: %w", dist, err)
+		}
+		present := make(map[string]bool)
+		for _, arch := range onDisk {
+			present[arch] = true
+		}
+		// binary-all holds the Architecture: all packages when they are
+		// not duplicated into the architecture indices.
+		for _, arch := range append(orderedUnion(d.Architectures, present), "all") {
+			path := filepath.Join(r.Root, "dists", dist, comp, "binary-"+arch, "Packages")
+			entries, err := readPackagesEntries(path)
+			if err != nil {
+				return nil, fmt.Errorf("bootstrap manifest for %s: %w", dist, err)
+			}
+			for _, e := range entries {
+				m.Add(e)
+			}
+		}
+	}
+	return m, nil
+}
+
+// readPackagesEntries extracts the membership fields from an existing
+// Packages file. A missing file yields no entries.
+func readPackagesEntries(path string) ([]ManifestEntry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint:errcheck // Read-only file, close error is not critical
+
+	stanzas, err := deb.ParseStanzas(f)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	var entries []ManifestEntry
+	for _, s := range stanzas {
+		e := ManifestEntry{
+			Name:         s.Get("Package"),
+			Version:      s.Get("Version"),
+			Architecture: s.Get("Architecture"),
+			Filename:     s.Get("Filename"),
+		}
+		if e.Name != "" && e.Filename != "" {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
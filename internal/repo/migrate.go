@@ -0,0 +1,165 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/frostyard/plow/internal/deb"
+)
+
+// MigratePoolOptions configures the migrate-pool operation.
+type MigratePoolOptions struct {
+	DryRun bool // If true, only report what would be renamed
+}
+
+// PoolRename describes a pool file moved to its canonical path.
+type PoolRename struct {
+	From string
+	To   string
+}
+
+// MigratePoolResult contains the result of a migrate-pool operation.
+type MigratePoolResult struct {
+	Renamed []PoolRename // Files moved, or merged into an identical file at their canonical path
+	Dists   []string     // Distributions whose manifests now point at new paths
+}
+
+// MigratePool moves every pool file to the path AddPackage would store it
+// at, pool/<component>/<prefix>/<name>/name_version_arch.deb with the epoch
+// left out, and points the distribution manifests at the new paths. Files
+// that end up with the same canonical path must be identical; if any are
+// not, nothing is changed and a ConflictError is returned. The caller
+// regenerates the indexes of the returned distributions.
+func (r *Repository) MigratePool(opts MigratePoolOptions) (*MigratePoolResult, error) {
+	files, err := r.poolFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	// Plan every rename before touching the pool
+	targets := make(map[string][]*deb.Package) // canonical path -> files moving there
+	for _, relPath := range files {
+		pkg, err := r.parsePoolFile(relPath)
+		if err != nil {
+			return nil, err
+		}
+		component := (ManifestEntry{Filename: relPath}).Component()
+		canonical := filepath.ToSlash(pkg.PoolPath(component, pkg.DebFilename()))
+		if canonical != relPath {
+			targets[canonical] = append(targets[canonical], pkg)
+		}
+	}
+
+	result := &MigratePoolResult{}
+	renames := make(map[string]string)
+	for canonical, pkgs := range targets {
+		existing, err := r.poolFileSHA256(canonical)
+		if err != nil {
+			return nil, err
+		}
+		for _, pkg := range pkgs {
+			switch {
+			case existing != "" && pkg.SHA256 != existing:
+				return nil, &ConflictError{
+					Name:         pkg.Name,
+					Version:      pkg.Version,
+					Architecture: pkg.Architecture,
+					Existing:     canonical,
+				}
+			case pkg.SHA256 != pkgs[0].SHA256:
+				return nil, &ConflictError{
+					Name:         pkg.Name,
+					Version:      pkg.Version,
+					Architecture: pkg.Architecture,
+					Existing:     pkgs[0].Filename,
+				}
+			}
+			renames[pkg.Filename] = canonical
+			result.Renamed = append(result.Renamed, PoolRename{From: pkg.Filename, To: canonical})
+		}
+	}
+	sort.Slice(result.Renamed, func(i, j int) bool {
+		return result.Renamed[i].From < result.Renamed[j].From
+	})
+
+	manifests := make(map[string]*Manifest)
+	for _, dist := range r.Config.Distributions {
+		m, err := r.LoadManifest(dist)
+		if err != nil {
+			return nil, err
+		}
+		changed := false
+		for i, e := range m.Packages {
+			if to, ok := renames[e.Filename]; ok {
+				m.Packages[i].Filename = to
+				changed = true
+			}
+		}
+		if changed {
+			manifests[dist] = m
+			result.Dists = append(result.Dists, dist)
+		}
+	}
+
+	if opts.DryRun {
+		return result, nil
+	}
+	if len(result.Renamed) == 0 {
+		// Keep what planning parsed for the next run
+		if err := r.saveCache(); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	for _, rename := range result.Renamed {
+		if err := r.movePoolFile(rename.From, rename.To); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.saveCache(); err != nil {
+		return nil, err
+	}
+	if err := cleanEmptyDirs(filepath.Join(r.Root, "pool")); err != nil {
+		return nil, fmt.Errorf("clean empty directories: %w", err)
+	}
+	for _, dist := range result.Dists {
+		if err := r.SaveManifest(manifests[dist]); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// movePoolFile renames a pool file, carrying its cache entry along. If an
+// identical file is already at the target the source is simply removed.
+func (r *Repository) movePoolFile(from, to string) error {
+	src := filepath.Join(r.Root, filepath.FromSlash(from))
+	dst := filepath.Join(r.Root, filepath.FromSlash(to))
+	if _, err := os.Stat(dst); err == nil {
+		if err := os.Remove(src); err != nil {
+			return fmt.Errorf("remove %s: %w", from, err)
+		}
+		return r.forgetPoolFile(from)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("create pool directory: %w", err)
+	}
+	if err := os.Rename(src, dst); err != nil {
+		return fmt.Errorf("rename %s: %w", from, err)
+	}
+
+	c, err := r.metadataCache()
+	if err != nil {
+		return err
+	}
+	if e, ok := c.Entries[from]; ok {
+		delete(c.Entries, from)
+		c.Entries[to] = e
+		c.dirty = true
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package repo
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAddPackageCanonicalName(t *testing.T) {
+	r := newTestRepo(t)
+	src := t.TempDir()
+	upload := filepath.Join(src, "myapp-linux-amd64.deb")
+	if err := os.Rename(writeTestDeb(t, src, "myapp", "1:2.0-1", "amd64"), upload); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := r.AddPackage(AddOptions{Path: upload, Dist: "stable"})
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if want := "pool/main/m/myapp/myapp_2.0-1_amd64.deb"; res.Package.Filename != want {
+		t.Errorf("Filename = %q, want %q", res.Package.Filename, want)
+	}
+}
+
+func TestAddPackageEpochConflict(t *testing.T) {
+	r := newTestRepo(t)
+	src := t.TempDir()
+	if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, "myapp", "1.0", "amd64"), Dist: "stable"}); err != nil {
+		t.Fatalf("add 1.0: %v", err)
+	}
+
+	// 1:1.0 is stored under the same name as 1.0
+	_, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, "myapp", "1:1.0", "amd64"), Dist: "stable"})
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("error = %v, want ConflictError", err)
+	}
+	if conflict.Existing != "pool/main/m/myapp/myapp_1.0_amd64.deb" {
+		t.Errorf("Existing = %q", conflict.Existing)
+	}
+}
+
+// movePoolFileTo moves a pool file to an old-style name and points the
+// manifests at it, as releases before canonical names stored it.
+func movePoolFileTo(t *testing.T, r *Repository, from, to string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(filepath.Join(r.Root, to)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(r.Root, from), filepath.Join(r.Root, to)); err != nil {
+		t.Fatal(err)
+	}
+	for _, dist := range r.Config.Distributions {
+		m, err := r.LoadManifest(dist)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, e := range m.Packages {
+			if e.Filename == from {
+				m.Packages[i].Filename = to
+			}
+		}
+		if err := r.SaveManifest(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMigratePool(t *testing.T) {
+	r := newTestRepo(t)
+	src := t.TempDir()
+	debPath := writeTestDeb(t, src, "myapp", "1.0", "amd64")
+	for _, dist := range []string{"stable", "testing"} {
+		if _, err := r.AddPackage(AddOptions{Path: debPath, Dist: dist}); err != nil {
+			t.Fatalf("add: %v", err)
+		}
+	}
+	if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, "tool", "1:3.0", "all"), Dist: "stable"}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	movePoolFileTo(t, r, "pool/main/m/myapp/myapp_1.0_amd64.deb", "pool/main/m/myapp/myapp-linux-amd64.deb")
+	movePoolFileTo(t, r, "pool/main/t/tool/tool_3.0_all.deb", "pool/main/t/tool/tool_1:3.0_all.deb")
+
+	cacheBefore, err := os.ReadFile(r.cachePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dry, err := r.MigratePool(MigratePoolOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("MigratePool dry run: %v", err)
+	}
+	if len(dry.Renamed) != 2 {
+		t.Fatalf("dry run renamed %v, want 2 files", dry.Renamed)
+	}
+	if _, err := os.Stat(filepath.Join(r.Root, "pool/main/m/myapp/myapp-linux-amd64.deb")); err != nil {
+		t.Errorf("dry run moved a file: %v", err)
+	}
+	if cacheAfter, err := os.ReadFile(r.cachePath()); err != nil || string(cacheAfter) != string(cacheBefore) {
+		t.Errorf("dry run rewrote the metadata cache (err %v)", err)
+	}
+
+	result, err := r.MigratePool(MigratePoolOptions{})
+	if err != nil {
+		t.Fatalf("MigratePool: %v", err)
+	}
+	want := []PoolRename{
+		{From: "pool/main/m/myapp/myapp-linux-amd64.deb", To: "pool/main/m/myapp/myapp_1.0_amd64.deb"},
+		{From: "pool/main/t/tool/tool_1:3.0_all.deb", To: "pool/main/t/tool/tool_3.0_all.deb"},
+	}
+	if len(result.Renamed) != len(want) {
+		t.Fatalf("Renamed = %v, want %v", result.Renamed, want)
+	}
+	for i := range want {
+		if result.Renamed[i] != want[i] {
+			t.Errorf("Renamed[%d] = %v, want %v", i, result.Renamed[i], want[i])
+		}
+		if _, err := os.Stat(filepath.Join(r.Root, want[i].To)); err != nil {
+			t.Errorf("%s not moved: %v", want[i].To, err)
+		}
+	}
+	if strings.Join(result.Dists, ",") != "stable,testing" {
+		t.Errorf("Dists = %v, want stable and testing", result.Dists)
+	}
+
+	m, err := r.LoadManifest("testing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Contains("pool/main/m/myapp/myapp_1.0_amd64.deb") {
+		t.Errorf("testing manifest not updated: %+v", m.Packages)
+	}
+	if _, ok := r.cache.Entries["pool/main/m/myapp/myapp_1.0_amd64.deb"]; !ok {
+		t.Error("cache entry not moved with the file")
+	}
+
+	if err := r.GeneratePackagesIndex("stable"); err != nil {
+		t.Fatalf("GeneratePackagesIndex: %v", err)
+	}
+	if packages := readPackages(t, r, "stable"); !strings.Contains(packages, "Filename: pool/main/m/myapp/myapp_1.0_amd64.deb") {
+		t.Errorf("Packages not rewritten:\n%s", packages)
+	}
+
+	again, err := r.MigratePool(MigratePoolOptions{})
+	if err != nil {
+		t.Fatalf("MigratePool again: %v", err)
+	}
+	if len(again.Renamed) != 0 {
+		t.Errorf("second run renamed %v", again.Renamed)
+	}
+}
+
+func TestMigratePoolConflict(t *testing.T) {
+	r := newTestRepo(t)
+	if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, t.TempDir(), "myapp", "1.0", "amd64"), Dist: "stable"}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	stray := filepath.Join(r.Root, "pool/main/m/myapp/myapp-rebuilt.deb")
+	if err := copyFile(writeTestDeb(t, t.TempDir(), "myapp", "1.0", "amd64", "Section: utils"), stray); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := r.MigratePool(MigratePoolOptions{})
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("error = %v, want ConflictError", err)
+	}
+	if _, err := os.Stat(stray); err != nil {
+		t.Errorf("conflicting file was touched: %v", err)
+	}
+}
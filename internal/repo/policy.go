@@ -0,0 +1,151 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/frostyard/plow/internal/deb"
+)
+
+// InvalidNameError reports an upload whose package name does not follow
+// Debian policy: lower case letters, digits and + - . only, starting with a
+// letter or digit and at least two characters long.
+type InvalidNameError struct {
+	Name string
+}
+
+func (e *InvalidNameError) Error() string {
+	return fmt.Sprintf("invalid package name %q", e.Name)
+}
+
+// InvalidVersionError reports an upload whose version dpkg would reject.
+type InvalidVersionError struct {
+	Version string
+	Err     error
+}
+
+func (e *InvalidVersionError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *InvalidVersionError) Unwrap() error {
+	return e.Err
+}
+
+// ConflictError reports an upload with the same name, version and
+// architecture as a package already in the pool but different contents.
+// Clients that cached the published file would fail its checksum, so the
+// pool file is never replaced; the package has to be rebuilt under a new
+// version. Pool file names leave the epoch out, so versions that differ only
+// in their epoch, such as 1:1.0 and 1.0, conflict as well.
+type ConflictError struct {
+	Name         string
+	Version      string
+	Architecture string
+	Existing     string // Pool path of the published file
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s %s (%s) is already published as %s with different contents",
+		e.Name, e.Version, e.Architecture, e.Existing)
+}
+
+// DowngradeError reports an upload older than the newest version of the
+// package a distribution already has.
+type DowngradeError struct {
+	Name         string
+	Architecture string
+	Dist         string
+	Version      string // Version being added
+	Current      string // Newest version in the distribution
+}
+
+func (e *DowngradeError) Error() string {
+	return fmt.Sprintf("%s %s (%s) is older than %s in %s",
+		e.Name, e.Version, e.Architecture, e.Current, e.Dist)
+}
+
+// checkUpload applies the upload policy to a package about to be added to
+// dist at poolPath. It returns the pool path of an identical file already in
+// the pool, if any, so the upload can reuse it instead of copying.
+func (r *Repository) checkUpload(pkg *deb.Package, dist, poolPath string, allowDowngrade bool) (string, error) {
+	if !packageNamePattern.MatchString(pkg.Name) {
+		return "", &InvalidNameError{Name: pkg.Name}
+	}
+	if _, err := deb.ParseVersion(pkg.Version); err != nil {
+		return "", &InvalidVersionError{Version: pkg.Version, Err: err}
+	}
+
+	key := entryForPackage(pkg).Key()
+	published := ""
+	for _, d := range r.Config.Distributions {
+		m, err := r.LoadManifest(d)
+		if err != nil {
+			return "", err
+		}
+		for _, e := range m.Packages {
+			if e.Key() != key || e.Filename == published {
+				continue
+			}
+			sum, err := r.poolFileSHA256(e.Filename)
+			if err != nil {
+				return "", err
+			}
+			if sum == "" {
+				continue
+			}
+			if sum != pkg.SHA256 {
+				return "", &ConflictError{Name: pkg.Name, Version: pkg.Version, Architecture: pkg.Architecture, Existing: e.Filename}
+			}
+			published = e.Filename
+		}
+	}
+	if published == "" {
+		// A file no distribution references may still be in the pool.
+		sum, err := r.poolFileSHA256(poolPath)
+		if err != nil {
+			return "", err
+		}
+		if sum != "" && sum != pkg.SHA256 {
+			return "", &ConflictError{Name: pkg.Name, Version: pkg.Version, Architecture: pkg.Architecture, Existing: poolPath}
+		}
+		if sum != "" {
+			published = poolPath
+		}
+	}
+
+	if !allowDowngrade {
+		m, err := r.LoadManifest(dist)
+		if err != nil {
+			return "", err
+		}
+		current := ""
+		for _, e := range m.Packages {
+			// The distribution already has this exact file: nothing to add
+			if e.Key() == key && published != "" && e.Filename == published {
+				return published, nil
+			}
+			if e.Name == pkg.Name && e.Architecture == pkg.Architecture &&
+				(current == "" || deb.Compare(e.Version, current) > 0) {
+				current = e.Version
+			}
+		}
+		if current != "" && deb.Compare(pkg.Version, current) < 0 {
+			return "", &DowngradeError{Name: pkg.Name, Architecture: pkg.Architecture, Dist: dist, Version: pkg.Version, Current: current}
+		}
+	}
+	return published, nil
+}
+
+// poolFileSHA256 returns the SHA-256 of a pool file, or "" if it does not
+// exist. The checksum comes from the metadata cache when it is still valid.
+func (r *Repository) poolFileSHA256(relPath string) (string, error) {
+	entry, err := r.poolEntry(relPath)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("checksum %s: %w", relPath, err)
+	}
+	return entry.SHA256, nil
+}
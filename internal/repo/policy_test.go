@@ -0,0 +1,144 @@
+package repo
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAddPackageRejectsInvalidPackages(t *testing.T) {
+	r := newTestRepo(t)
+	src := t.TempDir()
+
+	var nameErr *InvalidNameError
+	if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, "My_App", "1.0", "amd64"), Dist: "stable"}); !errors.As(err, &nameErr) {
+		t.Errorf("invalid name: error = %v, want InvalidNameError", err)
+	}
+
+	var versionErr *InvalidVersionError
+	if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, "myapp", "v1.0", "amd64"), Dist: "stable"}); !errors.As(err, &versionErr) {
+		t.Errorf("invalid version: error = %v, want InvalidVersionError", err)
+	}
+
+	entries, err := filepath.Glob(filepath.Join(r.Root, "pool", "main", "*", "*", "*.deb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("rejected uploads reached the pool: %v", entries)
+	}
+}
+
+func TestAddPackageReupload(t *testing.T) {
+	r := newTestRepo(t)
+	debPath := writeTestDeb(t, t.TempDir(), "myapp", "1.0", "amd64")
+
+	first, err := r.AddPackage(AddOptions{Path: debPath, Dist: "stable"})
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if first.Unchanged {
+		t.Error("first upload reported unchanged")
+	}
+
+	again, err := r.AddPackage(AddOptions{Path: debPath, Dist: "stable"})
+	if err != nil {
+		t.Fatalf("re-upload: %v", err)
+	}
+	if !again.Unchanged {
+		t.Error("identical re-upload changed the distribution")
+	}
+
+	// Adding the same file to another distribution reuses the pool file
+	other, err := r.AddPackage(AddOptions{Path: debPath, Dist: "testing"})
+	if err != nil {
+		t.Fatalf("add to testing: %v", err)
+	}
+	if other.Unchanged || other.Package.Filename != first.Package.Filename {
+		t.Errorf("add to testing = %+v, want a new member at %s", other, first.Package.Filename)
+	}
+}
+
+func TestAddPackageReuploadOlderVersion(t *testing.T) {
+	r := newTestRepo(t)
+	src := t.TempDir()
+	older := writeTestDeb(t, src, "myapp", "1.0", "amd64")
+	for _, path := range []string{older, writeTestDeb(t, src, "myapp", "2.0", "amd64")} {
+		if _, err := r.AddPackage(AddOptions{Path: path, Dist: "stable"}); err != nil {
+			t.Fatalf("add %s: %v", path, err)
+		}
+	}
+
+	res, err := r.AddPackage(AddOptions{Path: older, Dist: "stable"})
+	if err != nil {
+		t.Fatalf("re-upload 1.0: %v", err)
+	}
+	if !res.Unchanged {
+		t.Error("re-upload of 1.0 changed the distribution")
+	}
+}
+
+func TestAddPackageRejectsConflicts(t *testing.T) {
+	r := newTestRepo(t)
+	original := writeTestDeb(t, t.TempDir(), "myapp", "1.0", "amd64")
+	if _, err := r.AddPackage(AddOptions{Path: original, Dist: "stable"}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	published, err := os.ReadFile(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Same name, version and architecture, different bytes, in either
+	// distribution
+	rebuilt := writeTestDeb(t, t.TempDir(), "myapp", "1.0", "amd64", "Section: utils")
+	for _, dist := range []string{"stable", "testing"} {
+		_, err := r.AddPackage(AddOptions{Path: rebuilt, Dist: dist})
+		var conflict *ConflictError
+		if !errors.As(err, &conflict) {
+			t.Fatalf("%s: error = %v, want ConflictError", dist, err)
+		}
+		if conflict.Existing != "pool/main/m/myapp/myapp_1.0_amd64.deb" {
+			t.Errorf("%s: Existing = %q", dist, conflict.Existing)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(r.Root, "pool", "main", "m", "myapp", "myapp_1.0_amd64.deb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(published) {
+		t.Error("conflicting upload replaced the pool file")
+	}
+}
+
+func TestAddPackageRejectsDowngrades(t *testing.T) {
+	r := newTestRepo(t)
+	src := t.TempDir()
+	if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, "myapp", "2.0", "amd64"), Dist: "stable"}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	older := writeTestDeb(t, src, "myapp", "1.9", "amd64")
+	_, err := r.AddPackage(AddOptions{Path: older, Dist: "stable"})
+	var downgrade *DowngradeError
+	if !errors.As(err, &downgrade) {
+		t.Fatalf("error = %v, want DowngradeError", err)
+	}
+	if downgrade.Current != "2.0" || downgrade.Version != "1.9" || downgrade.Dist != "stable" {
+		t.Errorf("DowngradeError = %+v", downgrade)
+	}
+
+	// Other distributions and architectures are unaffected
+	if _, err := r.AddPackage(AddOptions{Path: older, Dist: "testing"}); err != nil {
+		t.Errorf("add to testing: %v", err)
+	}
+	if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, "myapp", "1.9", "all"), Dist: "stable"}); err != nil {
+		t.Errorf("add other architecture: %v", err)
+	}
+
+	if _, err := r.AddPackage(AddOptions{Path: older, Dist: "stable", AllowDowngrade: true}); err != nil {
+		t.Errorf("add with AllowDowngrade: %v", err)
+	}
+}
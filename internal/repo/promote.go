@@ -0,0 +1,141 @@
+package repo
+
+import (
+	"fmt"
+	"path"
+)
+
+// PromoteOptions configures the promote operation.
+type PromoteOptions struct {
+	From           string // Source distribution
+	To             string // Target distribution
+	Package        string // Package name or glob pattern (e.g. "frostyard-*")
+	Version        string // Specific version to promote; empty means the newest
+	DryRun         bool   // If true, only report what would be promoted
+	AllowDowngrade bool   // Promote versions older than the target's newest
+}
+
+// PromoteResult contains the result of a promote operation.
+type PromoteResult struct {
+	Promoted []ManifestEntry // Entries added to the target distribution
+	Skipped  []ManifestEntry // Entries already present in the target
+}
+
+// Promote copies package versions from one distribution to another. The pool
+// files are shared, so only the target's membership changes. Unless a
+// specific version is requested, the newest version of each matching package
+// and architecture is promoted. Promotions are checked against the target
+// like uploads, so a version older than the target's newest fails with a
+// DowngradeError unless AllowDowngrade is set. The target's Packages and
+// Release files are regenerated when anything changed; the source is left
+// as it is.
+func (r *Repository) Promote(opts PromoteOptions) (*PromoteResult, error) {
+	if opts.From == opts.To {
+		return nil, fmt.Errorf("source and target distribution are both %q", opts.From)
+	}
+	for _, dist := range []string{opts.From, opts.To} {
+		if !r.hasDistribution(dist) {
+			return nil, fmt.Errorf("unknown distribution %q", dist)
+		}
+	}
+	if _, err := path.Match(opts.Package, ""); err != nil {
+		return nil, fmt.Errorf("invalid package pattern %q: %w", opts.Package, err)
+	}
+
+	from, err := r.LoadManifest(opts.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := r.LoadManifest(opts.To)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := selectPromotions(from, opts.Package, opts.Version)
+	if len(candidates) == 0 {
+		if opts.Version != "" {
+			return nil, fmt.Errorf("no packages matching %q with version %s in %s", opts.Package, opts.Version, opts.From)
+		}
+		return nil, fmt.Errorf("no packages matching %q in %s", opts.Package, opts.From)
+	}
+
+	components := r.Config.Dist(opts.To).Components
+	for _, e := range candidates {
+		if !contains(components, e.Component()) {
+			return nil, fmt.Errorf("%s %s is in component %q, which %s does not have",
+				e.Name, e.Version, e.Component(), opts.To)
+		}
+	}
+
+	// Apply the upload policy before changing anything
+	for _, e := range candidates {
+		pkg, err := r.parsePoolFile(e.Filename)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := r.checkUpload(pkg, opts.To, e.Filename, opts.AllowDowngrade); err != nil {
+			return nil, err
+		}
+	}
+
+	now, _, err := releaseDate()
+	if err != nil {
+		return nil, err
+	}
+	result := &PromoteResult{}
+	for _, e := range candidates {
+		e.Added = now
+		if to.Add(e) {
+			result.Promoted = append(result.Promoted, e)
+		} else {
+			result.Skipped = append(result.Skipped, e)
+		}
+	}
+
+	if opts.DryRun || len(result.Promoted) == 0 {
+		return result, nil
+	}
+
+	if err := r.SaveManifest(to); err != nil {
+		return nil, err
+	}
+	if err := r.GeneratePackagesIndex(opts.To); err != nil {
+		return nil, fmt.Errorf("generate packages index for %s: %w", opts.To, err)
+	}
+	if err := r.GenerateRelease(opts.To); err != nil {
+		return nil, fmt.Errorf("generate release for %s: %w", opts.To, err)
+	}
+	if err := r.saveCache(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// selectPromotions returns the manifest entries matching pattern. With an
+// explicit version every architecture of that version is selected; otherwise
+// the newest version per package and architecture is.
+func selectPromotions(m *Manifest, pattern, version string) []ManifestEntry {
+	m.sort()
+
+	var selected []ManifestEntry
+	seen := make(map[string]bool)
+	for _, e := range m.Packages {
+		if ok, _ := path.Match(pattern, e.Name); !ok {
+			continue
+		}
+		if version != "" {
+			if e.Version == version {
+				selected = append(selected, e)
+			}
+			continue
+		}
+		// Entries are sorted newest first within each name/architecture.
+		key := e.Name + "_" + e.Architecture
+		if !seen[key] {
+			seen[key] = true
+			selected = append(selected, e)
+		}
+	}
+	return selected
+}
@@ -0,0 +1,156 @@
+package repo
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func addTestPackages(t *testing.T, r *Repository, dist string, pkgs ...[2]string) {
+	t.Helper()
+	src := t.TempDir()
+	for _, p := range pkgs {
+		if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, p[0], p[1], "amd64"), Dist: dist}); err != nil {
+			t.Fatalf("add %s %s: %v", p[0], p[1], err)
+		}
+	}
+}
+
+func TestPromoteNewest(t *testing.T) {
+	r := newTestRepo(t)
+	addTestPackages(t, r, "testing",
+		[2]string{"myapp", "1.0~rc1"},
+		[2]string{"myapp", "1.0~rc2"},
+		[2]string{"other", "0.1"},
+	)
+
+	result, err := r.Promote(PromoteOptions{From: "testing", To: "stable", Package: "myapp"})
+	if err != nil {
+		t.Fatalf("promote: %v", err)
+	}
+	if len(result.Promoted) != 1 || result.Promoted[0].Version != "1.0~rc2" {
+		t.Fatalf("Promoted = %+v, want myapp 1.0~rc2", result.Promoted)
+	}
+
+	stable := readPackages(t, r, "stable")
+	if !strings.Contains(stable, "Version: 1.0~rc2\n") {
+		t.Error("stable missing promoted version")
+	}
+	if strings.Contains(stable, "1.0~rc1") || strings.Contains(stable, "Package: other") {
+		t.Error("stable contains packages that were not promoted")
+	}
+
+	// Promoting again is a no-op
+	result, err = r.Promote(PromoteOptions{From: "testing", To: "stable", Package: "myapp"})
+	if err != nil {
+		t.Fatalf("promote again: %v", err)
+	}
+	if len(result.Promoted) != 0 || len(result.Skipped) != 1 {
+		t.Errorf("second promote: promoted %d, skipped %d; want 0, 1", len(result.Promoted), len(result.Skipped))
+	}
+}
+
+func TestPromoteVersionAndPattern(t *testing.T) {
+	r := newTestRepo(t)
+	addTestPackages(t, r, "testing",
+		[2]string{"frostyard-a", "1.0"},
+		[2]string{"frostyard-a", "2.0"},
+		[2]string{"frostyard-b", "1.0"},
+		[2]string{"other", "1.0"},
+	)
+
+	result, err := r.Promote(PromoteOptions{From: "testing", To: "stable", Package: "frostyard-*", Version: "1.0"})
+	if err != nil {
+		t.Fatalf("promote: %v", err)
+	}
+	if len(result.Promoted) != 2 {
+		t.Fatalf("promoted %d entries, want 2", len(result.Promoted))
+	}
+	for _, e := range result.Promoted {
+		if e.Version != "1.0" || !strings.HasPrefix(e.Name, "frostyard-") {
+			t.Errorf("unexpected promotion %+v", e)
+		}
+	}
+}
+
+func TestPromoteDryRun(t *testing.T) {
+	r := newTestRepo(t)
+	addTestPackages(t, r, "testing", [2]string{"myapp", "1.0"})
+
+	result, err := r.Promote(PromoteOptions{From: "testing", To: "stable", Package: "myapp", DryRun: true})
+	if err != nil {
+		t.Fatalf("promote: %v", err)
+	}
+	if len(result.Promoted) != 1 {
+		t.Fatalf("promoted %d entries, want 1", len(result.Promoted))
+	}
+
+	m, err := r.LoadManifest("stable")
+	if err != nil {
+		t.Fatalf("load manifest: %v", err)
+	}
+	if len(m.Packages) != 0 {
+		t.Error("dry run modified the target manifest")
+	}
+}
+
+func TestPromoteDowngrade(t *testing.T) {
+	r := newTestRepo(t)
+	addTestPackages(t, r, "stable", [2]string{"myapp", "2.0"})
+	addTestPackages(t, r, "testing", [2]string{"myapp", "1.0"})
+
+	_, err := r.Promote(PromoteOptions{From: "testing", To: "stable", Package: "myapp"})
+	var downgrade *DowngradeError
+	if !errors.As(err, &downgrade) || downgrade.Current != "2.0" {
+		t.Fatalf("error = %v, want DowngradeError against 2.0", err)
+	}
+
+	result, err := r.Promote(PromoteOptions{From: "testing", To: "stable", Package: "myapp", AllowDowngrade: true})
+	if err != nil {
+		t.Fatalf("promote with AllowDowngrade: %v", err)
+	}
+	if len(result.Promoted) != 1 || result.Promoted[0].Version != "1.0" {
+		t.Errorf("Promoted = %+v, want myapp 1.0", result.Promoted)
+	}
+}
+
+func TestPromoteLeavesSourceAlone(t *testing.T) {
+	r := newTestRepo(t)
+	addTestPackages(t, r, "testing", [2]string{"myapp", "1.0"})
+	if err := r.GeneratePackagesIndex("testing"); err != nil {
+		t.Fatalf("GeneratePackagesIndex: %v", err)
+	}
+	// A pending change to testing must not be published by promoting from it
+	addTestPackages(t, r, "testing", [2]string{"other", "1.0"})
+
+	if _, err := r.Promote(PromoteOptions{From: "testing", To: "stable", Package: "myapp"}); err != nil {
+		t.Fatalf("promote: %v", err)
+	}
+	if strings.Contains(readPackages(t, r, "testing"), "Package: other") {
+		t.Error("promote regenerated the source distribution")
+	}
+}
+
+func TestPromoteErrors(t *testing.T) {
+	r := newTestRepo(t)
+	addTestPackages(t, r, "testing", [2]string{"myapp", "1.0"})
+
+	tests := []struct {
+		name string
+		opts PromoteOptions
+	}{
+		{"same dist", PromoteOptions{From: "testing", To: "testing", Package: "myapp"}},
+		{"unknown dist", PromoteOptions{From: "testing", To: "unstable", Package: "myapp"}},
+		{"no match", PromoteOptions{From: "testing", To: "stable", Package: "missing"}},
+		{"no version", PromoteOptions{From: "testing", To: "stable", Package: "myapp", Version: "9.9"}},
+		{"bad pattern", PromoteOptions{From: "testing", To: "stable", Package: "["}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := r.Promote(tc.opts); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -4,102 +4,286 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/frostyard/plow/internal/deb"
 )
 
 // PruneOptions configures the prune operation.
 type PruneOptions struct {
-	KeepVersions int  // Number of versions to keep per package
-	DryRun       bool // If true, only report what would be deleted
+	KeepVersions int       // Versions to keep of packages no retention rule matches
+	DryRun       bool      // If true, only report what would be deleted
+	Orphans      bool      // Also delete pool files no distribution listed before pruning
+	Now          time.Time // Time keep_for is measured from; zero means now
 }
 
 // PruneResult contains the result of a prune operation.
 type PruneResult struct {
-	Deleted []string // Paths of deleted files
-	Kept    []string // Paths of kept files
+	Deleted   []string                   // Paths of deleted pool files
+	Kept      []string                   // Paths of kept pool files
+	Dists     []string                   // Distributions whose membership changed
+	Removed   map[string][]ManifestEntry // Entries dropped, by distribution
+	Reclaimed map[string]int64           // Bytes of deleted pool files, by distribution
+	Bytes     int64                      // Bytes of all deleted pool files
+	Decisions []PruneDecision            // Why each entry was kept or dropped
 }
 
-// Prune removes old package versions, keeping only the newest N versions.
+// PruneDecision explains what prune did with a distribution's entry, or
+// with a pool file no distribution lists.
+type PruneDecision struct {
+	Dist         string // Empty for pool files no distribution lists
+	Path         string // Pool path, relative to the repository root
+	Name         string
+	Version      string
+	Architecture string
+	Keep         bool
+	Rule         string   // Retention rule that applied to the package
+	Reasons      []string // What kept the entry, or why the rule did not
+}
+
+// Prune removes old package versions. Retention is worked out separately
+// for every distribution: the versions of each package, component and
+// architecture it lists are ranked newest first, and the repository's
+// retention settings decide which it keeps: the newest version always,
+// pinned versions, and whatever the first matching retention rule keeps.
+// Packages no rule matches keep their newest KeepVersions versions. A pool
+// file is deleted only once no distribution lists it, so pruning one
+// distribution never takes a version away from another. Pool files no
+// distribution listed to begin with are left alone unless Orphans is set.
+//
+// Reclaimed counts a deleted file for every distribution that dropped it.
+// Decisions lists the entries of each distribution in turn, then the pool
+// files no distribution lists.
 func (r *Repository) Prune(opts PruneOptions) (*PruneResult, error) {
 	if opts.KeepVersions < 1 {
 		opts.KeepVersions = 5
 	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
 
-	poolDir := filepath.Join(r.Root, "pool", "main")
-	result := &PruneResult{}
-
-	// Group packages by name and architecture
-	packages := make(map[string][]*packageFile)
+	poolDir := filepath.Join(r.Root, "pool")
+	result := &PruneResult{
+		Removed:   make(map[string][]ManifestEntry),
+		Reclaimed: make(map[string]int64),
+	}
 
-	err := filepath.Walk(poolDir, func(path string, info os.FileInfo, err error) error {
+	// Decide per distribution which entries to keep
+	listed := make(map[string]bool)    // Pool files listed before pruning
+	remaining := make(map[string]bool) // Pool files listed after pruning
+	manifests := make(map[string]*Manifest)
+	for _, dist := range r.Config.Distributions {
+		m, err := r.LoadManifest(dist)
 		if err != nil {
-			return err
-		}
-		if info.IsDir() || !strings.HasSuffix(path, ".deb") {
-			return nil
+			return nil, err
 		}
+		manifests[dist] = m
+		m.sort()
 
-		pkg, err := deb.Parse(path)
-		if err != nil {
-			return fmt.Errorf("parse %s: %w", path, err)
+		// Group entries by component, name and architecture, newest first
+		var keys []string
+		groups := make(map[string][]ManifestEntry)
+		for _, e := range m.Packages {
+			listed[e.Filename] = true
+			key := e.Component() + "/" + e.Name + "_" + e.Architecture
+			if groups[key] == nil {
+				keys = append(keys, key)
+			}
+			groups[key] = append(groups[key], e)
 		}
 
-		key := pkg.Name + "_" + pkg.Architecture
-		packages[key] = append(packages[key], &packageFile{
-			Path:    path,
-			Version: pkg.Version,
-		})
-		return nil
-	})
+		var kept []ManifestEntry
+		for _, key := range keys {
+			entries := groups[key]
+			for i, d := range r.retain(dist, entries, opts) {
+				result.Decisions = append(result.Decisions, d)
+				if d.Keep {
+					kept = append(kept, entries[i])
+					remaining[entries[i].Filename] = true
+				} else {
+					result.Removed[dist] = append(result.Removed[dist], entries[i])
+				}
+			}
+		}
+		if len(result.Removed[dist]) > 0 {
+			result.Dists = append(result.Dists, dist)
+			m.Packages = kept
+		}
+	}
 
-	if err != nil && !os.IsNotExist(err) {
+	// Select the pool files this run dropped from the last distribution
+	// listing them, and unlisted ones if asked to
+	files, err := r.poolFiles()
+	if err != nil {
 		return nil, err
 	}
+	var drop []string
+	for _, relPath := range files {
+		path := filepath.Join(r.Root, filepath.FromSlash(relPath))
+		if !listed[relPath] {
+			pkg, err := r.parsePoolFile(relPath)
+			if err != nil {
+				return nil, err
+			}
+			d := PruneDecision{
+				Path:         relPath,
+				Name:         pkg.Name,
+				Version:      pkg.Version,
+				Architecture: pkg.Architecture,
+				Keep:         !opts.Orphans,
+				Reasons:      []string{"not listed in any distribution"},
+			}
+			if d.Keep {
+				d.Reasons = append(d.Reasons, "orphans are only deleted on request")
+			}
+			result.Decisions = append(result.Decisions, d)
+		}
+		if remaining[relPath] || (!listed[relPath] && !opts.Orphans) {
+			result.Kept = append(result.Kept, path)
+			continue
+		}
 
-	// For each package, sort by version and prune old ones
-	for _, pkgs := range packages {
-		// Sort by version, newest first
-		sortPackageFiles(pkgs)
-
-		for i, pf := range pkgs {
-			if i < opts.KeepVersions {
-				result.Kept = append(result.Kept, pf.Path)
-			} else {
-				result.Deleted = append(result.Deleted, pf.Path)
-				if !opts.DryRun {
-					if err := os.Remove(pf.Path); err != nil {
-						return nil, fmt.Errorf("delete %s: %w", pf.Path, err)
-					}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		drop = append(drop, relPath)
+		result.Deleted = append(result.Deleted, path)
+		result.Bytes += info.Size()
+		for dist, removed := range result.Removed {
+			for _, e := range removed {
+				if e.Filename == relPath {
+					result.Reclaimed[dist] += info.Size()
 				}
 			}
 		}
 	}
 
-	// Clean up empty directories
-	if !opts.DryRun {
-		if err := cleanEmptyDirs(poolDir); err != nil {
-			return nil, fmt.Errorf("clean empty directories: %w", err)
+	if opts.DryRun {
+		return result, nil
+	}
+
+	// Save the manifests before deleting anything, so a failure never leaves
+	// a distribution listing a file that is gone
+	for _, dist := range result.Dists {
+		if err := r.SaveManifest(manifests[dist]); err != nil {
+			return nil, err
 		}
 	}
+	for _, relPath := range drop {
+		if err := os.Remove(filepath.Join(r.Root, filepath.FromSlash(relPath))); err != nil {
+			return nil, fmt.Errorf("delete %s: %w", relPath, err)
+		}
+		if err := r.forgetPoolFile(relPath); err != nil {
+			return nil, err
+		}
+	}
+	// Clean up empty directories
+	if err := cleanEmptyDirs(poolDir); err != nil {
+		return nil, fmt.Errorf("clean empty directories: %w", err)
+	}
+	if err := r.saveCache(); err != nil {
+		return nil, err
+	}
 
 	return result, nil
 }
 
-type packageFile struct {
-	Path    string
-	Version string
-}
+// retain decides which versions of one package a distribution keeps.
+// entries is sorted newest first.
+func (r *Repository) retain(dist string, entries []ManifestEntry,
+	opts PruneOptions) []PruneDecision {
+	rule := RetentionRule{Keep: opts.KeepVersions}
+	label := "keep-versions"
+	if configured := r.Config.RetentionRule(dist, entries[0].Name); configured != nil {
+		rule = *configured
+		pattern := rule.Package
+		if pattern == "" {
+			pattern = "*"
+		}
+		label = fmt.Sprintf("retention rule %q", pattern)
+	}
 
-func sortPackageFiles(files []*packageFile) {
-	for i := 0; i < len(files)-1; i++ {
-		for j := i + 1; j < len(files); j++ {
-			if deb.Compare(files[i].Version, files[j].Version) < 0 {
-				files[i], files[j] = files[j], files[i]
+	decisions := make([]PruneDecision, 0, len(entries))
+	perMajor := make(map[string]int)
+	for i, e := range entries {
+		d := PruneDecision{
+			Dist:         dist,
+			Path:         e.Filename,
+			Name:         e.Name,
+			Version:      e.Version,
+			Architecture: e.Architecture,
+			Rule:         label,
+		}
+		var kept, missed []string
+
+		if i == 0 {
+			kept = append(kept, "newest version")
+		}
+		if r.Config.Pinned(e.Name, e.Version) {
+			kept = append(kept, "pinned")
+		}
+		if rule.Keep > 0 {
+			if i < rule.Keep {
+				kept = append(kept, fmt.Sprintf("one of the newest %d", rule.Keep))
+			} else {
+				missed = append(missed, fmt.Sprintf("not one of the newest %d", rule.Keep))
+			}
+		}
+		if rule.KeepPerMajor > 0 {
+			major := upstreamMajor(e.Version)
+			newest := fmt.Sprintf("the newest %d of major version %s", rule.KeepPerMajor, major)
+			if perMajor[major] < rule.KeepPerMajor {
+				kept = append(kept, "one of "+newest)
+			} else {
+				missed = append(missed, "not one of "+newest)
 			}
+			perMajor[major]++
+		}
+		if rule.KeepFor > 0 {
+			added, period := e.Added.Format(dateFormat), formatDuration(rule.KeepFor)
+			switch {
+			case e.Added.IsZero():
+				missed = append(missed, "no record of when it was added")
+			case opts.Now.Sub(e.Added) < rule.KeepFor:
+				kept = append(kept, fmt.Sprintf("added %s, within %s", added, period))
+			default:
+				missed = append(missed, fmt.Sprintf("added %s, more than %s ago", added, period))
+			}
+		}
+
+		d.Keep = len(kept) > 0
+		d.Reasons = missed
+		if d.Keep {
+			d.Reasons = kept
 		}
+		decisions = append(decisions, d)
+	}
+	return decisions
+}
+
+// upstreamMajor returns the major version of a package version: the leading
+// number of its upstream part, prefixed by any epoch. 2.4.1-1 has major
+// version 2 and 1:3.0 has 1:3.
+func upstreamMajor(version string) string {
+	v, err := deb.ParseVersion(version)
+	if err != nil {
+		return version
+	}
+	end := strings.IndexFunc(v.Upstream, func(c rune) bool { return c < '0' || c > '9' })
+	if end < 0 {
+		end = len(v.Upstream)
+	}
+	major := strings.TrimLeft(v.Upstream[:end], "0")
+	if major == "" {
+		major = "0"
+	}
+	if v.Epoch != 0 {
+		major = strconv.Itoa(v.Epoch) + ":" + major
 	}
+	return major
 }
 
 func cleanEmptyDirs(root string) error {
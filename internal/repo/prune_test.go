@@ -0,0 +1,273 @@
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pruneDecisions returns the prune decisions keyed by file name.
+func pruneDecisions(result *PruneResult) map[string]PruneDecision {
+	decisions := make(map[string]PruneDecision)
+	for _, d := range result.Decisions {
+		decisions[filepath.Base(d.Path)] = d
+	}
+	return decisions
+}
+
+func TestPruneRetentionRules(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Retention = Retention{
+		Rules: []RetentionRule{{Package: "tool*", Keep: 1, KeepPerMajor: 1}},
+		Pins:  []RetentionPin{{Package: "myapp", Version: "1.0"}},
+	}
+	r := New(t.TempDir(), cfg)
+	if err := r.Init(); err != nil {
+		t.Fatalf("init repo: %v", err)
+	}
+	src := t.TempDir()
+	for _, v := range []string{"1.0", "2.0", "3.0", "4.0"} {
+		if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, "myapp", v, "amd64"), Dist: "stable"}); err != nil {
+			t.Fatalf("add myapp %s: %v", v, err)
+		}
+	}
+	for _, v := range []string{"1.0", "1.1", "2.0", "2.1"} {
+		if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, "tool", v, "amd64"), Dist: "stable"}); err != nil {
+			t.Fatalf("add tool %s: %v", v, err)
+		}
+	}
+
+	result, err := r.Prune(PruneOptions{KeepVersions: 2, DryRun: true})
+	if err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	decisions := pruneDecisions(result)
+	want := map[string]bool{
+		"myapp_4.0_amd64.deb": true,
+		"myapp_3.0_amd64.deb": true,
+		"myapp_2.0_amd64.deb": false,
+		"myapp_1.0_amd64.deb": true, // pinned
+		"tool_2.1_amd64.deb":  true,
+		"tool_2.0_amd64.deb":  false,
+		"tool_1.1_amd64.deb":  true, // newest of major version 1
+		"tool_1.0_amd64.deb":  false,
+	}
+	for file, keep := range want {
+		if d := decisions[file]; d.Keep != keep {
+			t.Errorf("%s: Keep = %v (%s), want %v", file, d.Keep, strings.Join(d.Reasons, "; "), keep)
+		}
+	}
+	if d := decisions["myapp_1.0_amd64.deb"]; d.Rule != "keep-versions" || !strings.Contains(strings.Join(d.Reasons, "; "), "pinned") {
+		t.Errorf("myapp 1.0 decision = %+v, want pinned under keep-versions", d)
+	}
+	if d := decisions["tool_1.1_amd64.deb"]; d.Rule != `retention rule "tool*"` || d.Reasons[0] != "one of the newest 1 of major version 1" {
+		t.Errorf("tool 1.1 decision = %+v", d)
+	}
+	if d := decisions["tool_1.0_amd64.deb"]; len(d.Reasons) != 2 {
+		t.Errorf("tool 1.0 reasons = %q, want one per criterion", d.Reasons)
+	}
+}
+
+func TestPruneKeepFor(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Retention.Rules = []RetentionRule{{KeepFor: 30 * 24 * time.Hour}}
+	r := New(t.TempDir(), cfg)
+	if err := r.Init(); err != nil {
+		t.Fatalf("init repo: %v", err)
+	}
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	src := t.TempDir()
+	for v, age := range map[string]int{"1.0": 60, "2.0": 10, "3.0": 45} {
+		t.Setenv("SOURCE_DATE_EPOCH", strconv.FormatInt(now.AddDate(0, 0, -age).Unix(), 10))
+		if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, "myapp", v, "amd64"), Dist: "testing", AllowDowngrade: true}); err != nil {
+			t.Fatalf("add %s: %v", v, err)
+		}
+	}
+
+	result, err := r.Prune(PruneOptions{Now: now})
+	if err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	decisions := pruneDecisions(result)
+	for file, keep := range map[string]bool{
+		"myapp_3.0_amd64.deb": true, // newest, although added 45 days ago
+		"myapp_2.0_amd64.deb": true,
+		"myapp_1.0_amd64.deb": false,
+	} {
+		if d := decisions[file]; d.Keep != keep {
+			t.Errorf("%s: Keep = %v (%s), want %v", file, d.Keep, strings.Join(d.Reasons, "; "), keep)
+		}
+	}
+	if got := decisions["myapp_1.0_amd64.deb"].Reasons; len(got) != 1 || got[0] != "added 2026-08-17, more than 30d ago" {
+		t.Errorf("myapp 1.0 reasons = %q", got)
+	}
+
+	m, err := r.LoadManifest("testing")
+	if err != nil {
+		t.Fatalf("load manifest: %v", err)
+	}
+	if m.Contains("pool/main/m/myapp/myapp_1.0_amd64.deb") || len(m.Packages) != 2 {
+		t.Errorf("manifest after prune = %+v", m.Packages)
+	}
+}
+
+func TestPruneUnlistedPoolFiles(t *testing.T) {
+	r := newTestRepo(t)
+	src := t.TempDir()
+	for _, v := range []string{"1.0", "2.0"} {
+		if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, "myapp", v, "amd64"), Dist: "testing"}); err != nil {
+			t.Fatalf("add %s: %v", v, err)
+		}
+	}
+	orphan := filepath.Join(r.Root, "pool/main/o/orphan/orphan_1.0_amd64.deb")
+	if err := os.MkdirAll(filepath.Dir(orphan), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyFile(writeTestDeb(t, src, "orphan", "1.0", "amd64"), orphan); err != nil {
+		t.Fatal(err)
+	}
+
+	// A dry run leaves the pool and the cache alone
+	cacheBefore, err := os.ReadFile(r.cachePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Prune(PruneOptions{KeepVersions: 1, Orphans: true, DryRun: true}); err != nil {
+		t.Fatalf("prune dry run: %v", err)
+	}
+	if cacheAfter, err := os.ReadFile(r.cachePath()); err != nil || string(cacheAfter) != string(cacheBefore) {
+		t.Errorf("dry run rewrote the metadata cache (err %v)", err)
+	}
+
+	// Only the version this run drops is deleted; the orphan stays
+	result, err := r.Prune(PruneOptions{KeepVersions: 1})
+	if err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if len(result.Deleted) != 1 || filepath.Base(result.Deleted[0]) != "myapp_1.0_amd64.deb" {
+		t.Errorf("deleted %v, want only myapp 1.0", result.Deleted)
+	}
+	if d := pruneDecisions(result)["orphan_1.0_amd64.deb"]; !d.Keep || d.Dist != "" {
+		t.Errorf("orphan decision = %+v", d)
+	}
+	if _, err := os.Stat(orphan); err != nil {
+		t.Errorf("orphan deleted without Orphans: %v", err)
+	}
+
+	result, err = r.Prune(PruneOptions{KeepVersions: 1, Orphans: true})
+	if err != nil {
+		t.Fatalf("prune orphans: %v", err)
+	}
+	if len(result.Deleted) != 1 || result.Deleted[0] != orphan {
+		t.Errorf("deleted %v, want only the unlisted %s", result.Deleted, orphan)
+	}
+	if d := pruneDecisions(result)["orphan_1.0_amd64.deb"]; d.Keep {
+		t.Errorf("orphan decision = %+v", d)
+	}
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Errorf("orphan still in the pool: %v", err)
+	}
+}
+
+func TestPrunePerDistribution(t *testing.T) {
+	r := newTestRepo(t)
+	src := t.TempDir()
+	if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, "myapp", "1.0", "amd64"), Dist: "stable"}); err != nil {
+		t.Fatalf("add to stable: %v", err)
+	}
+	for _, v := range []string{"1.0", "2.0", "3.0", "4.0"} {
+		if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, "myapp", v, "amd64"), Dist: "testing"}); err != nil {
+			t.Fatalf("add %s to testing: %v", v, err)
+		}
+	}
+	size := func(v string) int64 {
+		info, err := os.Stat(filepath.Join(r.Root, "pool/main/m/myapp/myapp_"+v+"_amd64.deb"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Size()
+	}
+	want := size("2.0")
+
+	result, err := r.Prune(PruneOptions{KeepVersions: 2})
+	if err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+
+	// Testing drops 1.0 and 2.0, but stable still serves 1.0
+	if len(result.Removed["testing"]) != 2 || len(result.Removed["stable"]) != 0 {
+		t.Errorf("Removed = %+v", result.Removed)
+	}
+	if len(result.Deleted) != 1 || filepath.Base(result.Deleted[0]) != "myapp_2.0_amd64.deb" {
+		t.Errorf("Deleted = %v, want only 2.0", result.Deleted)
+	}
+	if result.Reclaimed["testing"] != want || result.Bytes != want || result.Reclaimed["stable"] != 0 {
+		t.Errorf("Reclaimed = %v, Bytes = %d, want %d for testing", result.Reclaimed, result.Bytes, want)
+	}
+	if strings.Join(result.Dists, ",") != "testing" {
+		t.Errorf("Dists = %v, want [testing]", result.Dists)
+	}
+
+	stable, err := r.LoadManifest("stable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stable.Contains("pool/main/m/myapp/myapp_1.0_amd64.deb") {
+		t.Error("pruning testing took 1.0 away from stable")
+	}
+	tm, err := r.LoadManifest("testing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tm.Packages) != 2 || tm.Contains("pool/main/m/myapp/myapp_1.0_amd64.deb") {
+		t.Errorf("testing manifest = %+v", tm.Packages)
+	}
+	if _, err := os.Stat(filepath.Join(r.Root, "pool/main/m/myapp/myapp_1.0_amd64.deb")); err != nil {
+		t.Errorf("pool file stable lists was deleted: %v", err)
+	}
+}
+
+func TestPruneRuleDists(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Retention.Rules = []RetentionRule{{Dists: []string{"testing"}, Keep: 1}}
+	r := New(t.TempDir(), cfg)
+	if err := r.Init(); err != nil {
+		t.Fatalf("init repo: %v", err)
+	}
+	src := t.TempDir()
+	for _, dist := range []string{"stable", "testing"} {
+		for _, v := range []string{"1.0", "2.0"} {
+			if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, "myapp", v, "amd64"), Dist: dist}); err != nil {
+				t.Fatalf("add %s to %s: %v", v, dist, err)
+			}
+		}
+	}
+
+	result, err := r.Prune(PruneOptions{KeepVersions: 5, DryRun: true})
+	if err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if len(result.Removed["testing"]) != 1 || len(result.Removed["stable"]) != 0 {
+		t.Errorf("Removed = %+v, want 1.0 dropped from testing only", result.Removed)
+	}
+	if len(result.Deleted) != 0 {
+		t.Errorf("Deleted = %v, want nothing while stable lists both", result.Deleted)
+	}
+}
+
+func TestUpstreamMajor(t *testing.T) {
+	for version, want := range map[string]string{
+		"2.4.1-1":   "2",
+		"10":        "10",
+		"1:3.0":     "1:3",
+		"007.1":     "7",
+		"0.9~rc1-2": "0",
+	} {
+		if got := upstreamMajor(version); got != want {
+			t.Errorf("upstreamMajor(%q) = %q, want %q", version, got, want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/frostyard/plow/internal/deb"
+)
+
+// releaseTimeFormat is the RFC 2822 form apt expects in Date and
+// Valid-Until, always in UTC.
+const releaseTimeFormat = "Mon, 02 Jan 2006 15:04:05 UTC"
+
+// ReleaseValidUntil returns the Valid-Until time of a distribution's current
+// Release file, or the zero time if it has none.
+func (r *Repository) ReleaseValidUntil(dist string) (time.Time, error) {
+	data, err := os.ReadFile(filepath.Join(r.Root, "dists", dist, "Release"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("read Release: %w", err)
+	}
+	release, err := deb.ParseStanza(data)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parse Release: %w", err)
+	}
+
+	value, ok := release.Lookup("Valid-Until")
+	if !ok {
+		return time.Time{}, nil
+	}
+	validUntil, err := time.Parse(releaseTimeFormat, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parse Valid-Until: %w", err)
+	}
+	return validUntil, nil
+}
+
+// RefreshRelease regenerates a distribution's Release file with a new Date
+// and Valid-Until when its current Valid-Until falls within the given window,
+// or when the Release does not match the configured valid_for. The index
+// files are not rebuilt. It reports whether the Release was regenerated, in
+// which case it has to be signed again.
+func (r *Repository) RefreshRelease(dist string, within time.Duration) (bool, error) {
+	if !r.hasDistribution(dist) {
+		return false, fmt.Errorf("unknown distribution %q", dist)
+	}
+
+	validUntil, err := r.ReleaseValidUntil(dist)
+	if err != nil {
+		return false, err
+	}
+
+	validFor := r.Config.Dist(dist).ValidFor
+	switch {
+	case validFor == 0 && validUntil.IsZero():
+		return false, nil
+	case validFor > 0 && !validUntil.IsZero() && time.Until(validUntil) > within:
+		return false, nil
+	}
+
+	if err := r.generateRelease(dist, true); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// releaseDate returns the Date for a new Release file: the time given by
+// SOURCE_DATE_EPOCH, for reproducible output, or else the current time. It
+// reports whether the date came from SOURCE_DATE_EPOCH.
+func releaseDate() (time.Time, bool, error) {
+	value := os.Getenv("SOURCE_DATE_EPOCH")
+	if value == "" {
+		return time.Now().UTC().Truncate(time.Second), false, nil
+	}
+	epoch, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: %w", value, err)
+	}
+	return time.Unix(epoch, 0).UTC(), true, nil
+}
+
+// releaseDateOf returns the Date field of a Release file's content.
+func releaseDateOf(release []byte) (time.Time, bool) {
+	s, err := deb.ParseStanza(release)
+	if err != nil {
+		return time.Time{}, false
+	}
+	date, err := time.Parse(releaseTimeFormat, s.Get("Date"))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+// ReleaseSigned reports whether a distribution's InRelease and Release.gpg
+// exist and InRelease carries the current Release content, in which case
+// signing it again would only produce new signatures of the same content.
+func (r *Repository) ReleaseSigned(dist string) (bool, error) {
+	distDir := filepath.Join(r.Root, "dists", dist)
+	release, err := os.ReadFile(filepath.Join(distDir, "Release"))
+	if err != nil {
+		return false, fmt.Errorf("read Release: %w", err)
+	}
+	if _, err := os.Stat(filepath.Join(distDir, "Release.gpg")); os.IsNotExist(err) {
+		return false, nil
+	}
+	inRelease, err := os.ReadFile(filepath.Join(distDir, "InRelease"))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("read InRelease: %w", err)
+	}
+
+	signed, ok := clearsignedText(inRelease)
+	return ok && signed == strings.TrimRight(string(release), "\n"), nil
+}
+
+// clearsignedText extracts the signed text of an OpenPGP cleartext signed
+// message, undoing dash-escaping. The line break before the signature is not
+// part of the text.
+func clearsignedText(msg []byte) (string, bool) {
+	lines := strings.Split(strings.ReplaceAll(string(msg), "\r\n", "\n"), "\n")
+	if len(lines) == 0 || lines[0] != "-----BEGIN PGP SIGNED MESSAGE-----" {
+		return "", false
+	}
+
+	// Armor headers such as Hash: end at the first empty line
+	i := 1
+	for i < len(lines) && lines[i] != "" {
+		i++
+	}
+
+	var text []string
+	for i++; i < len(lines); i++ {
+		line := lines[i]
+		if line == "-----BEGIN PGP SIGNATURE-----" {
+			return strings.Join(text, "\n"), true
+		}
+		text = append(text, strings.TrimPrefix(line, "- "))
+	}
+	return "", false
+}
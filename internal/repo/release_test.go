@@ -0,0 +1,214 @@
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateReleaseExtendedFields(t *testing.T) {
+	r := newTestRepo(t)
+	fpr := "0123456789ABCDEF0123456789ABCDEF01234567"
+	r.Config.Overrides = map[string]DistConfig{
+		"testing": {
+			Codename:             "forky",
+			Version:              "14.0",
+			ValidFor:             7 * 24 * time.Hour,
+			NotAutomatic:         true,
+			ButAutomaticUpgrades: true,
+			SignedBy:             []string{fpr},
+			Changelogs:           "https://example.com/changelogs/@CHANGEPATH@",
+		},
+	}
+	if err := r.GenerateRelease("testing"); err != nil {
+		t.Fatalf("GenerateRelease: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(r.Root, "dists", "testing", "Release"))
+	if err != nil {
+		t.Fatalf("read Release: %v", err)
+	}
+	release := string(data)
+	for _, line := range []string{
+		"Suite: testing",
+		"Codename: forky",
+		"Version: 14.0",
+		"NotAutomatic: yes",
+		"ButAutomaticUpgrades: yes",
+		"Signed-By: " + fpr,
+		"Changelogs: https://example.com/changelogs/@CHANGEPATH@",
+	} {
+		if !strings.Contains(release, line+"\n") {
+			t.Errorf("Release missing %q:\n%s", line, release)
+		}
+	}
+
+	validUntil, err := r.ReleaseValidUntil("testing")
+	if err != nil {
+		t.Fatalf("ReleaseValidUntil: %v", err)
+	}
+	if remaining := time.Until(validUntil); remaining < 7*24*time.Hour-time.Minute || remaining > 7*24*time.Hour {
+		t.Errorf("Valid-Until is %v away, want 7 days", remaining)
+	}
+
+	// Fields are not written for distributions without them
+	if err := r.GenerateRelease("stable"); err != nil {
+		t.Fatalf("GenerateRelease: %v", err)
+	}
+	data, err = os.ReadFile(filepath.Join(r.Root, "dists", "stable", "Release"))
+	if err != nil {
+		t.Fatalf("read Release: %v", err)
+	}
+	for _, field := range []string{"Valid-Until", "NotAutomatic", "Signed-By", "Changelogs", "Version"} {
+		if strings.Contains(string(data), field+":") {
+			t.Errorf("stable Release contains %s", field)
+		}
+	}
+}
+
+func TestRefreshRelease(t *testing.T) {
+	r := newTestRepo(t)
+	if err := r.GenerateRelease("stable"); err != nil {
+		t.Fatalf("GenerateRelease: %v", err)
+	}
+
+	// Without valid_for there is nothing to refresh
+	refreshed, err := r.RefreshRelease("stable", 72*time.Hour)
+	if err != nil {
+		t.Fatalf("RefreshRelease: %v", err)
+	}
+	if refreshed {
+		t.Error("refreshed a Release without Valid-Until")
+	}
+
+	// Enabling valid_for adds Valid-Until on the next refresh
+	r.Config.Overrides = map[string]DistConfig{"stable": {ValidFor: 48 * time.Hour}}
+	refreshed, err = r.RefreshRelease("stable", 24*time.Hour)
+	if err != nil {
+		t.Fatalf("RefreshRelease: %v", err)
+	}
+	if !refreshed {
+		t.Fatal("Release without Valid-Until was not refreshed")
+	}
+
+	// A Release expiring outside the window is kept
+	refreshed, err = r.RefreshRelease("stable", 24*time.Hour)
+	if err != nil {
+		t.Fatalf("RefreshRelease: %v", err)
+	}
+	if refreshed {
+		t.Error("refreshed a Release that is valid for another two days")
+	}
+
+	// One expiring inside the window is re-dated
+	refreshed, err = r.RefreshRelease("stable", 72*time.Hour)
+	if err != nil {
+		t.Fatalf("RefreshRelease: %v", err)
+	}
+	if !refreshed {
+		t.Error("Release expiring within the window was not refreshed")
+	}
+
+	if _, err := r.RefreshRelease("unstable", time.Hour); err == nil {
+		t.Error("expected error for unknown distribution")
+	}
+}
+
+func TestGenerateReleaseSourceDateEpoch(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+
+	var releases []string
+	for range 2 {
+		r := newTestRepo(t)
+		r.Config.Overrides = map[string]DistConfig{"stable": {ValidFor: 24 * time.Hour}}
+		if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, t.TempDir(), "myapp", "1.0.0", "amd64"), Dist: "stable"}); err != nil {
+			t.Fatalf("add: %v", err)
+		}
+		if err := r.GeneratePackagesIndex("stable"); err != nil {
+			t.Fatalf("GeneratePackagesIndex: %v", err)
+		}
+		if err := r.GenerateRelease("stable"); err != nil {
+			t.Fatalf("GenerateRelease: %v", err)
+		}
+		data, err := os.ReadFile(filepath.Join(r.Root, "dists", "stable", "Release"))
+		if err != nil {
+			t.Fatalf("read Release: %v", err)
+		}
+		releases = append(releases, string(data))
+	}
+
+	if releases[0] != releases[1] {
+		t.Errorf("Release differs between runs:\n%s\n---\n%s", releases[0], releases[1])
+	}
+	for _, line := range []string{
+		"Date: Tue, 14 Nov 2023 22:13:20 UTC\n",
+		"Valid-Until: Wed, 15 Nov 2023 22:13:20 UTC\n",
+	} {
+		if !strings.Contains(releases[0], line) {
+			t.Errorf("Release missing %q:\n%s", line, releases[0])
+		}
+	}
+
+	t.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	if err := newTestRepo(t).GenerateRelease("stable"); err == nil {
+		t.Error("expected error for invalid SOURCE_DATE_EPOCH")
+	}
+}
+
+func TestReleaseSigned(t *testing.T) {
+	r := newTestRepo(t)
+	if err := r.GenerateRelease("stable"); err != nil {
+		t.Fatalf("GenerateRelease: %v", err)
+	}
+	distDir := filepath.Join(r.Root, "dists", "stable")
+	release, err := os.ReadFile(filepath.Join(distDir, "Release"))
+	if err != nil {
+		t.Fatalf("read Release: %v", err)
+	}
+
+	signed, err := r.ReleaseSigned("stable")
+	if err != nil {
+		t.Fatalf("ReleaseSigned: %v", err)
+	}
+	if signed {
+		t.Error("unsigned Release reported as signed")
+	}
+
+	clearsign := func(text string) []byte {
+		text = strings.ReplaceAll(strings.TrimRight(text, "\n"), "\n-", "\n- -")
+		return []byte("-----BEGIN PGP SIGNED MESSAGE-----\nHash: SHA512\n\n" + text +
+			"\n-----BEGIN PGP SIGNATURE-----\n\nAAAA\n-----END PGP SIGNATURE-----\n")
+	}
+	// Dash-escaped lines must be unescaped before comparing
+	release = append(release, "-Test: x\n"...)
+	if err := os.WriteFile(filepath.Join(distDir, "Release"), release, 0644); err != nil {
+		t.Fatalf("write Release: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(distDir, "InRelease"), clearsign(string(release)), 0644); err != nil {
+		t.Fatalf("write InRelease: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(distDir, "Release.gpg"), []byte("sig"), 0644); err != nil {
+		t.Fatalf("write Release.gpg: %v", err)
+	}
+
+	signed, err = r.ReleaseSigned("stable")
+	if err != nil {
+		t.Fatalf("ReleaseSigned: %v", err)
+	}
+	if !signed {
+		t.Error("InRelease of the current Release not recognised")
+	}
+
+	if err := os.WriteFile(filepath.Join(distDir, "InRelease"), clearsign("Origin: Other\n"), 0644); err != nil {
+		t.Fatalf("write InRelease: %v", err)
+	}
+	signed, err = r.ReleaseSigned("stable")
+	if err != nil {
+		t.Fatalf("ReleaseSigned: %v", err)
+	}
+	if signed {
+		t.Error("InRelease of another Release reported as current")
+	}
+}
@@ -0,0 +1,305 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/frostyard/plow/internal/deb"
+)
+
+// RemoveOptions configures the remove operation.
+type RemoveOptions struct {
+	Name         string   // Package name
+	Version      string   // Only remove this version; empty means all versions
+	Architecture string   // Only remove this architecture; empty means all
+	Dists        []string // Distributions to remove from; empty means all
+	Force        bool     // Remove even if other packages depend on it
+	DryRun       bool     // If true, only report what would be removed
+}
+
+// RemoveResult contains the result of a remove operation.
+type RemoveResult struct {
+	Removed    map[string][]ManifestEntry // Entries removed, by distribution
+	Deleted    []string                   // Pool files deleted because no distribution references them
+	Dependents []Dependent                // Packages left with a dependency on the removed package
+}
+
+// Dependent describes a package whose dependency would no longer be
+// satisfiable in a distribution after a removal.
+type Dependent struct {
+	Dist    string
+	Package string
+	Version string
+	Field   string // Depends or Pre-Depends
+}
+
+func (d Dependent) String() string {
+	return fmt.Sprintf("%s %s in %s (%s)", d.Package, d.Version, d.Dist, d.Field)
+}
+
+// DependencyError is returned by Remove when other packages depend on the
+// package being removed and Force is not set.
+type DependencyError struct {
+	Name       string
+	Dependents []Dependent
+}
+
+func (e *DependencyError) Error() string {
+	names := make([]string, len(e.Dependents))
+	for i, d := range e.Dependents {
+		names[i] = d.String()
+	}
+	return fmt.Sprintf("%s is required by: %s", e.Name, strings.Join(names, ", "))
+}
+
+// Remove drops package versions from distributions and deletes pool files
+// that are no longer referenced by any distribution. The Packages and
+// Release files of every affected distribution are regenerated.
+func (r *Repository) Remove(opts RemoveOptions) (*RemoveResult, error) {
+	if opts.Name == "" {
+		return nil, fmt.Errorf("package name is required")
+	}
+
+	dists := opts.Dists
+	if len(dists) == 0 {
+		dists = r.Config.Distributions
+	}
+	for _, dist := range dists {
+		if !r.hasDistribution(dist) {
+			return nil, fmt.Errorf("unknown distribution %q", dist)
+		}
+	}
+
+	matches := func(name, version, arch string) bool {
+		return name == opts.Name &&
+			(opts.Version == "" || version == opts.Version) &&
+			(opts.Architecture == "" || arch == opts.Architecture)
+	}
+
+	manifests := make(map[string]*Manifest)
+	for _, dist := range r.Config.Distributions {
+		m, err := r.LoadManifest(dist)
+		if err != nil {
+			return nil, err
+		}
+		manifests[dist] = m
+	}
+
+	result := &RemoveResult{Removed: make(map[string][]ManifestEntry)}
+	candidates := make(map[string]bool)
+
+	for _, dist := range dists {
+		m := manifests[dist]
+		kept := m.Packages[:0]
+		for _, e := range m.Packages {
+			if matches(e.Name, e.Version, e.Architecture) {
+				result.Removed[dist] = append(result.Removed[dist], e)
+				candidates[e.Filename] = true
+				continue
+			}
+			kept = append(kept, e)
+		}
+		m.Packages = kept
+	}
+
+	// Removing from every distribution also cleans up matching files in the
+	// package's pool directory that no distribution references.
+	if len(opts.Dists) == 0 {
+		orphans, err := r.poolFilesFor(opts.Name, matches)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range orphans {
+			candidates[f] = true
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("package %q not found", opts.Name)
+	}
+
+	for dist := range result.Removed {
+		dependents, err := r.findDependents(manifests[dist], opts.Name)
+		if err != nil {
+			return nil, err
+		}
+		result.Dependents = append(result.Dependents, dependents...)
+	}
+	if len(result.Dependents) > 0 && !opts.Force {
+		return nil, &DependencyError{Name: opts.Name, Dependents: result.Dependents}
+	}
+
+	for filename := range candidates {
+		referenced := false
+		for _, m := range manifests {
+			if m.Contains(filename) {
+				referenced = true
+				break
+			}
+		}
+		if !referenced {
+			result.Deleted = append(result.Deleted, filename)
+		}
+	}
+	sort.Strings(result.Deleted)
+
+	if opts.DryRun {
+		return result, nil
+	}
+
+	// Save the manifests before deleting anything, so a failure never leaves
+	// a distribution listing a file that is gone
+	for _, dist := range dists {
+		if len(result.Removed[dist]) == 0 {
+			continue
+		}
+		if err := r.SaveManifest(manifests[dist]); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, filename := range result.Deleted {
+		path := filepath.Join(r.Root, filepath.FromSlash(filename))
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("delete %s: %w", filename, err)
+		}
+		if err := r.forgetPoolFile(filename); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.saveCache(); err != nil {
+		return nil, err
+	}
+	if len(result.Deleted) > 0 {
+		if err := cleanEmptyDirs(filepath.Join(r.Root, "pool")); err != nil {
+			return nil, fmt.Errorf("clean empty directories: %w", err)
+		}
+	}
+
+	for _, dist := range dists {
+		if len(result.Removed[dist]) == 0 {
+			continue
+		}
+		if err := r.GeneratePackagesIndex(dist); err != nil {
+			return nil, fmt.Errorf("generate packages index for %s: %w", dist, err)
+		}
+		if err := r.GenerateRelease(dist); err != nil {
+			return nil, fmt.Errorf("generate release for %s: %w", dist, err)
+		}
+	}
+
+	return result, nil
+}
+
+// poolFilesFor returns the pool files of a package in every component,
+// located with the same layout rules AddPackage uses, that satisfy the match
+// function.
+func (r *Repository) poolFilesFor(name string, match func(name, version, arch string) bool) ([]string, error) {
+	components, err := os.ReadDir(filepath.Join(r.Root, "pool"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read pool directory: %w", err)
+	}
+
+	var files []string
+	for _, comp := range components {
+		if !comp.IsDir() {
+			continue
+		}
+		pkgDir := filepath.Dir((&deb.Package{Name: name}).PoolPath(comp.Name(), "x.deb"))
+
+		entries, err := os.ReadDir(filepath.Join(r.Root, pkgDir))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read pool directory: %w", err)
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".deb") {
+				continue
+			}
+			relPath := filepath.Join(pkgDir, entry.Name())
+			pkg, err := r.parsePoolFile(relPath)
+			if err != nil {
+				return nil, err
+			}
+			if match(pkg.Name, pkg.Version, pkg.Architecture) {
+				files = append(files, filepath.ToSlash(relPath))
+			}
+		}
+	}
+	return files, nil
+}
+
+// findDependents returns the packages in m with a Depends or Pre-Depends
+// requirement on name that no version of name remaining in m satisfies.
+func (r *Repository) findDependents(m *Manifest, name string) ([]Dependent, error) {
+	var remaining []string
+	for _, e := range m.Packages {
+		if e.Name == name {
+			remaining = append(remaining, e.Version)
+		}
+	}
+
+	var dependents []Dependent
+	for _, e := range m.Packages {
+		if e.Name == name {
+			continue
+		}
+		pkg, err := r.parsePoolFile(e.Filename)
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range []string{"Pre-Depends", "Depends"} {
+			rels, err := pkg.Relations(field)
+			if err != nil {
+				return nil, err
+			}
+			if unsatisfied(rels, name, remaining) {
+				dependents = append(dependents, Dependent{
+					Dist:    m.Dist,
+					Package: e.Name,
+					Version: e.Version,
+					Field:   field,
+				})
+			}
+		}
+	}
+	return dependents, nil
+}
+
+// unsatisfied reports whether the relations contain a requirement on name
+// that none of the given versions satisfy. A requirement with alternatives
+// only counts when every alternative is name, since other packages may be
+// provided from outside this repository.
+func unsatisfied(rels deb.Relations, name string, versions []string) bool {
+	for _, alts := range rels {
+		broken := true
+		for _, rel := range alts {
+			if rel.Name != name || satisfiedBy(rel, versions) {
+				broken = false
+				break
+			}
+		}
+		if broken {
+			return true
+		}
+	}
+	return false
+}
+
+func satisfiedBy(rel deb.Relation, versions []string) bool {
+	for _, v := range versions {
+		if rel.Satisfies(v) {
+			return true
+		}
+	}
+	return false
+}
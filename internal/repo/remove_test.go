@@ -0,0 +1,123 @@
+package repo
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frostyard/plow/internal/deb"
+)
+
+func TestRemoveVersionFromDist(t *testing.T) {
+	r := newTestRepo(t)
+	addTestPackages(t, r, "stable", [2]string{"myapp", "1.0"}, [2]string{"myapp", "2.0"})
+	if _, err := r.Promote(PromoteOptions{From: "stable", To: "testing", Package: "myapp", Version: "1.0"}); err != nil {
+		t.Fatalf("promote: %v", err)
+	}
+
+	// Removing 1.0 from stable keeps the file, since testing still uses it
+	result, err := r.Remove(RemoveOptions{Name: "myapp", Version: "1.0", Dists: []string{"stable"}})
+	if err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if len(result.Removed["stable"]) != 1 {
+		t.Errorf("removed %d stable entries, want 1", len(result.Removed["stable"]))
+	}
+	if len(result.Deleted) != 0 {
+		t.Errorf("deleted %v, want nothing", result.Deleted)
+	}
+
+	stable := readPackages(t, r, "stable")
+	if strings.Contains(stable, "Version: 1.0\n") || !strings.Contains(stable, "Version: 2.0\n") {
+		t.Errorf("unexpected stable index:\n%s", stable)
+	}
+
+	// Removing it from testing as well deletes the pool file
+	result, err = r.Remove(RemoveOptions{Name: "myapp", Version: "1.0"})
+	if err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	want := "pool/main/m/myapp/myapp_1.0_amd64.deb"
+	if len(result.Deleted) != 1 || result.Deleted[0] != want {
+		t.Errorf("Deleted = %v, want [%s]", result.Deleted, want)
+	}
+	if _, err := os.Stat(filepath.Join(r.Root, want)); !os.IsNotExist(err) {
+		t.Error("pool file still exists")
+	}
+}
+
+func TestRemoveLibPoolLayout(t *testing.T) {
+	r := newTestRepo(t)
+	addTestPackages(t, r, "stable", [2]string{"libfoo", "1.0"})
+
+	result, err := r.Remove(RemoveOptions{Name: "libfoo"})
+	if err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if len(result.Deleted) != 1 || !strings.HasPrefix(result.Deleted[0], "pool/main/libf/libfoo/") {
+		t.Errorf("Deleted = %v", result.Deleted)
+	}
+}
+
+func TestRemoveRefusesDependedOn(t *testing.T) {
+	r := newTestRepo(t)
+	src := t.TempDir()
+	if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, "libfoo", "1.0", "amd64"), Dist: "stable"}); err != nil {
+		t.Fatalf("add libfoo: %v", err)
+	}
+	if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, "myapp", "1.0", "amd64", "Depends: libc6, libfoo (>= 1.0)"), Dist: "stable"}); err != nil {
+		t.Fatalf("add myapp: %v", err)
+	}
+
+	_, err := r.Remove(RemoveOptions{Name: "libfoo"})
+	var depErr *DependencyError
+	if !errors.As(err, &depErr) {
+		t.Fatalf("expected DependencyError, got %v", err)
+	}
+	if len(depErr.Dependents) != 1 || depErr.Dependents[0].Package != "myapp" {
+		t.Errorf("Dependents = %v", depErr.Dependents)
+	}
+
+	result, err := r.Remove(RemoveOptions{Name: "libfoo", Force: true})
+	if err != nil {
+		t.Fatalf("forced remove: %v", err)
+	}
+	if len(result.Dependents) != 1 {
+		t.Errorf("forced remove reported %d dependents, want 1", len(result.Dependents))
+	}
+}
+
+func TestRemoveNotFound(t *testing.T) {
+	r := newTestRepo(t)
+	if _, err := r.Remove(RemoveOptions{Name: "missing"}); err == nil {
+		t.Error("expected error for missing package")
+	}
+}
+
+func TestUnsatisfied(t *testing.T) {
+	tests := []struct {
+		field    string
+		versions []string
+		want     bool
+	}{
+		{"libfoo", nil, true},
+		{"libfoo", []string{"1.0"}, false},
+		{"libc6 (>= 2.34), libfoo:any (>= 2.0) [amd64]", []string{"1.0"}, true},
+		{"libc6 (>= 2.34), libfoo:any (>= 2.0) [amd64]", []string{"1.0", "2.1"}, false},
+		{"libfoo | libbar", nil, false},
+		{"libfoo-dev", nil, false},
+		{"", nil, false},
+	}
+
+	for _, tc := range tests {
+		rels, err := deb.ParseRelations(tc.field)
+		if err != nil {
+			t.Fatalf("ParseRelations(%q): %v", tc.field, err)
+		}
+		if got := unsatisfied(rels, "libfoo", tc.versions); got != tc.want {
+			t.Errorf("unsatisfied(%q, %v) = %v, want %v", tc.field, tc.versions, got, tc.want)
+		}
+	}
+}
@@ -2,13 +2,16 @@
 package repo
 
 import (
+	"bytes"
 	"crypto/md5"
 	"crypto/sha1"
 	"crypto/sha256"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -16,32 +19,12 @@ import (
 	"github.com/frostyard/plow/internal/deb"
 )
 
-// Config holds repository configuration.
-type Config struct {
-	Origin        string
-	Label         string
-	Description   string
-	Architectures []string
-	Components    []string
-	Distributions []string
-}
-
-// DefaultConfig returns the default repository configuration.
-func DefaultConfig() Config {
-	return Config{
-		Origin:        "Frostyard",
-		Label:         "Frostyard",
-		Description:   "Frostyard Debian Repository",
-		Architectures: []string{"amd64"},
-		Components:    []string{"main"},
-		Distributions: []string{"stable", "testing"},
-	}
-}
-
 // Repository represents a Debian repository on disk.
 type Repository struct {
 	Root   string
 	Config Config
+
+	cache *metaCache // Loaded on first use
 }
 
 // New creates a new Repository instance.
@@ -55,8 +38,9 @@ func New(root string, cfg Config) *Repository {
 // Init creates the initial directory structure for the repository.
 func (r *Repository) Init() error {
 	for _, dist := range r.Config.Distributions {
-		for _, comp := range r.Config.Components {
-			for _, arch := range r.Config.Architectures {
+		d := r.Config.Dist(dist)
+		for _, comp := range d.Components {
+			for _, arch := range d.Architectures {
 				dir := filepath.Join(r.Root, "dists", dist, comp, "binary-"+arch)
 				if err := os.MkdirAll(dir, 0755); err != nil {
 					return fmt.Errorf("create directory %s: %w", dir, err)
@@ -70,66 +54,188 @@ func (r *Repository) Init() error {
 					}
 				}
 			}
-		}
-	}
 
-	// Create pool directory
-	poolDir := filepath.Join(r.Root, "pool", "main")
-	if err := os.MkdirAll(poolDir, 0755); err != nil {
-		return fmt.Errorf("create pool directory: %w", err)
+			// Create pool directory
+			poolDir := filepath.Join(r.Root, "pool", comp)
+			if err := os.MkdirAll(poolDir, 0755); err != nil {
+				return fmt.Errorf("create pool directory: %w", err)
+			}
+		}
 	}
 
 	return nil
 }
 
+// AddOptions configures the add operation.
+type AddOptions struct {
+	Path           string // .deb file to add
+	Dist           string // Distribution to add it to
+	Component      string // Component; empty selects the distribution's first
+	AllowDowngrade bool   // Accept a version older than the distribution's newest
+}
+
+// AddResult contains the result of an add operation.
+type AddResult struct {
+	Package   *deb.Package
+	Unchanged bool // The distribution already had this exact file
+}
+
 // AddPackage adds a .deb file to the repository.
-// It copies the file to the pool and updates the package index.
-func (r *Repository) AddPackage(debPath, dist string) (*deb.Package, error) {
-	pkg, err := deb.Parse(debPath)
+// It copies the file to the component's part of the shared pool, named
+// name_version_arch.deb whatever the upload was called, and records it as a
+// member of the distribution. The upload policy is applied first: invalid
+// names and versions, a different file under a published
+// name/version/architecture and, unless allowed, downgrades are rejected
+// with an InvalidNameError, InvalidVersionError, ConflictError or
+// DowngradeError. Adding a file the distribution already has is a no-op.
+func (r *Repository) AddPackage(opts AddOptions) (*AddResult, error) {
+	dist, component := opts.Dist, opts.Component
+	if !r.hasDistribution(dist) {
+		return nil, fmt.Errorf("unknown distribution %q", dist)
+	}
+	d := r.Config.Dist(dist)
+	if component == "" {
+		component = d.Components[0]
+	}
+	if !contains(d.Components, component) {
+		return nil, fmt.Errorf("component %q is not configured for %s (have %s)",
+			component, dist, strings.Join(d.Components, ", "))
+	}
+
+	pkg, err := deb.Parse(opts.Path)
 	if err != nil {
 		return nil, fmt.Errorf("parse deb: %w", err)
 	}
+	if err := r.checkArchitecture(dist, pkg.Architecture); err != nil {
+		return nil, err
+	}
 
-	// Determine destination path in pool
-	filename := filepath.Base(debPath)
-	poolPath := pkg.PoolPath(filename)
-	fullPoolPath := filepath.Join(r.Root, poolPath)
-
-	// Create directory
-	if err := os.MkdirAll(filepath.Dir(fullPoolPath), 0755); err != nil {
-		return nil, fmt.Errorf("create pool directory: %w", err)
+	// Pool files are named after the package, whatever the upload was called
+	poolPath := filepath.ToSlash(pkg.PoolPath(component, pkg.DebFilename()))
+	existing, err := r.checkUpload(pkg, dist, poolPath, opts.AllowDowngrade)
+	if err != nil {
+		return nil, err
 	}
 
-	// Copy file
-	if err := copyFile(debPath, fullPoolPath); err != nil {
-		return nil, fmt.Errorf("copy deb to pool: %w", err)
+	if existing != "" {
+		if c := (ManifestEntry{Filename: existing}).Component(); c != component {
+			return nil, fmt.Errorf("%s %s (%s) is already in the pool under component %s",
+				pkg.Name, pkg.Version, pkg.Architecture, c)
+		}
+		poolPath = existing
+	} else {
+		fullPoolPath := filepath.Join(r.Root, poolPath)
+
+		// Create directory
+		if err := os.MkdirAll(filepath.Dir(fullPoolPath), 0755); err != nil {
+			return nil, fmt.Errorf("create pool directory: %w", err)
+		}
+
+		// Copy file
+		if err := copyFile(opts.Path, fullPoolPath); err != nil {
+			return nil, fmt.Errorf("copy deb to pool: %w", err)
+		}
 	}
 
 	// Set the filename for the package index
 	pkg.Filename = poolPath
+	result := &AddResult{Package: pkg}
+
+	// Record membership
+	m, err := r.LoadManifest(dist)
+	if err != nil {
+		return nil, err
+	}
+	entry := entryForPackage(pkg)
+	if entry.Added, _, err = releaseDate(); err != nil {
+		return nil, err
+	}
+	if !m.Add(entry) {
+		// Checking the upload may still have filled in the cache
+		if err := r.saveCache(); err != nil {
+			return nil, err
+		}
+		result.Unchanged = true
+		return result, nil
+	}
+
+	// Seed the metadata cache so indexing does not parse the file again
+	info, err := os.Stat(filepath.Join(r.Root, poolPath))
+	if err != nil {
+		return nil, fmt.Errorf("stat pool file: %w", err)
+	}
+	if _, err := r.metadataCache(); err != nil {
+		return nil, err
+	}
+	r.cachePackage(poolPath, pkg, info)
+	if err := r.saveCache(); err != nil {
+		return nil, err
+	}
+
+	if err := r.SaveManifest(m); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
 
-	return pkg, nil
+func (r *Repository) hasDistribution(dist string) bool {
+	return contains(r.Config.Distributions, dist)
 }
 
-// GeneratePackagesIndex generates the Packages, Packages.gz, and Packages.xz files
-// for a given distribution.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// GeneratePackagesIndex generates the Packages files, and Contents files if
+// enabled, for a given distribution from the packages recorded in its manifest.
 func (r *Repository) GeneratePackagesIndex(dist string) error {
-	for _, comp := range r.Config.Components {
-		for _, arch := range r.Config.Architectures {
-			if err := r.generatePackagesForArch(dist, comp, arch); err != nil {
+	m, err := r.LoadManifest(dist)
+	if err != nil {
+		return err
+	}
+
+	d := r.Config.Dist(dist)
+	for _, comp := range d.Components {
+		for _, arch := range r.distArchitectures(m) {
+			if err := r.generatePackagesForArch(m, comp, arch); err != nil {
+				return err
+			}
+		}
+
+		if r.Config.hasBinaryAll() {
+			if err := r.generatePackagesForArch(m, comp, "all"); err != nil {
 				return err
 			}
+		} else if err := r.removeArchIndices(dist, comp, "all"); err != nil {
+			return err
 		}
 	}
-	return nil
+
+	if err := r.updateByHash(dist); err != nil {
+		return err
+	}
+	if err := r.updateGitAttributes(); err != nil {
+		return err
+	}
+	if err := r.saveCache(); err != nil {
+		return err
+	}
+
+	// Persist a bootstrapped manifest so later runs don't depend on the
+	// Packages files it was derived from.
+	return r.SaveManifest(m)
 }
 
-func (r *Repository) generatePackagesForArch(dist, comp, arch string) error {
-	// Scan pool for packages of this architecture
-	poolDir := filepath.Join(r.Root, "pool", comp)
-	packages, err := r.scanPool(poolDir, arch)
+func (r *Repository) generatePackagesForArch(m *Manifest, comp, arch string) error {
+	packages, err := r.distPackages(m, comp, arch)
 	if err != nil {
-		return fmt.Errorf("scan pool: %w", err)
+		return fmt.Errorf("collect packages for %s/%s/%s: %w", m.Dist, comp, arch, err)
 	}
 
 	// Build Packages content
@@ -139,62 +245,100 @@ func (r *Repository) generatePackagesForArch(dist, comp, arch string) error {
 		content.WriteString("\n")
 	}
 
-	// Write Packages file
-	distDir := filepath.Join(r.Root, "dists", dist, comp, "binary-"+arch)
-	if err := os.MkdirAll(distDir, 0755); err != nil {
-		return fmt.Errorf("create dist directory: %w", err)
-	}
-
-	packagesPath := filepath.Join(distDir, "Packages")
-	if err := os.WriteFile(packagesPath, []byte(content.String()), 0644); err != nil {
+	// Write Packages file and its compressed variants. Those must not be
+	// stored in Git LFS, since GitHub Pages would serve the LFS pointers;
+	// updateGitAttributes keeps them out of it.
+	packagesPath := filepath.Join(r.Root, "dists", m.Dist, comp, "binary-"+arch, "Packages")
+	if err := r.writeIndexFile(packagesPath, []byte(content.String())); err != nil {
 		return fmt.Errorf("write Packages: %w", err)
 	}
 
-	// Note: We intentionally don't generate Packages.gz or Packages.xz
-	// because GitHub Pages doesn't support Git LFS, and these files would
-	// be served as LFS pointers. Modern apt clients work fine with the
-	// uncompressed Packages file.
+	if r.Config.Contents {
+		if err := r.generateContents(m.Dist, comp, arch, packages); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
-func (r *Repository) scanPool(poolDir, arch string) ([]*deb.Package, error) {
-	var packages []*deb.Package
-
-	err := filepath.Walk(poolDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if info.IsDir() {
-			return nil
-		}
-		if !strings.HasSuffix(path, ".deb") {
-			return nil
+// removeArchIndices deletes the binary-<arch> directory and Contents-<arch>
+// files of a component, so Release no longer lists them.
+func (r *Repository) removeArchIndices(dist, comp, arch string) error {
+	compDir := filepath.Join(r.Root, "dists", dist, comp)
+	if err := os.RemoveAll(filepath.Join(compDir, "binary-"+arch)); err != nil {
+		return fmt.Errorf("remove binary-%s: %w", arch, err)
+	}
+	contents := filepath.Join(compDir, "Contents-"+arch)
+	paths := []string{contents}
+	for ext := range compressionFormats {
+		paths = append(paths, contents+"."+ext)
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove Contents-%s: %w", arch, err)
 		}
+	}
+	return nil
+}
 
-		pkg, err := deb.Parse(path)
-		if err != nil {
-			return fmt.Errorf("parse %s: %w", path, err)
+// distArchitectures returns the architectures a distribution has indices
+// for: the configured ones, followed by any other architecture of a package
+// in its manifest, sorted.
+func (r *Repository) distArchitectures(m *Manifest) []string {
+	present := make(map[string]bool)
+	for _, arch := range r.Config.Dist(m.Dist).Architectures {
+		present[arch] = true
+	}
+	for _, e := range m.Packages {
+		if e.Architecture != "all" {
+			present[e.Architecture] = true
 		}
+	}
+	return orderedUnion(r.Config.Dist(m.Dist).Architectures, present)
+}
+
+// checkArchitecture reports whether a package of the given architecture may
+// be added to dist. Unconfigured architectures get indices on demand unless
+// StrictArchitectures is set.
+func (r *Repository) checkArchitecture(dist, arch string) error {
+	if arch == "all" {
+		return nil
+	}
+	if !archPattern.MatchString(arch) {
+		return fmt.Errorf("invalid architecture %q", arch)
+	}
+	archs := r.Config.Dist(dist).Architectures
+	if r.Config.StrictArchitectures && !contains(archs, arch) {
+		return fmt.Errorf("architecture %s is not configured for %s (have %s)",
+			arch, dist, strings.Join(archs, ", "))
+	}
+	return nil
+}
+
+// distPackages parses the pool files that the manifest lists for a
+// component and architecture.
+func (r *Repository) distPackages(m *Manifest, comp, arch string) ([]*deb.Package, error) {
+	var packages []*deb.Package
 
+	for _, e := range m.Packages {
+		if e.Component() != comp {
+			continue
+		}
 		// Filter by architecture
-		if pkg.Architecture != arch && pkg.Architecture != "all" {
-			return nil
+		if e.Architecture != arch && e.Architecture != "all" {
+			continue
+		}
+		if e.Architecture == "all" && arch != "all" && r.Config.ArchAll == ArchAllSeparate {
+			continue
 		}
 
-		// Set relative filename
-		relPath, err := filepath.Rel(r.Root, path)
+		pkg, err := r.parsePoolFile(e.Filename)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		pkg.Filename = relPath
 
 		packages = append(packages, pkg)
-		return nil
-	})
-
-	if err != nil && !os.IsNotExist(err) {
-		return nil, err
 	}
 
 	// Sort packages by name, then version (newest first)
@@ -209,7 +353,18 @@ func (r *Repository) scanPool(poolDir, arch string) ([]*deb.Package, error) {
 }
 
 // GenerateRelease generates the Release file for a distribution.
+//
+// The Date is taken from SOURCE_DATE_EPOCH when it is set. Otherwise an
+// existing Release that would only change in its Date and Valid-Until is
+// kept as it is, so regenerating an unchanged repository does not produce a
+// new Release that then has to be signed and committed again.
 func (r *Repository) GenerateRelease(dist string) error {
+	return r.generateRelease(dist, false)
+}
+
+// generateRelease writes the Release file of a distribution. With redate
+// set, the Release always gets a new Date, even if nothing else changed.
+func (r *Repository) generateRelease(dist string, redate bool) error {
 	distDir := filepath.Join(r.Root, "dists", dist)
 
 	// Collect all files that need checksums
@@ -219,16 +374,15 @@ func (r *Repository) GenerateRelease(dist string) error {
 			return err
 		}
 		if info.IsDir() {
+			// by-hash copies are addressed through the indices they duplicate
+			if info.Name() == byHashDir {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
-		name := filepath.Base(path)
 		// Only include index files
-		if !strings.HasPrefix(name, "Packages") && !strings.HasPrefix(name, "Release") {
-			return nil
-		}
-		// Skip the Release file itself
-		if name == "Release" || name == "Release.gpg" || name == "InRelease" {
+		if !isIndexFile(info.Name()) {
 			return nil
 		}
 
@@ -244,43 +398,166 @@ func (r *Repository) GenerateRelease(dist string) error {
 		return fmt.Errorf("walk dist directory: %w", err)
 	}
 
+	components, err := r.releaseComponents(dist)
+	if err != nil {
+		return err
+	}
+	architectures, err := r.releaseArchitectures(dist, components)
+	if err != nil {
+		return err
+	}
+	if r.Config.hasBinaryAll() {
+		architectures = append([]string{"all"}, architectures...)
+	}
+
 	// Build Release content
-	var b strings.Builder
-	b.WriteString(fmt.Sprintf("Origin: %s\n", r.Config.Origin))
-	b.WriteString(fmt.Sprintf("Label: %s\n", r.Config.Label))
-	b.WriteString(fmt.Sprintf("Suite: %s\n", dist))
-	b.WriteString(fmt.Sprintf("Codename: %s\n", dist))
-	b.WriteString(fmt.Sprintf("Architectures: %s\n", strings.Join(r.Config.Architectures, " ")))
-	b.WriteString(fmt.Sprintf("Components: %s\n", strings.Join(r.Config.Components, " ")))
-	b.WriteString(fmt.Sprintf("Description: %s\n", r.Config.Description))
-	b.WriteString(fmt.Sprintf("Date: %s\n", time.Now().UTC().Format("Mon, 02 Jan 2006 15:04:05 UTC")))
+	d := r.Config.Dist(dist)
+	render := func(date time.Time) string {
+		var b strings.Builder
+		b.WriteString(fmt.Sprintf("Origin: %s\n", r.Config.Origin))
+		b.WriteString(fmt.Sprintf("Label: %s\n", d.Label))
+		b.WriteString(fmt.Sprintf("Suite: %s\n", d.Suite))
+		if d.Version != "" {
+			b.WriteString(fmt.Sprintf("Version: %s\n", d.Version))
+		}
+		b.WriteString(fmt.Sprintf("Codename: %s\n", d.Codename))
+		if d.Changelogs != "" {
+			b.WriteString(fmt.Sprintf("Changelogs: %s\n", d.Changelogs))
+		}
+		b.WriteString(fmt.Sprintf("Architectures: %s\n", strings.Join(architectures, " ")))
+		b.WriteString(fmt.Sprintf("Components: %s\n", strings.Join(components, " ")))
+		b.WriteString(fmt.Sprintf("Description: %s\n", d.Description))
+		b.WriteString(fmt.Sprintf("Date: %s\n", date.Format(releaseTimeFormat)))
+		if d.ValidFor > 0 {
+			b.WriteString(fmt.Sprintf("Valid-Until: %s\n", date.Add(d.ValidFor).Format(releaseTimeFormat)))
+		}
+		if d.NotAutomatic {
+			b.WriteString("NotAutomatic: yes\n")
+		}
+		if d.ButAutomaticUpgrades {
+			b.WriteString("ButAutomaticUpgrades: yes\n")
+		}
+		if r.Config.AcquireByHash {
+			b.WriteString("Acquire-By-Hash: yes\n")
+		}
+		if r.Config.ArchAll == ArchAllBoth {
+			// binary-all exists, but every arch index still lists the packages
+			b.WriteString("No-Support-for-Architecture-all: Packages\n")
+		}
+		if len(d.SignedBy) > 0 {
+			b.WriteString(fmt.Sprintf("Signed-By: %s\n", strings.Join(d.SignedBy, ", ")))
+		}
 
-	// MD5Sum
-	b.WriteString("MD5Sum:\n")
-	for _, f := range files {
-		b.WriteString(fmt.Sprintf(" %s %16d %s\n", f.MD5, f.Size, f.Path))
-	}
+		// MD5Sum
+		b.WriteString("MD5Sum:\n")
+		for _, f := range files {
+			b.WriteString(fmt.Sprintf(" %s %16d %s\n", f.MD5, f.Size, f.Path))
+		}
 
-	// SHA1
-	b.WriteString("SHA1:\n")
-	for _, f := range files {
-		b.WriteString(fmt.Sprintf(" %s %16d %s\n", f.SHA1, f.Size, f.Path))
-	}
+		// SHA1
+		b.WriteString("SHA1:\n")
+		for _, f := range files {
+			b.WriteString(fmt.Sprintf(" %s %16d %s\n", f.SHA1, f.Size, f.Path))
+		}
 
-	// SHA256
-	b.WriteString("SHA256:\n")
-	for _, f := range files {
-		b.WriteString(fmt.Sprintf(" %s %16d %s\n", f.SHA256, f.Size, f.Path))
+		// SHA256
+		b.WriteString("SHA256:\n")
+		for _, f := range files {
+			b.WriteString(fmt.Sprintf(" %s %16d %s\n", f.SHA256, f.Size, f.Path))
+		}
+		return b.String()
 	}
 
+	date, pinned, err := releaseDate()
+	if err != nil {
+		return err
+	}
 	releasePath := filepath.Join(distDir, "Release")
-	if err := os.WriteFile(releasePath, []byte(b.String()), 0644); err != nil {
+	if !redate && !pinned {
+		if existing, err := os.ReadFile(releasePath); err == nil {
+			if prev, ok := releaseDateOf(existing); ok && render(prev) == string(existing) {
+				return nil
+			}
+		}
+	}
+
+	if _, err := writeFileIfChanged(releasePath, []byte(render(date))); err != nil {
 		return fmt.Errorf("write Release: %w", err)
 	}
 
 	return nil
 }
 
+// releaseComponents returns the components that have indices under
+// dists/<dist>: configured components first, in configured order, followed by
+// any others left on disk so Release describes every index it lists.
+func (r *Repository) releaseComponents(dist string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(r.Root, "dists", dist))
+	if err != nil {
+		return nil, fmt.Errorf("read dist directory: %w", err)
+	}
+
+	onDisk := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			onDisk[entry.Name()] = true
+		}
+	}
+	return orderedUnion(r.Config.Dist(dist).Components, onDisk), nil
+}
+
+// releaseArchitectures returns the architectures that have binary-<arch>
+// indices in any of the given components, ordered like releaseComponents.
+func (r *Repository) releaseArchitectures(dist string, components []string) ([]string, error) {
+	onDisk := make(map[string]bool)
+	for _, comp := range components {
+		archs, err := r.indexArchitectures(dist, comp)
+		if err != nil {
+			return nil, err
+		}
+		for _, arch := range archs {
+			onDisk[arch] = true
+		}
+	}
+	return orderedUnion(r.Config.Dist(dist).Architectures, onDisk), nil
+}
+
+// indexArchitectures returns the architectures with a binary-<arch>
+// directory in dists/<dist>/<comp>, in directory order.
+func (r *Repository) indexArchitectures(dist, comp string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(r.Root, "dists", dist, comp))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read component directory: %w", err)
+	}
+
+	var archs []string
+	for _, entry := range entries {
+		arch, ok := strings.CutPrefix(entry.Name(), "binary-")
+		if entry.IsDir() && ok && arch != "all" {
+			archs = append(archs, arch)
+		}
+	}
+	return archs, nil
+}
+
+// orderedUnion returns the configured values that are present, in order,
+// followed by the remaining present values, sorted.
+func orderedUnion(configured []string, present map[string]bool) []string {
+	present = maps.Clone(present)
+	var out []string
+	for _, v := range configured {
+		if present[v] {
+			out = append(out, v)
+			delete(present, v)
+		}
+	}
+	extra := slices.Sorted(maps.Keys(present))
+	return append(out, extra...)
+}
+
 type releaseFile struct {
 	Path   string
 	Size   int64
@@ -338,3 +615,21 @@ func copyFile(src, dst string) error {
 
 	return out.Close()
 }
+
+// writeFileIfChanged writes data to path unless the file already holds
+// exactly that content, so regenerating an unchanged repository leaves its
+// files, and the Git history of a published checkout, untouched. It reports
+// whether the file was written.
+func writeFileIfChanged(path string, data []byte) (bool, error) {
+	existing, err := os.ReadFile(path)
+	if err == nil && bytes.Equal(existing, data) {
+		return false, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,552 @@
+package repo
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blakesmith/ar"
+)
+
+// writeTestDeb builds a minimal .deb in dir and returns its path. Extra
+// control fields may be passed as complete "Field: value" lines.
+func writeTestDeb(t *testing.T, dir, name, version, arch string, extra ...string) string {
+	t.Helper()
+
+	control := fmt.Sprintf("Package: %s\nVersion: %s\nArchitecture: %s\nMaintainer: Test <test@example.com>\n", name, version, arch)
+	for _, field := range extra {
+		control += field + "\n"
+	}
+	control += "Description: test package\n"
+
+	controlTar := tarGz(t, map[string]string{"./control": control})
+	dataTar := tarGz(t, map[string]string{"./usr/bin/" + name: "#!/bin/sh\n"})
+
+	path := filepath.Join(dir, fmt.Sprintf("%s_%s_%s.deb", name, version, arch))
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create deb: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	aw := ar.NewWriter(f)
+	if err := aw.WriteGlobalHeader(); err != nil {
+		t.Fatalf("write ar header: %v", err)
+	}
+	members := []struct {
+		name string
+		data []byte
+	}{
+		{"debian-binary", []byte("2.0\n")},
+		{"control.tar.gz", controlTar},
+		{"data.tar.gz", dataTar},
+	}
+	for _, m := range members {
+		hdr := &ar.Header{Name: m.name, ModTime: time.Unix(0, 0), Mode: 0644, Size: int64(len(m.data))}
+		if err := aw.WriteHeader(hdr); err != nil {
+			t.Fatalf("write ar member header: %v", err)
+		}
+		if _, err := aw.Write(m.data); err != nil {
+			t.Fatalf("write ar member: %v", err)
+		}
+	}
+
+	return path
+}
+
+// tarGz returns a gzip-compressed tar archive holding the given files.
+func tarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatalf("write tar header: %v", err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close tar: %v", err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatalf("close gzip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func newTestRepo(t *testing.T) *Repository {
+	t.Helper()
+	r := New(t.TempDir(), DefaultConfig())
+	if err := r.Init(); err != nil {
+		t.Fatalf("init repo: %v", err)
+	}
+	return r
+}
+
+func readPackages(t *testing.T, r *Repository, dist string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(r.Root, "dists", dist, "main", "binary-amd64", "Packages"))
+	if err != nil {
+		t.Fatalf("read Packages: %v", err)
+	}
+	return string(data)
+}
+
+func TestAddPackageDistMembership(t *testing.T) {
+	r := newTestRepo(t)
+	src := t.TempDir()
+
+	if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, "myapp", "1.0.0", "amd64"), Dist: "stable"}); err != nil {
+		t.Fatalf("add stable: %v", err)
+	}
+	if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, "myapp", "1.1.0~rc1", "amd64"), Dist: "testing"}); err != nil {
+		t.Fatalf("add testing: %v", err)
+	}
+
+	for _, dist := range []string{"stable", "testing"} {
+		if err := r.GeneratePackagesIndex(dist); err != nil {
+			t.Fatalf("generate %s: %v", dist, err)
+		}
+	}
+
+	stable := readPackages(t, r, "stable")
+	if !strings.Contains(stable, "Version: 1.0.0\n") {
+		t.Error("stable missing 1.0.0")
+	}
+	if strings.Contains(stable, "1.1.0~rc1") {
+		t.Error("testing upload leaked into stable")
+	}
+
+	testingIdx := readPackages(t, r, "testing")
+	if !strings.Contains(testingIdx, "Version: 1.1.0~rc1\n") {
+		t.Error("testing missing 1.1.0~rc1")
+	}
+	if strings.Contains(testingIdx, "Version: 1.0.0\n") {
+		t.Error("stable upload leaked into testing")
+	}
+
+	if err := r.GenerateHTMLIndexes(); err != nil {
+		t.Fatalf("generate HTML indexes: %v", err)
+	}
+	page, err := os.ReadFile(filepath.Join(r.Root, "dists", "stable", "index.html"))
+	if err != nil {
+		t.Fatalf("read stable index: %v", err)
+	}
+	if !strings.Contains(string(page), "../../pool/main/m/myapp/myapp_1.0.0_amd64.deb") {
+		t.Error("stable page missing member package link")
+	}
+	if strings.Contains(string(page), "1.1.0~rc1") {
+		t.Error("stable page lists testing package")
+	}
+}
+
+func TestAddPackageUnknownDist(t *testing.T) {
+	r := newTestRepo(t)
+	deb := writeTestDeb(t, t.TempDir(), "myapp", "1.0.0", "amd64")
+
+	if _, err := r.AddPackage(AddOptions{Path: deb, Dist: "unstable"}); err == nil {
+		t.Error("expected error for unknown distribution")
+	}
+}
+
+func TestLoadManifestBootstrapsFromPackages(t *testing.T) {
+	r := newTestRepo(t)
+
+	packages := `Package: myapp
+Version: 1.0.0
+Architecture: amd64
+Filename: pool/main/m/myapp/myapp_1.0.0_amd64.deb
+Description: test package
+ with a continuation line
+
+Package: tool
+Version: 2.0
+Architecture: all
+Filename: pool/main/t/tool/tool_2.0_all.deb
+`
+	path := filepath.Join(r.Root, "dists", "stable", "main", "binary-amd64", "Packages")
+	if err := os.WriteFile(path, []byte(packages), 0644); err != nil {
+		t.Fatalf("write Packages: %v", err)
+	}
+
+	m, err := r.LoadManifest("stable")
+	if err != nil {
+		t.Fatalf("load manifest: %v", err)
+	}
+	if len(m.Packages) != 2 {
+		t.Fatalf("got %d entries, want 2", len(m.Packages))
+	}
+	if !m.Contains("pool/main/t/tool/tool_2.0_all.deb") {
+		t.Error("bootstrapped manifest missing tool")
+	}
+
+	empty, err := r.LoadManifest("testing")
+	if err != nil {
+		t.Fatalf("load testing manifest: %v", err)
+	}
+	if len(empty.Packages) != 0 {
+		t.Errorf("testing manifest has %d entries, want 0", len(empty.Packages))
+	}
+}
+
+func TestPruneUpdatesManifests(t *testing.T) {
+	r := newTestRepo(t)
+	src := t.TempDir()
+
+	for _, v := range []string{"1.0", "2.0", "3.0"} {
+		if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, "myapp", v, "amd64"), Dist: "stable"}); err != nil {
+			t.Fatalf("add %s: %v", v, err)
+		}
+	}
+
+	result, err := r.Prune(PruneOptions{KeepVersions: 2})
+	if err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if len(result.Deleted) != 1 {
+		t.Fatalf("deleted %d files, want 1", len(result.Deleted))
+	}
+	if len(result.Dists) != 1 || result.Dists[0] != "stable" {
+		t.Errorf("Dists = %v, want [stable]", result.Dists)
+	}
+
+	m, err := r.LoadManifest("stable")
+	if err != nil {
+		t.Fatalf("load manifest: %v", err)
+	}
+	if m.Contains("pool/main/m/myapp/myapp_1.0_amd64.deb") {
+		t.Error("pruned file still in manifest")
+	}
+	if len(m.Packages) != 2 {
+		t.Errorf("manifest has %d entries, want 2", len(m.Packages))
+	}
+}
+
+func TestAddPackageComponent(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Components = []string{"main", "non-free"}
+	cfg.Overrides = map[string]DistConfig{"testing": {Components: []string{"main"}}}
+	r := New(t.TempDir(), cfg)
+	if err := r.Init(); err != nil {
+		t.Fatalf("init repo: %v", err)
+	}
+	src := t.TempDir()
+
+	res, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, "firmware-acme", "1.0", "amd64"), Dist: "stable", Component: "non-free"})
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	pkg := res.Package
+	if want := "pool/non-free/f/firmware-acme/firmware-acme_1.0_amd64.deb"; filepath.ToSlash(pkg.Filename) != want {
+		t.Errorf("Filename = %q, want %q", pkg.Filename, want)
+	}
+	if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, "myapp", "1.0", "amd64"), Dist: "stable"}); err != nil {
+		t.Fatalf("add to default component: %v", err)
+	}
+	if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, "other", "1.0", "amd64"), Dist: "testing", Component: "non-free"}); err == nil {
+		t.Error("expected error adding to a component testing does not have")
+	}
+
+	if err := r.GeneratePackagesIndex("stable"); err != nil {
+		t.Fatalf("GeneratePackagesIndex: %v", err)
+	}
+	if err := r.GenerateRelease("stable"); err != nil {
+		t.Fatalf("GenerateRelease: %v", err)
+	}
+
+	mainIdx := readPackages(t, r, "stable")
+	if !strings.Contains(mainIdx, "Package: myapp\n") || strings.Contains(mainIdx, "firmware-acme") {
+		t.Errorf("main Packages = %q", mainIdx)
+	}
+	data, err := os.ReadFile(filepath.Join(r.Root, "dists", "stable", "non-free", "binary-amd64", "Packages"))
+	if err != nil {
+		t.Fatalf("read non-free Packages: %v", err)
+	}
+	if !strings.Contains(string(data), "Package: firmware-acme\n") || strings.Contains(string(data), "myapp") {
+		t.Errorf("non-free Packages = %q", data)
+	}
+
+	release, err := os.ReadFile(filepath.Join(r.Root, "dists", "stable", "Release"))
+	if err != nil {
+		t.Fatalf("read Release: %v", err)
+	}
+	if !strings.Contains(string(release), "Components: main non-free\n") {
+		t.Errorf("Release Components wrong:\n%s", release)
+	}
+
+	// A component directory left over from an old configuration is still
+	// described, since Release lists its index files.
+	if err := os.MkdirAll(filepath.Join(r.Root, "dists", "testing", "contrib", "binary-amd64"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.GenerateRelease("testing"); err != nil {
+		t.Fatalf("GenerateRelease: %v", err)
+	}
+	release, err = os.ReadFile(filepath.Join(r.Root, "dists", "testing", "Release"))
+	if err != nil {
+		t.Fatalf("read Release: %v", err)
+	}
+	if !strings.Contains(string(release), "Components: main contrib\n") {
+		t.Errorf("testing Release Components wrong:\n%s", release)
+	}
+
+	// Promoting into a distribution without the component is refused
+	if _, err := r.Promote(PromoteOptions{From: "stable", To: "testing", Package: "firmware-acme"}); err == nil {
+		t.Error("expected error promoting into a missing component")
+	}
+}
+
+func TestAddPackageArchitectures(t *testing.T) {
+	r := newTestRepo(t)
+	src := t.TempDir()
+
+	for _, p := range [][2]string{{"myapp", "arm64"}, {"myapp", "amd64"}, {"docs", "all"}} {
+		if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, p[0], "1.0", p[1]), Dist: "stable"}); err != nil {
+			t.Fatalf("add %s %s: %v", p[0], p[1], err)
+		}
+	}
+	if err := r.GeneratePackagesIndex("stable"); err != nil {
+		t.Fatalf("GeneratePackagesIndex: %v", err)
+	}
+	if err := r.GenerateRelease("stable"); err != nil {
+		t.Fatalf("GenerateRelease: %v", err)
+	}
+
+	for _, arch := range []string{"amd64", "arm64"} {
+		data, err := os.ReadFile(filepath.Join(r.Root, "dists", "stable", "main", "binary-"+arch, "Packages"))
+		if err != nil {
+			t.Fatalf("read %s Packages: %v", arch, err)
+		}
+		index := string(data)
+		if !strings.Contains(index, "Package: docs\n") {
+			t.Errorf("binary-%s missing Architecture: all package", arch)
+		}
+		if !strings.Contains(index, "Architecture: "+arch+"\n") {
+			t.Errorf("binary-%s missing its own package", arch)
+		}
+		if strings.Count(index, "Package: myapp\n") != 1 {
+			t.Errorf("binary-%s has other architectures' packages:\n%s", arch, index)
+		}
+	}
+
+	release, err := os.ReadFile(filepath.Join(r.Root, "dists", "stable", "Release"))
+	if err != nil {
+		t.Fatalf("read Release: %v", err)
+	}
+	if !strings.Contains(string(release), "Architectures: amd64 arm64\n") {
+		t.Errorf("Release Architectures wrong:\n%s", release)
+	}
+	if !strings.Contains(string(release), "main/binary-arm64/Packages\n") {
+		t.Error("Release does not list the arm64 index")
+	}
+
+	// The testing index is untouched by stable's architectures
+	if _, err := os.Stat(filepath.Join(r.Root, "dists", "testing", "main", "binary-arm64")); !os.IsNotExist(err) {
+		t.Error("binary-arm64 created for testing")
+	}
+}
+
+func TestAddPackageStrictArchitectures(t *testing.T) {
+	r := newTestRepo(t)
+	r.Config.StrictArchitectures = true
+	src := t.TempDir()
+
+	if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, "myapp", "1.0", "arm64"), Dist: "stable"}); err == nil {
+		t.Error("expected error adding an unconfigured architecture")
+	}
+	if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, "docs", "1.0", "all"), Dist: "stable"}); err != nil {
+		t.Errorf("add Architecture: all package: %v", err)
+	}
+
+	r.Config.StrictArchitectures = false
+	if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, "bad", "1.0", "Not_An_Arch"), Dist: "stable"}); err == nil {
+		t.Error("expected error adding an invalid architecture")
+	}
+}
+
+func TestArchAllModes(t *testing.T) {
+	tests := []struct {
+		mode       string
+		binaryAll  bool // binary-all/Packages is written
+		duplicated bool // binary-amd64/Packages lists the all package
+		release    []string
+		notRelease []string
+	}{
+		{ArchAllDuplicate, false, true,
+			[]string{"Architectures: amd64\n"},
+			[]string{"No-Support-for-Architecture-all", "binary-all"}},
+		{ArchAllBoth, true, true,
+			[]string{"Architectures: all amd64\n", "No-Support-for-Architecture-all: Packages\n", "main/binary-all/Packages\n"},
+			nil},
+		{ArchAllSeparate, true, false,
+			[]string{"Architectures: all amd64\n", "main/binary-all/Packages\n", "main/Contents-all\n"},
+			[]string{"No-Support-for-Architecture-all"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.mode, func(t *testing.T) {
+			r := newTestRepo(t)
+			r.Config.ArchAll = tc.mode
+			src := t.TempDir()
+			for _, p := range [][2]string{{"myapp", "amd64"}, {"docs", "all"}} {
+				if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, p[0], "1.0", p[1]), Dist: "stable"}); err != nil {
+					t.Fatalf("add %s: %v", p[0], err)
+				}
+			}
+			if err := r.GeneratePackagesIndex("stable"); err != nil {
+				t.Fatalf("GeneratePackagesIndex: %v", err)
+			}
+			if err := r.GenerateRelease("stable"); err != nil {
+				t.Fatalf("GenerateRelease: %v", err)
+			}
+
+			amd64 := readPackages(t, r, "stable")
+			if strings.Contains(amd64, "Package: docs\n") != tc.duplicated {
+				t.Errorf("binary-amd64 lists docs = %v, want %v", !tc.duplicated, tc.duplicated)
+			}
+			if !strings.Contains(amd64, "Package: myapp\n") {
+				t.Error("binary-amd64 missing myapp")
+			}
+
+			all, err := os.ReadFile(filepath.Join(r.Root, "dists", "stable", "main", "binary-all", "Packages"))
+			if tc.binaryAll {
+				if err != nil {
+					t.Fatalf("read binary-all: %v", err)
+				}
+				if !strings.Contains(string(all), "Package: docs\n") || strings.Contains(string(all), "myapp") {
+					t.Errorf("binary-all Packages = %q", all)
+				}
+			} else if !os.IsNotExist(err) {
+				t.Errorf("binary-all written in %s mode", tc.mode)
+			}
+
+			release, err := os.ReadFile(filepath.Join(r.Root, "dists", "stable", "Release"))
+			if err != nil {
+				t.Fatalf("read Release: %v", err)
+			}
+			for _, want := range tc.release {
+				if !strings.Contains(string(release), want) {
+					t.Errorf("Release missing %q:\n%s", want, release)
+				}
+			}
+			for _, unwanted := range tc.notRelease {
+				if strings.Contains(string(release), unwanted) {
+					t.Errorf("Release contains %q:\n%s", unwanted, release)
+				}
+			}
+		})
+	}
+}
+
+func TestArchAllSwitchBackRemovesBinaryAll(t *testing.T) {
+	r := newTestRepo(t)
+	r.Config.ArchAll = ArchAllSeparate
+	if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, t.TempDir(), "docs", "1.0", "all"), Dist: "stable"}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := r.GeneratePackagesIndex("stable"); err != nil {
+		t.Fatalf("GeneratePackagesIndex: %v", err)
+	}
+
+	r.Config.ArchAll = ArchAllDuplicate
+	if err := r.GeneratePackagesIndex("stable"); err != nil {
+		t.Fatalf("GeneratePackagesIndex: %v", err)
+	}
+	compDir := filepath.Join(r.Root, "dists", "stable", "main")
+	for _, name := range []string{"binary-all", "Contents-all"} {
+		if _, err := os.Stat(filepath.Join(compDir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s left behind after switching to duplicate mode", name)
+		}
+	}
+	if !strings.Contains(readPackages(t, r, "stable"), "Package: docs\n") {
+		t.Error("binary-amd64 missing docs after switching to duplicate mode")
+	}
+}
+
+func TestRegenerateUnchangedRepository(t *testing.T) {
+	r := newTestRepo(t)
+	r.Config.Compression = []string{"gz", "xz"}
+	r.Config.AcquireByHash = true
+	src := t.TempDir()
+	if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, "myapp", "1.0.0", "amd64"), Dist: "stable"}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	generate := func() {
+		t.Helper()
+		if err := r.GeneratePackagesIndex("stable"); err != nil {
+			t.Fatalf("GeneratePackagesIndex: %v", err)
+		}
+		if err := r.GenerateRelease("stable"); err != nil {
+			t.Fatalf("GenerateRelease: %v", err)
+		}
+		if err := r.GenerateHTMLIndexes(); err != nil {
+			t.Fatalf("GenerateHTMLIndexes: %v", err)
+		}
+	}
+	generate()
+
+	// Backdate everything, including the Release Date, so any rewrite shows
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	releasePath := filepath.Join(r.Root, "dists", "stable", "Release")
+	release, err := os.ReadFile(releasePath)
+	if err != nil {
+		t.Fatalf("read Release: %v", err)
+	}
+	date, ok := releaseDateOf(release)
+	if !ok {
+		t.Fatalf("Release has no Date:\n%s", release)
+	}
+	release = bytes.Replace(release, []byte(date.Format(releaseTimeFormat)), []byte(old.Format(releaseTimeFormat)), 1)
+	if err := os.WriteFile(releasePath, release, 0644); err != nil {
+		t.Fatalf("write Release: %v", err)
+	}
+	err = filepath.Walk(r.Root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		return os.Chtimes(path, old, old)
+	})
+	if err != nil {
+		t.Fatalf("backdate files: %v", err)
+	}
+
+	generate()
+
+	err = filepath.Walk(r.Root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if !info.ModTime().Equal(old) {
+			rel, _ := filepath.Rel(r.Root, path)
+			t.Errorf("%s was rewritten", rel)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk: %v", err)
+	}
+
+	// A real change gets a new Release with a current Date
+	if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, src, "myapp", "1.1.0", "amd64"), Dist: "stable"}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	generate()
+	release, err = os.ReadFile(releasePath)
+	if err != nil {
+		t.Fatalf("read Release: %v", err)
+	}
+	if date, _ := releaseDateOf(release); !date.After(old) {
+		t.Errorf("Release Date %v was not updated", date)
+	}
+}
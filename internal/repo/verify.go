@@ -0,0 +1,436 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/frostyard/plow/internal/deb"
+	"github.com/frostyard/plow/internal/gpg"
+)
+
+// Exported signing keys published at the repository root, which clients
+// download to verify Release signatures: ASCII-armored, and as a binary
+// keyring that apt can use from /usr/share/keyrings as is.
+const (
+	PublicKeyFile = "public.key"
+	KeyringFile   = "keyring.gpg"
+)
+
+// Severities of a VerifyProblem. Errors make the repository unusable or
+// untrustworthy for clients; warnings are inconsistencies that are not.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// VerifyOptions configures the integrity check.
+type VerifyOptions struct {
+	PublicKey      string // Key file signatures are checked against (default: public.key in the root)
+	SkipSignatures bool   // If true, InRelease and Release.gpg are not checked
+}
+
+// VerifyProblem is a single inconsistency found by Verify.
+type VerifyProblem struct {
+	Severity string `json:"severity"`
+	Check    string `json:"check"` // Which check failed, e.g. release-checksum
+	Dist     string `json:"dist,omitempty"`
+	Path     string `json:"path"` // Relative to the repository root
+	Message  string `json:"message"`
+}
+
+// VerifyReport contains the result of Verify.
+type VerifyReport struct {
+	OK         bool            `json:"ok"` // No problem has error severity
+	Dists      []string        `json:"dists"`
+	IndexFiles int             `json:"index_files"` // Index files checked
+	Packages   int             `json:"packages"`    // Packages entries checked
+	PoolFiles  int             `json:"pool_files"`  // .deb files in the pool
+	Problems   []VerifyProblem `json:"problems"`
+}
+
+// Errors returns the number of problems with error severity.
+func (rep *VerifyReport) Errors() int {
+	n := 0
+	for _, p := range rep.Problems {
+		if p.Severity == SeverityError {
+			n++
+		}
+	}
+	return n
+}
+
+func (rep *VerifyReport) add(severity, check, dist, path, format string, args ...any) {
+	rep.Problems = append(rep.Problems, VerifyProblem{
+		Severity: severity,
+		Check:    check,
+		Dist:     dist,
+		Path:     filepath.ToSlash(path),
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// verifier holds the state of one Verify run.
+type verifier struct {
+	r          *Repository
+	opts       VerifyOptions
+	report     *VerifyReport
+	keys       *gpg.Verifier
+	pool       map[string]*releaseFile // Checksums of pool files, by relative path
+	referenced map[string]bool         // Pool files listed in a Packages index
+}
+
+// Verify checks that the repository on disk is consistent: that every file
+// listed in each distribution's Release exists with the listed size and
+// checksums and no index is missing from it, that compressed indices match
+// their uncompressed form, that every Packages entry refers to a pool file
+// with the listed size and checksums, and that InRelease and Release.gpg are
+// valid signatures by the published public key. Pool files that no index
+// refers to are reported as warnings.
+//
+// Problems are collected in the report; the returned error is only set when
+// the check itself could not run.
+func (r *Repository) Verify(opts VerifyOptions) (*VerifyReport, error) {
+	if opts.PublicKey == "" {
+		opts.PublicKey = filepath.Join(r.Root, PublicKeyFile)
+	}
+
+	v := &verifier{
+		r:    r,
+		opts: opts,
+		report: &VerifyReport{
+			Dists:    r.Config.Distributions,
+			Problems: []VerifyProblem{},
+		},
+		pool:       make(map[string]*releaseFile),
+		referenced: make(map[string]bool),
+	}
+
+	if !opts.SkipSignatures {
+		keys, err := gpg.NewVerifier(opts.PublicKey)
+		if err != nil {
+			v.report.add(SeverityError, "signature", "", v.rel(opts.PublicKey), "cannot load public key: %v", err)
+		} else {
+			defer keys.Close() //nolint:errcheck // Temporary keyring, removal failure is not critical
+			v.keys = keys
+		}
+	}
+
+	for _, dist := range r.Config.Distributions {
+		if err := v.verifyDist(dist); err != nil {
+			return nil, fmt.Errorf("verify %s: %w", dist, err)
+		}
+	}
+	if err := v.verifyPool(); err != nil {
+		return nil, err
+	}
+
+	v.report.OK = v.report.Errors() == 0
+	return v.report, nil
+}
+
+func (v *verifier) rel(path string) string {
+	rel, err := filepath.Rel(v.r.Root, path)
+	if err != nil {
+		return path
+	}
+	return rel
+}
+
+func (v *verifier) verifyDist(dist string) error {
+	distDir := filepath.Join(v.r.Root, "dists", dist)
+	releasePath := filepath.Join(distDir, "Release")
+
+	listed, err := v.verifyRelease(dist, releasePath)
+	if err != nil {
+		return err
+	}
+
+	err = filepath.Walk(distDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == byHashDir {
+				return v.verifyByHash(dist, path)
+			}
+			return nil
+		}
+		if !isIndexFile(info.Name()) {
+			return nil
+		}
+
+		v.report.IndexFiles++
+		relPath, err := filepath.Rel(distDir, path)
+		if err != nil {
+			return err
+		}
+		if listed != nil && !listed[filepath.ToSlash(relPath)] {
+			v.report.add(SeverityError, "unlisted-index", dist, v.rel(path), "index file is not listed in Release")
+		}
+
+		ext := strings.TrimPrefix(filepath.Ext(path), ".")
+		if _, ok := compressionFormats[ext]; ok {
+			return v.verifyCompressed(dist, path, ext)
+		}
+		if strings.HasPrefix(info.Name(), "Packages") {
+			return v.verifyPackages(dist, path)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("walk dist directory: %w", err)
+	}
+
+	if v.keys != nil {
+		v.verifySignatures(dist, distDir)
+	}
+	return nil
+}
+
+// verifyRelease checks the files listed in a Release file and returns the
+// set of listed paths, relative to the distribution directory. It returns
+// nil when there is no usable Release.
+func (v *verifier) verifyRelease(dist, releasePath string) (map[string]bool, error) {
+	data, err := os.ReadFile(releasePath)
+	if os.IsNotExist(err) {
+		v.report.add(SeverityError, "release", dist, v.rel(releasePath), "Release file is missing")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read Release: %w", err)
+	}
+	release, err := deb.ParseStanza(data)
+	if err != nil {
+		v.report.add(SeverityError, "release", dist, v.rel(releasePath), "cannot parse Release: %v", err)
+		return nil, nil
+	}
+
+	distDir := filepath.Dir(releasePath)
+	listed := make(map[string]bool)
+	actual := make(map[string]*releaseFile)
+	for _, field := range []string{"MD5Sum", "SHA1", "SHA256"} {
+		for _, line := range strings.Split(release.Get(field), "\n") {
+			parts := strings.Fields(line)
+			if len(parts) == 0 {
+				continue
+			}
+			if len(parts) != 3 {
+				v.report.add(SeverityError, "release", dist, v.rel(releasePath), "malformed %s line %q", field, strings.TrimSpace(line))
+				continue
+			}
+			sum, sizeStr, relPath := parts[0], parts[1], parts[2]
+			path := filepath.Join(distDir, filepath.FromSlash(relPath))
+
+			if _, seen := actual[relPath]; !seen {
+				listed[relPath] = true
+				rf, err := newReleaseFile(path, relPath)
+				switch {
+				case os.IsNotExist(err):
+					v.report.add(SeverityError, "release-checksum", dist, v.rel(path), "file listed in Release does not exist")
+					actual[relPath] = nil
+				case err != nil:
+					return nil, fmt.Errorf("checksum %s: %w", relPath, err)
+				default:
+					actual[relPath] = &rf
+				}
+			}
+			rf := actual[relPath]
+			if rf == nil {
+				continue
+			}
+
+			if size, err := strconv.ParseInt(sizeStr, 10, 64); err != nil || size != rf.Size {
+				v.report.add(SeverityError, "release-checksum", dist, v.rel(path), "%s size %s in Release, %d on disk", field, sizeStr, rf.Size)
+				continue
+			}
+			want := map[string]string{"MD5Sum": rf.MD5, "SHA1": rf.SHA1, "SHA256": rf.SHA256}[field]
+			if sum != want {
+				v.report.add(SeverityError, "release-checksum", dist, v.rel(path), "%s %s in Release, %s on disk", field, sum, want)
+			}
+		}
+	}
+	return listed, nil
+}
+
+// verifyCompressed checks that a compressed index matches the uncompressed
+// index next to it.
+func (v *verifier) verifyCompressed(dist, path, ext string) error {
+	base := strings.TrimSuffix(path, "."+ext)
+	plain, err := os.ReadFile(base)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	compressed, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	content, err := decompressIndex(ext, compressed)
+	if err != nil {
+		v.report.add(SeverityError, "compressed-index", dist, v.rel(path), "cannot decompress: %v", err)
+		return nil
+	}
+	if string(content) != string(plain) {
+		v.report.add(SeverityError, "compressed-index", dist, v.rel(path), "content differs from %s", filepath.Base(base))
+	}
+	return nil
+}
+
+// verifyPackages checks every entry of a Packages index against the pool.
+func (v *verifier) verifyPackages(dist, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint:errcheck // Read-only file, close error is not critical
+
+	stanzas, err := deb.ParseStanzas(f)
+	if err != nil {
+		v.report.add(SeverityError, "packages", dist, v.rel(path), "cannot parse: %v", err)
+		return nil
+	}
+
+	for _, s := range stanzas {
+		v.report.Packages++
+		name := s.Get("Package") + " " + s.Get("Version") + " " + s.Get("Architecture")
+		filename := s.Get("Filename")
+		if filename == "" {
+			v.report.add(SeverityError, "packages", dist, v.rel(path), "%s has no Filename", name)
+			continue
+		}
+		v.referenced[filename] = true
+
+		rf, err := v.poolFile(filename)
+		if err != nil {
+			return err
+		}
+		if rf == nil {
+			v.report.add(SeverityError, "missing-pool-file", dist, filename, "%s is listed in %s but its pool file does not exist", name, v.rel(path))
+			continue
+		}
+
+		if size := s.Get("Size"); size != strconv.FormatInt(rf.Size, 10) {
+			v.report.add(SeverityError, "package-checksum", dist, filename, "Size %s in %s, %d on disk", size, v.rel(path), rf.Size)
+			continue
+		}
+		for _, c := range []struct{ field, actual string }{
+			{"MD5sum", rf.MD5}, {"SHA1", rf.SHA1}, {"SHA256", rf.SHA256},
+		} {
+			if want, ok := s.Lookup(c.field); ok && want != c.actual {
+				v.report.add(SeverityError, "package-checksum", dist, filename, "%s %s in %s, %s on disk", c.field, want, v.rel(path), c.actual)
+			}
+		}
+		if _, ok := s.Lookup("SHA256"); !ok {
+			v.report.add(SeverityError, "package-checksum", dist, filename, "no SHA256 in %s", v.rel(path))
+		}
+	}
+	return nil
+}
+
+// poolFile returns the size and checksums of a pool file, computing them on
+// first use, or nil if it does not exist. The metadata cache is not used,
+// since the point is to check the files themselves.
+func (v *verifier) poolFile(filename string) (*releaseFile, error) {
+	if rf, ok := v.pool[filename]; ok {
+		return rf, nil
+	}
+	rf, err := newReleaseFile(filepath.Join(v.r.Root, filepath.FromSlash(filename)), filename)
+	if os.IsNotExist(err) {
+		v.pool[filename] = nil
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("checksum %s: %w", filename, err)
+	}
+	v.pool[filename] = &rf
+	return &rf, nil
+}
+
+// verifyByHash checks that every by-hash copy is named after its digest.
+func (v *verifier) verifyByHash(dist, dir string) error {
+	hashDir := filepath.Join(dir, "SHA256")
+	entries, err := os.ReadDir(hashDir)
+	if os.IsNotExist(err) {
+		return filepath.SkipDir
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(hashDir, entry.Name())
+		digest, err := sha256File(path)
+		if err != nil {
+			return err
+		}
+		if digest != entry.Name() {
+			v.report.add(SeverityError, "by-hash", dist, v.rel(path), "content has SHA256 %s", digest)
+		}
+	}
+	return filepath.SkipDir
+}
+
+// verifySignatures checks Release.gpg and InRelease against the public key.
+func (v *verifier) verifySignatures(dist, distDir string) {
+	releasePath := filepath.Join(distDir, "Release")
+	release, err := os.ReadFile(releasePath)
+	if err != nil {
+		// Already reported by verifyRelease
+		return
+	}
+
+	sigPath := filepath.Join(distDir, "Release.gpg")
+	if _, err := os.Stat(sigPath); os.IsNotExist(err) {
+		v.report.add(SeverityError, "signature", dist, v.rel(sigPath), "Release.gpg is missing")
+	} else if err := v.keys.VerifyDetached(releasePath, sigPath); err != nil {
+		v.report.add(SeverityError, "signature", dist, v.rel(sigPath), "bad signature: %v", err)
+	}
+
+	inReleasePath := filepath.Join(distDir, "InRelease")
+	inRelease, err := os.ReadFile(inReleasePath)
+	if os.IsNotExist(err) {
+		v.report.add(SeverityError, "signature", dist, v.rel(inReleasePath), "InRelease is missing")
+		return
+	}
+	if err := v.keys.VerifyInline(inReleasePath); err != nil {
+		v.report.add(SeverityError, "signature", dist, v.rel(inReleasePath), "bad signature: %v", err)
+		return
+	}
+	if text, ok := clearsignedText(inRelease); !ok || text != strings.TrimRight(string(release), "\n") {
+		v.report.add(SeverityError, "signature", dist, v.rel(inReleasePath), "signed content differs from Release")
+	}
+}
+
+// verifyPool reports pool files that no Packages index refers to.
+func (v *verifier) verifyPool() error {
+	var orphans []string
+	err := filepath.Walk(filepath.Join(v.r.Root, "pool"), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, ".deb") {
+			return nil
+		}
+		v.report.PoolFiles++
+		relPath := filepath.ToSlash(v.rel(path))
+		if !v.referenced[relPath] {
+			orphans = append(orphans, relPath)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("walk pool: %w", err)
+	}
+
+	sort.Strings(orphans)
+	for _, path := range orphans {
+		v.report.add(SeverityWarning, "orphaned-pool-file", "", path, "pool file is not listed in any Packages index")
+	}
+	return nil
+}
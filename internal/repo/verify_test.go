@@ -0,0 +1,226 @@
+package repo
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/frostyard/plow/internal/gpg"
+)
+
+// newVerifiedTestRepo returns a repository with one indexed package in
+// stable, and indices and Release for every distribution.
+func newVerifiedTestRepo(t *testing.T) *Repository {
+	t.Helper()
+	r := newTestRepo(t)
+	r.Config.Compression = []string{"gz"}
+	r.Config.AcquireByHash = true
+	if _, err := r.AddPackage(AddOptions{Path: writeTestDeb(t, t.TempDir(), "myapp", "1.0.0", "amd64"), Dist: "stable"}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	for _, dist := range r.Config.Distributions {
+		if err := r.GeneratePackagesIndex(dist); err != nil {
+			t.Fatalf("GeneratePackagesIndex: %v", err)
+		}
+		if err := r.GenerateRelease(dist); err != nil {
+			t.Fatalf("GenerateRelease: %v", err)
+		}
+	}
+	return r
+}
+
+// problemChecks returns the checks of the problems in a report, by path.
+func problemChecks(t *testing.T, r *Repository) map[string]string {
+	t.Helper()
+	report, err := r.Verify(VerifyOptions{SkipSignatures: true})
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	checks := make(map[string]string)
+	for _, p := range report.Problems {
+		checks[p.Path] = p.Check
+	}
+	if report.OK != (report.Errors() == 0) {
+		t.Errorf("OK is %v with %d errors", report.OK, report.Errors())
+	}
+	return checks
+}
+
+func TestVerifyConsistentRepository(t *testing.T) {
+	r := newVerifiedTestRepo(t)
+	report, err := r.Verify(VerifyOptions{SkipSignatures: true})
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if !report.OK || len(report.Problems) != 0 {
+		t.Errorf("consistent repository has problems: %+v", report.Problems)
+	}
+	if report.Packages != 1 || report.PoolFiles != 1 {
+		t.Errorf("checked %d packages and %d pool files, want 1 and 1", report.Packages, report.PoolFiles)
+	}
+}
+
+func TestVerifyDetectsProblems(t *testing.T) {
+	r := newVerifiedTestRepo(t)
+	poolFile := "pool/main/m/myapp/myapp_1.0.0_amd64.deb"
+	stableMain := filepath.Join(r.Root, "dists", "stable", "main")
+
+	// A pool file that changed after indexing
+	f, err := os.OpenFile(filepath.Join(r.Root, poolFile), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("open pool file: %v", err)
+	}
+	if _, err := f.WriteString("tampered"); err != nil {
+		t.Fatalf("tamper pool file: %v", err)
+	}
+	_ = f.Close()
+
+	// A pool file no index refers to
+	orphan := "pool/main/o/orphan/orphan_1.0_amd64.deb"
+	if err := os.MkdirAll(filepath.Dir(filepath.Join(r.Root, orphan)), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(r.Root, orphan), []byte("deb"), 0644); err != nil {
+		t.Fatalf("write orphan: %v", err)
+	}
+
+	// A compressed index that does not match, and is not what Release lists
+	gz, err := gzipBytes([]byte("Package: other\n"))
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(stableMain, "binary-amd64", "Packages.gz"), gz, 0644); err != nil {
+		t.Fatalf("write Packages.gz: %v", err)
+	}
+
+	// An index Release does not list
+	if err := os.MkdirAll(filepath.Join(stableMain, "binary-arm64"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(stableMain, "binary-arm64", "Packages"), nil, 0644); err != nil {
+		t.Fatalf("write Packages: %v", err)
+	}
+
+	// An index Release lists that is gone
+	if err := os.Remove(filepath.Join(r.Root, "dists", "testing", "main", "binary-amd64", "Packages.gz")); err != nil {
+		t.Fatalf("remove Packages.gz: %v", err)
+	}
+
+	checks := problemChecks(t, r)
+	want := map[string]string{
+		poolFile: "package-checksum",
+		orphan:   "orphaned-pool-file",
+		"dists/stable/main/binary-amd64/Packages.gz":  "compressed-index",
+		"dists/stable/main/binary-arm64/Packages":     "unlisted-index",
+		"dists/testing/main/binary-amd64/Packages.gz": "release-checksum",
+	}
+	for path, check := range want {
+		if checks[path] != check {
+			t.Errorf("%s: got check %q, want %q (all problems: %v)", path, checks[path], check, checks)
+		}
+	}
+
+	// Release checksum mismatches are reported along with the content check
+	report, err := r.Verify(VerifyOptions{SkipSignatures: true})
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	found := false
+	for _, p := range report.Problems {
+		if p.Path == "dists/stable/main/binary-amd64/Packages.gz" && p.Check == "release-checksum" {
+			found = true
+		}
+		if p.Check == "orphaned-pool-file" && p.Severity != SeverityWarning {
+			t.Errorf("orphaned pool file has severity %s", p.Severity)
+		}
+	}
+	if !found {
+		t.Error("changed Packages.gz not reported as a Release checksum mismatch")
+	}
+	if report.OK {
+		t.Error("report is OK despite errors")
+	}
+}
+
+func TestVerifyMissingPoolFile(t *testing.T) {
+	r := newVerifiedTestRepo(t)
+	poolFile := "pool/main/m/myapp/myapp_1.0.0_amd64.deb"
+	if err := os.Remove(filepath.Join(r.Root, poolFile)); err != nil {
+		t.Fatalf("remove pool file: %v", err)
+	}
+	if checks := problemChecks(t, r); checks[poolFile] != "missing-pool-file" {
+		t.Errorf("missing pool file not reported: %v", checks)
+	}
+}
+
+func TestVerifySignatures(t *testing.T) {
+	if _, err := exec.LookPath("gpgv"); err != nil {
+		t.Skip("gpgv not installed")
+	}
+	// gpg-agent sockets live in GNUPGHOME, whose path must stay short
+	home, err := os.MkdirTemp("", "plow-gpg-")
+	if err != nil {
+		t.Fatalf("create GNUPGHOME: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = exec.Command("gpgconf", "--homedir", home, "--kill", "all").Run()
+		_ = os.RemoveAll(home)
+	})
+	t.Setenv("GNUPGHOME", home)
+	t.Setenv("GPG_PASSPHRASE", "")
+	gen := exec.Command("gpg", "--batch", "--passphrase", "", "--quick-gen-key", "Plow Test <test@example.com>", "ed25519", "sign", "never")
+	if out, err := gen.CombinedOutput(); err != nil {
+		t.Skipf("cannot generate test key: %v: %s", err, out)
+	}
+
+	r := newVerifiedTestRepo(t)
+	signer := gpg.NewGPGSigner("")
+	if err := gpg.ExportPublicKey(signer, filepath.Join(r.Root, PublicKeyFile)); err != nil {
+		t.Fatalf("export public key: %v", err)
+	}
+
+	report, err := r.Verify(VerifyOptions{})
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if report.OK {
+		t.Error("unsigned repository verified")
+	}
+
+	for _, dist := range r.Config.Distributions {
+		if err := gpg.SignRelease(signer, filepath.Join(r.Root, "dists", dist)); err != nil {
+			t.Fatalf("sign %s: %v", dist, err)
+		}
+	}
+	report, err = r.Verify(VerifyOptions{})
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if !report.OK {
+		t.Errorf("signed repository has problems: %+v", report.Problems)
+	}
+
+	// A Release changed after signing no longer matches its signatures
+	releasePath := filepath.Join(r.Root, "dists", "stable", "Release")
+	release, err := os.ReadFile(releasePath)
+	if err != nil {
+		t.Fatalf("read Release: %v", err)
+	}
+	if err := os.WriteFile(releasePath, append(release, "NotAutomatic: yes\n"...), 0644); err != nil {
+		t.Fatalf("write Release: %v", err)
+	}
+	report, err = r.Verify(VerifyOptions{})
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	bad := make(map[string]bool)
+	for _, p := range report.Problems {
+		if p.Check == "signature" {
+			bad[p.Path] = true
+		}
+	}
+	if !bad["dists/stable/Release.gpg"] || !bad["dists/stable/InRelease"] {
+		t.Errorf("changed Release not detected: %+v", report.Problems)
+	}
+}